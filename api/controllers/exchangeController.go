@@ -71,3 +71,16 @@ func (c *ExchangeController) GetOrder(ctx iris.Context) error {
 	// 返回响应
 	return ctx.JSON(data)
 }
+
+// GetRateLimit 当前分钟 REST 请求权重及下单数用量
+func (c *ExchangeController) GetRateLimit(ctx iris.Context) error {
+	data := map[string]interface{}{
+		"code":    "0",
+		"message": "success",
+	}
+	data["data"] = map[string]exchange.RateUsage{
+		"futures": exchange.FuturesRateLimiter.Usage(),
+		"spot":    exchange.SpotRateLimiter.Usage(),
+	}
+	return ctx.JSON(data)
+}
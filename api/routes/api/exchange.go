@@ -12,4 +12,7 @@ func ExchangeRoutes(app router.Party) {
 	app.Get("/getOrder", func(ctx iris.Context) {
 		_ = c.GetOrder(ctx)
 	})
+	app.Get("/rateLimit", func(ctx iris.Context) {
+		_ = c.GetRateLimit(ctx)
+	})
 }
@@ -13,13 +13,18 @@ import (
 	"floolishman/storage"
 	"floolishman/types"
 	"floolishman/utils"
+	"floolishman/utils/clock"
 	"floolishman/utils/metrics"
 	"fmt"
 	"github.com/aybabtme/uniplot/histogram"
 	"github.com/olekukonko/tablewriter"
+	"github.com/xhit/go-str2duration/v2"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type OrderSubscriber interface {
@@ -42,6 +47,12 @@ type Bot struct {
 	telegram             reference.Telegram
 	strategy             model.CompositesStrategy
 	paperWallet          *exchange.PaperWallet
+	walletTimeframe      string
+	walletCandles        map[string]model.Candle // [pair] 模拟盘钱包最后撮合的K线
+	clock                reference.Clock
+	monteCarlo           MonteCarloSetting
+	report               string
+	export               ExportSetting
 	serviceOrder         *service.ServiceOrder
 	serviceStrategy      *service.ServiceStrategy
 	priorityQueueCandles map[string]map[string]*model.PriorityQueue // [pair] [] queue
@@ -63,16 +74,33 @@ func NewBot(ctx context.Context, settings model.Settings, exch reference.Exchang
 		dataFeed:             exchange.NewDataFeed(exch),
 		callerSetting:        callerSetting,
 		priorityQueueCandles: map[string]map[string]*model.PriorityQueue{},
+		walletCandles:        map[string]model.Candle{},
 	}
 	// 加载用户配置
 	for _, option := range options {
 		option(bot)
 	}
 	callerSetting.Backtest = bot.backtest
+	// 未指定时钟时，回测由K线时间驱动，实盘使用系统时间
+	if bot.clock == nil {
+		if bot.backtest {
+			bot.clock = clock.NewCandle()
+		} else {
+			bot.clock = clock.Wall{}
+		}
+	}
+	if bot.paperWallet != nil {
+		exchange.WithPaperClock(bot.clock)(bot.paperWallet)
+	}
 	// 加载订单服务
 	bot.serviceOrder = service.NewServiceOrder(ctx, exch, bot.storage, bot.orderFeed)
+	// 模拟钱包资金费计入订单服务统计
+	if bot.paperWallet != nil {
+		bot.paperWallet.SubscribeFunding(bot.serviceOrder.OnFunding)
+		bot.paperWallet.SubscribeLiquidation(bot.serviceOrder.OnLiquidation)
+	}
 	// 加载caller
-	bot.caller = caller.NewCaller(ctx, strategy, bot.serviceOrder, bot.exchange, callerSetting)
+	bot.caller = caller.NewCaller(ctx, strategy, bot.serviceOrder, bot.exchange, bot.clock, callerSetting)
 	// 加载策略服务
 	bot.serviceStrategy = service.NewServiceStrategy(ctx, callerSetting.CheckMode, strategy, bot.caller, bot.backtest)
 	// 加载通知服务
@@ -111,6 +139,13 @@ func WithPaperWallet(wallet *exchange.PaperWallet) Option {
 	}
 }
 
+// WithClock 设置时钟，回测时可与存储共用同一K线时钟，使落库时间与回放时间一致
+func WithClock(clock reference.Clock) Option {
+	return func(bot *Bot) {
+		bot.clock = clock
+	}
+}
+
 // WithStorage sets the storage for the bot, by default it uses a local file called floolishman.db
 func WithStorage(storage storage.Storage) Option {
 	return func(bot *Bot) {
@@ -164,22 +199,27 @@ func (n *Bot) OrderService() *service.ServiceOrder {
 
 func (n *Bot) Summary() {
 	var (
-		total  float64
-		wins   int
-		loses  int
-		volume float64
-		sqn    float64
+		total   float64
+		wins    int
+		loses   int
+		volume  float64
+		funding float64
+		fees    float64
+		liq     int
+		sqn     float64
 	)
 
 	buffer := bytes.NewBuffer(nil)
 	table := tablewriter.NewWriter(buffer)
-	table.SetHeader([]string{"Pair", "Trades", "Win", "Loss", "% Win", "Payoff", "Pr Fact.", "SQN", "Profit", "Volume"})
+	table.SetHeader([]string{"Pair", "Trades", "Win", "Loss", "% Win", "Payoff", "Pr Fact.", "SQN", "Expect.", "Avg Hold", "Streak", "Profit", "Funding", "Fees", "Liq.", "Volume"})
 	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
 	avgPayoff := 0.0
 	avgProfitFactor := 0.0
 
 	returns := make([]float64, 0)
+	trades := make([]service.Result, 0)
 	for _, summary := range n.serviceOrder.Results {
+		winStreak, loseStreak := metrics.Streaks(tradeProfits(summary.Trades))
 		avgPayoff += summary.Payoff() * float64(len(summary.Win())+len(summary.Lose()))
 		avgProfitFactor += summary.ProfitFactor() * float64(len(summary.Win())+len(summary.Lose()))
 		table.Append([]string{
@@ -191,7 +231,13 @@ func (n *Bot) Summary() {
 			fmt.Sprintf("%.3f", summary.Payoff()),
 			fmt.Sprintf("%.3f", summary.ProfitFactor()),
 			fmt.Sprintf("%.1f", summary.SQN()),
+			fmt.Sprintf("%.2f", metrics.Expectancy(tradeProfits(summary.Trades))),
+			metrics.AverageHolding(tradeIntervals(summary.Trades)).Round(time.Minute).String(),
+			fmt.Sprintf("%d/%d", winStreak, loseStreak),
 			fmt.Sprintf("%.2f", summary.Profit()),
+			fmt.Sprintf("%.2f", summary.Funding),
+			fmt.Sprintf("%.2f", summary.Fees),
+			strconv.Itoa(summary.Liquidations),
 			fmt.Sprintf("%.2f", summary.Volume),
 		})
 		total += summary.Profit()
@@ -199,6 +245,10 @@ func (n *Bot) Summary() {
 		wins += len(summary.Win())
 		loses += len(summary.Lose())
 		volume += summary.Volume
+		funding += summary.Funding
+		fees += summary.Fees
+		liq += summary.Liquidations
+		trades = append(trades, summary.Trades...)
 
 		returns = append(returns, summary.WinPercent()...)
 		returns = append(returns, summary.LosePercent()...)
@@ -211,6 +261,10 @@ func (n *Bot) Summary() {
 	}
 	fmt.Println()
 
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].CreatedAt.Before(trades[j].CreatedAt)
+	})
+	totalWinStreak, totalLoseStreak := metrics.Streaks(tradeProfits(trades))
 	table.SetFooter([]string{
 		"TOTAL",
 		strconv.Itoa(wins + loses),
@@ -220,7 +274,13 @@ func (n *Bot) Summary() {
 		fmt.Sprintf("%.3f", avgPayoff/float64(wins+loses)),
 		fmt.Sprintf("%.3f", avgProfitFactor/float64(wins+loses)),
 		fmt.Sprintf("%.1f", sqn/float64(len(n.serviceOrder.Results))),
+		fmt.Sprintf("%.2f", metrics.Expectancy(tradeProfits(trades))),
+		metrics.AverageHolding(tradeIntervals(trades)).Round(time.Minute).String(),
+		fmt.Sprintf("%d/%d", totalWinStreak, totalLoseStreak),
 		fmt.Sprintf("%.2f", total),
+		fmt.Sprintf("%.2f", funding),
+		fmt.Sprintf("%.2f", fees),
+		strconv.Itoa(liq),
 		fmt.Sprintf("%.2f", volume),
 	})
 	table.Render()
@@ -255,10 +315,57 @@ func (n *Bot) Summary() {
 
 	fmt.Println()
 
+	n.monteCarloSummary()
+
+	if reporter, ok := n.caller.(reference.GridReporter); ok {
+		gridSummary(reporter.GridStats())
+	}
+
 	if n.paperWallet != nil {
 		n.paperWallet.Summary()
 	}
 
+	if n.report != "" {
+		if err := n.SaveReport(n.report); err != nil {
+			utils.Log.Error(err)
+		} else {
+			fmt.Printf("REPORT: %s\n", n.report)
+		}
+	}
+
+	if n.export.JSON != "" {
+		if err := n.SaveExport(n.export.JSON); err != nil {
+			utils.Log.Error(err)
+		} else {
+			fmt.Printf("EXPORT: %s\n", n.export.JSON)
+		}
+	}
+	if n.export.SQLite != "" {
+		if err := n.SaveExportSQLite(n.export.SQLite); err != nil {
+			utils.Log.Error(err)
+		} else {
+			fmt.Printf("EXPORT: %s\n", n.export.SQLite)
+		}
+	}
+
+}
+
+// tradeProfits 交易盈亏序列
+func tradeProfits(trades []service.Result) []float64 {
+	profits := make([]float64, 0, len(trades))
+	for _, trade := range trades {
+		profits = append(profits, trade.ProfitValue)
+	}
+	return profits
+}
+
+// tradeIntervals 交易持仓区间，CreatedAt 为平仓时间
+func tradeIntervals(trades []service.Result) []metrics.Interval {
+	intervals := make([]metrics.Interval, 0, len(trades))
+	for _, trade := range trades {
+		intervals = append(intervals, metrics.Interval{Start: trade.CreatedAt.Add(-trade.Duration), End: trade.CreatedAt})
+	}
+	return intervals
 }
 
 func (n *Bot) SaveReturns(outputDir string) error {
@@ -276,6 +383,19 @@ func (n *Bot) onCandle(timeframe string, candle model.Candle) {
 }
 
 func (n *Bot) processCandle(timeframe string, candle model.Candle) {
+	// 实时模拟盘，仅使用最小周期撮合模拟钱包挂单，与回测一致只撮合相邻两次推送之间的增量行情
+	if n.backtest == false && n.paperWallet != nil && timeframe == n.walletTimeframe {
+		n.mu.Lock()
+		slice := candleSlice(n.walletCandles[candle.Pair], candle)
+		n.walletCandles[candle.Pair] = candle
+		n.mu.Unlock()
+		n.paperWallet.OnCandle(slice)
+	}
+	n.strategyCandle(timeframe, candle)
+}
+
+// strategyCandle 收线K线交由 OnCandle，未收线K线交由 OnRealCandle
+func (n *Bot) strategyCandle(timeframe string, candle model.Candle) {
 	if candle.Complete {
 		n.serviceStrategy.OnCandle(timeframe, candle)
 	} else {
@@ -290,24 +410,126 @@ func (n *Bot) processCandles(pair string, timeframe string) {
 	}
 }
 
-func (n *Bot) backtestCandles(pair string, timeframe string) {
-	for n.priorityQueueCandles[pair][timeframe].Len() > 0 {
-		item := n.priorityQueueCandles[pair][timeframe].Pop()
+// timeframes 策略使用的周期，按周期长度升序
+func (n *Bot) timeframes() []string {
+	timeframes := make([]string, 0)
+	for timeframe := range n.strategy.TimeWarmupMap() {
+		timeframes = append(timeframes, timeframe)
+	}
+	sort.Slice(timeframes, func(i, j int) bool {
+		a, _ := str2duration.ParseDuration(timeframes[i])
+		b, _ := str2duration.ParseDuration(timeframes[j])
+		return a < b
+	})
+	return timeframes
+}
 
-		candle := item.(model.Candle)
+// gridSummary 输出各交易对网格成交分布、重建次数及价格处于网格边界外的时长
+func gridSummary(stats map[string]*model.GridStats) {
+	pairs := make([]string, 0, len(stats))
+	for pair := range stats {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	fmt.Println("------ GRID -------")
+	for _, pair := range pairs {
+		item := stats[pair]
+		levels := make([]int, 0, len(item.Fills))
+		for level := range item.Fills {
+			levels = append(levels, level)
+		}
+		sort.Ints(levels)
+		fills := make([]string, 0, len(levels))
+		for _, level := range levels {
+			fills = append(fills, fmt.Sprintf("%+d: %d", level, item.Fills[level]))
+		}
+		fmt.Printf("| %s |\n", pair)
+		fmt.Printf("FILLS:    [%s]\n", strings.Join(fills, ", "))
+		fmt.Printf("REBUILDS: %d\n", item.Rebuilds)
+		fmt.Printf("OUTSIDE:  %s\n", item.Outside.Round(time.Minute))
+	}
+	fmt.Println()
+}
+
+// backtestCandles 按时间顺序回放全部交易对各周期的K线
+// 各周期K线由同一原始K线重采样而来，UpdatedAt 为对应原始K线时间，同一时刻小周期优先，与实盘推送顺序一致
+// 所有交易对共用一个时钟，须在同一时间线上回放，时钟推进至当前K线时间后再交由钱包及策略处理
+// caller 实现 BacktestDriver 时，每个时刻全部K线处理完成后调用一次
+// 模拟钱包仅使用最小周期撮合，避免同一行情重复撮合
+// 逐笔回放时推送未收线K线，与实盘一致交由 OnRealCandle 处理，钱包仅撮合相邻两次推送之间的增量行情
+func (n *Bot) backtestCandles(pairs []string, timeframes []string) {
+	advancer, _ := n.clock.(interface{ Advance(time.Time) })
+	driver, _ := n.caller.(reference.BacktestDriver)
+	var current time.Time
+	walletCandles := make(map[string]model.Candle)
+	for {
+		var (
+			pair      string
+			timeframe string
+			candle    model.Candle
+		)
+		for _, item := range timeframes {
+			for _, itemPair := range pairs {
+				next := n.priorityQueueCandles[itemPair][item].Peek()
+				if next == nil {
+					continue
+				}
+				if timeframe == "" || next.(model.Candle).UpdatedAt.Before(candle.UpdatedAt) {
+					pair = itemPair
+					timeframe = item
+					candle = next.(model.Candle)
+				}
+			}
+		}
+		// 当前时刻所有交易对的K线均已处理，执行跨交易对决策
+		if driver != nil && !current.IsZero() && (timeframe == "" || candle.UpdatedAt.After(current)) {
+			driver.OnBacktestTick()
+		}
+		if timeframe == "" {
+			return
+		}
+		n.priorityQueueCandles[pair][timeframe].Pop()
+		current = candle.UpdatedAt
+
+		if advancer != nil {
+			advancer.Advance(candle.UpdatedAt)
+		}
 		// 监听蜡烛数据，更新exchange order
-		if n.paperWallet != nil {
-			n.paperWallet.OnCandle(candle)
+		if n.paperWallet != nil && timeframe == timeframes[0] {
+			n.paperWallet.OnCandle(candleSlice(walletCandles[pair], candle))
+			walletCandles[pair] = candle
 		}
 		// 监控订单数据变化
 		n.serviceOrder.ListenOrders()
 		// 处理开仓策略相关
-		n.serviceStrategy.OnCandle(timeframe, candle)
+		n.strategyCandle(timeframe, candle)
+	}
+}
+
+// candleSlice 同一周期相邻两次推送之间的增量K线，非同一周期时返回 candle
+// 区间内未突破此前高低点的极值无法还原，以区间开收盘价代替
+func candleSlice(prev, candle model.Candle) model.Candle {
+	if prev.Pair == "" || !prev.Time.Equal(candle.Time) {
+		return candle
+	}
+	slice := candle
+	slice.Open = prev.Close
+	slice.High = max(prev.Close, candle.Close)
+	if candle.High > prev.High {
+		slice.High = candle.High
 	}
+	slice.Low = min(prev.Close, candle.Close)
+	if candle.Low < prev.Low {
+		slice.Low = candle.Low
+	}
+	slice.Volume = candle.Volume - prev.Volume
+	return slice
 }
 
 // Before Ninjabot start, we need to load the necessary data to fill strategy indicators
 // Then, we need to get the time frame and warmup period to fetch the necessary candles
+// 预热K线为历史行情，仅用于计算指标，不参与模拟钱包撮合
 func (n *Bot) preload(ctx context.Context, pair string, timeframe string, period int) error {
 	candles, err := n.exchange.CandlesByLimit(ctx, pair, timeframe, period)
 	if err != nil {
@@ -315,7 +537,7 @@ func (n *Bot) preload(ctx context.Context, pair string, timeframe string, period
 	}
 
 	for _, candle := range candles {
-		n.processCandle(timeframe, candle)
+		n.strategyCandle(timeframe, candle)
 	}
 	n.dataFeed.Preload(pair, timeframe, candles)
 
@@ -417,20 +639,16 @@ func (n *Bot) Run(ctx context.Context) {
 	}
 
 	if n.backtest {
-		var wg sync.WaitGroup // 用于等待所有并发任务完成
+		pairs := make([]string, 0, len(n.settings.PairOptions))
 		for _, option := range n.settings.PairOptions {
-			timeframaMap := n.strategy.TimeWarmupMap()
-			for timeframe := range timeframaMap {
-				wg.Add(1) // 增加WaitGroup计数器
-				go func(option model.PairOption, timeframe string) {
-					defer wg.Done()
-					n.backtestCandles(option.Pair, timeframe)
-				}(option, timeframe)
-			}
+			pairs = append(pairs, option.Pair)
 		}
-		wg.Wait()
+		n.backtestCandles(pairs, n.timeframes())
 		n.Summary()
 	} else {
+		if timeframes := n.timeframes(); len(timeframes) > 0 {
+			n.walletTimeframe = timeframes[0]
+		}
 		for _, option := range n.settings.PairOptions {
 			timeframaMap := n.strategy.TimeWarmupMap()
 			for timeframe := range timeframaMap {
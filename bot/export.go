@@ -0,0 +1,342 @@
+package bot
+
+import (
+	"encoding/json"
+	"floolishman/model"
+	"floolishman/storage"
+	"floolishman/types"
+	"floolishman/utils/metrics"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// ExportSchemaVersion 导出文件结构版本，字段删除或含义变化时递增，新增字段不递增
+const ExportSchemaVersion = 1
+
+// ExportSetting 回测结果结构化导出配置
+type ExportSetting struct {
+	// JSON 导出的 JSON 文件，为空时不导出
+	JSON string
+	// SQLite 导出的 SQLite 数据库文件，为空时不导出
+	SQLite string
+	// Config 需要随结果保存的其他配置，如策略列表及回测参数，不应包含密钥
+	Config map[string]interface{}
+}
+
+// WithExport 回测结束后导出结构化的回测结果
+func WithExport(setting ExportSetting) Option {
+	return func(bot *Bot) {
+		bot.export = setting
+	}
+}
+
+// ExportConfig 回测使用的配置
+type ExportConfig struct {
+	Caller   types.CallerSetting    `json:"caller"`
+	Pairs    []model.PairOption     `json:"pairs"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// ExportPerformance 风险调整后的绩效指标，时长以秒为单位
+type ExportPerformance struct {
+	Sharpe              float64 `json:"sharpe"`
+	Sortino             float64 `json:"sortino"`
+	Calmar              float64 `json:"calmar"`
+	Ulcer               float64 `json:"ulcer"`
+	MaxDrawdown         float64 `json:"maxDrawdown"`
+	MaxDrawdownDuration float64 `json:"maxDrawdownDuration"`
+	Exposure            float64 `json:"exposure"`
+	Expectancy          float64 `json:"expectancy"`
+	AverageHolding      float64 `json:"averageHolding"`
+	EntryEfficiency     float64 `json:"entryEfficiency"`
+	ExitEfficiency      float64 `json:"exitEfficiency"`
+	TotalEfficiency     float64 `json:"totalEfficiency"`
+	WinStreak           int     `json:"winStreak"`
+	LoseStreak          int     `json:"loseStreak"`
+}
+
+// ExportPair 单个交易对的汇总
+type ExportPair struct {
+	Pair         string  `json:"pair" gorm:"primaryKey"`
+	Trades       int     `json:"trades"`
+	Win          int     `json:"win"`
+	Loss         int     `json:"loss"`
+	WinRate      float64 `json:"winRate"`
+	Payoff       float64 `json:"payoff"`
+	ProfitFactor float64 `json:"profitFactor"`
+	SQN          float64 `json:"sqn" gorm:"column:sqn"`
+	Expectancy   float64 `json:"expectancy"`
+	Profit       float64 `json:"profit"`
+	Funding      float64 `json:"funding"`
+	Fees         float64 `json:"fees"`
+	Liquidations int     `json:"liquidations"`
+	Volume       float64 `json:"volume"`
+}
+
+func (ExportPair) TableName() string {
+	return "pairs"
+}
+
+// StrategyStat 单个交易对下策略的胜负次数
+type StrategyStat struct {
+	Pair      string `json:"pair" gorm:"primaryKey"`
+	Name      string `json:"name" gorm:"primaryKey"`
+	WinLong   int    `json:"winLong"`
+	WinShort  int    `json:"winShort"`
+	LoseLong  int    `json:"loseLong"`
+	LoseShort int    `json:"loseShort"`
+}
+
+func (StrategyStat) TableName() string {
+	return "strategies"
+}
+
+// ExportEquity 账户权益曲线，同一根K线内多次平仓时存在时间相同的点，使用自增ID作为主键
+type ExportEquity struct {
+	ID    uint      `json:"-" gorm:"primaryKey;autoIncrement"`
+	Time  time.Time `json:"time" gorm:"index"`
+	Value float64   `json:"value"`
+}
+
+func (ExportEquity) TableName() string {
+	return "equity"
+}
+
+// exportMetadata SQLite 中的键值表，保存结构版本、配置及汇总指标
+type exportMetadata struct {
+	Key   string `gorm:"primaryKey"`
+	Value string
+}
+
+func (exportMetadata) TableName() string {
+	return "metadata"
+}
+
+// Export 回测结果的结构化导出，供外部分析程序读取
+type Export struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	Config        ExportConfig      `json:"config"`
+	Result        Result            `json:"result"`
+	Performance   ExportPerformance `json:"performance"`
+	Pairs         []ExportPair      `json:"pairs"`
+	Strategies    []StrategyStat    `json:"strategies"`
+	Orders        []*model.Order    `json:"orders"`
+	Positions     []*model.Position `json:"positions"`
+	Equity        []ExportEquity    `json:"equity"`
+}
+
+// finite JSON 不支持 NaN 及 Inf，无法计算的指标输出为 0
+func finite(value float64) float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0
+	}
+	return value
+}
+
+// pairStrategies 合并交易对下各策略的多空胜负次数，按策略名排序
+func pairStrategies(pair string, winLong, winShort, loseLong, loseShort map[string]int) []StrategyStat {
+	names := make(map[string]bool)
+	for _, counts := range []map[string]int{winLong, winShort, loseLong, loseShort} {
+		for name := range counts {
+			names[name] = true
+		}
+	}
+	strategies := make([]StrategyStat, 0, len(names))
+	for name := range names {
+		strategies = append(strategies, StrategyStat{
+			Pair:      pair,
+			Name:      name,
+			WinLong:   winLong[name],
+			WinShort:  winShort[name],
+			LoseLong:  loseLong[name],
+			LoseShort: loseShort[name],
+		})
+	}
+	sort.Slice(strategies, func(i, j int) bool {
+		return strategies[i].Name < strategies[j].Name
+	})
+	return strategies
+}
+
+// Export 汇总配置、订单、仓位、交易对统计、权益曲线及绩效指标
+func (n *Bot) Export() (Export, error) {
+	export := Export{
+		SchemaVersion: ExportSchemaVersion,
+		CreatedAt:     time.Now(),
+		Config: ExportConfig{
+			Caller:   n.callerSetting,
+			Pairs:    n.settings.PairOptions,
+			Settings: n.export.Config,
+		},
+		Result:     n.Result(),
+		Pairs:      []ExportPair{},
+		Strategies: []StrategyStat{},
+		Equity:     []ExportEquity{},
+	}
+	for _, point := range export.Result.Equity {
+		export.Equity = append(export.Equity, ExportEquity{Time: point.Time, Value: point.Value})
+	}
+	// 权益曲线单独导出，避免重复
+	export.Result.Equity = nil
+	export.Result.ProfitFactor = finite(export.Result.ProfitFactor)
+	export.Result.SQN = finite(export.Result.SQN)
+
+	if n.paperWallet != nil {
+		performance := n.paperWallet.Performance()
+		export.Performance = ExportPerformance{
+			Sharpe:              finite(performance.Sharpe),
+			Sortino:             finite(performance.Sortino),
+			Calmar:              finite(performance.Calmar),
+			Ulcer:               finite(performance.Ulcer),
+			MaxDrawdown:         finite(performance.MaxDrawdown),
+			MaxDrawdownDuration: performance.MaxDrawdownDuration.Seconds(),
+			Exposure:            finite(performance.Exposure),
+			Expectancy:          finite(performance.Expectancy),
+			AverageHolding:      performance.AverageHolding.Seconds(),
+			EntryEfficiency:     finite(performance.EntryEfficiency),
+			ExitEfficiency:      finite(performance.ExitEfficiency),
+			TotalEfficiency:     finite(performance.TotalEfficiency),
+			WinStreak:           performance.WinStreak,
+			LoseStreak:          performance.LoseStreak,
+		}
+	}
+
+	pairs := make([]string, 0, len(n.serviceOrder.Results))
+	for pair := range n.serviceOrder.Results {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		summary := n.serviceOrder.Results[pair]
+		item := ExportPair{
+			Pair:         pair,
+			Win:          len(summary.Win()),
+			Loss:         len(summary.Lose()),
+			WinRate:      summary.WinPercentage() / 100,
+			Payoff:       finite(summary.Payoff()),
+			ProfitFactor: finite(summary.ProfitFactor()),
+			Expectancy:   metrics.Expectancy(tradeProfits(summary.Trades)),
+			Profit:       summary.Profit(),
+			Funding:      summary.Funding,
+			Fees:         summary.Fees,
+			Liquidations: summary.Liquidations,
+			Volume:       summary.Volume,
+		}
+		item.Trades = item.Win + item.Loss
+		if item.Trades > 0 {
+			item.SQN = finite(summary.SQN())
+		}
+		export.Pairs = append(export.Pairs, item)
+		export.Strategies = append(export.Strategies, pairStrategies(pair, summary.WinLongStrateis,
+			summary.WinShortStrateis, summary.LoseLongStrateis, summary.LoseShortStrateis)...)
+	}
+
+	var err error
+	export.Orders, err = n.storage.Orders(storage.OrderFilterParams{})
+	if err != nil {
+		return export, err
+	}
+	sort.SliceStable(export.Orders, func(i, j int) bool {
+		return export.Orders[i].CreatedAt.Before(export.Orders[j].CreatedAt)
+	})
+	export.Positions, err = n.storage.Positions(storage.PositionFilterParams{Status: []int{0, 1, 10, 20}})
+	if err != nil {
+		return export, err
+	}
+	sort.SliceStable(export.Positions, func(i, j int) bool {
+		return export.Positions[i].CreatedAt.Before(export.Positions[j].CreatedAt)
+	})
+	return export, nil
+}
+
+// SaveExport 以JSON格式导出回测结果
+func (n *Bot) SaveExport(filename string) error {
+	export, err := n.Export()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, 0644)
+}
+
+// SaveExportSQLite 将回测结果导出到独立的 SQLite 数据库，已存在的文件会被覆盖
+// 表: metadata(schema_version/created_at/config/result/performance), orders, positions, pairs, strategies, equity
+func (n *Bot) SaveExportSQLite(filename string) error {
+	export, err := n.Export()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	db, err := gorm.Open(sqlite.Open(filename), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	metadata := []exportMetadata{
+		{Key: "schema_version", Value: fmt.Sprint(export.SchemaVersion)},
+		{Key: "created_at", Value: export.CreatedAt.Format(time.RFC3339)},
+	}
+	for _, item := range []struct {
+		key   string
+		value interface{}
+	}{
+		{"config", export.Config},
+		{"result", export.Result},
+		{"performance", export.Performance},
+	} {
+		content, err := json.Marshal(item.value)
+		if err != nil {
+			return err
+		}
+		metadata = append(metadata, exportMetadata{Key: item.key, Value: string(content)})
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&exportMetadata{}, &model.Order{}, &model.Position{},
+			&ExportPair{}, &StrategyStat{}, &ExportEquity{}); err != nil {
+			return err
+		}
+		tables := []struct {
+			rows  interface{}
+			count int
+		}{
+			{metadata, len(metadata)},
+			{export.Orders, len(export.Orders)},
+			{export.Positions, len(export.Positions)},
+			{export.Pairs, len(export.Pairs)},
+			{export.Strategies, len(export.Strategies)},
+			{export.Equity, len(export.Equity)},
+		}
+		for _, table := range tables {
+			if table.count == 0 {
+				continue
+			}
+			if err := tx.CreateInBatches(table.rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
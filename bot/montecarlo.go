@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"floolishman/utils/metrics"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// MonteCarloSetting 交易序列蒙特卡洛模拟配置
+type MonteCarloSetting struct {
+	// Simulations 模拟次数，为 0 时不模拟
+	Simulations int
+	// Ruin 权益亏损达到初始资金的该比例视为破产
+	Ruin float64
+	// Leverages 需要评估破产风险的杠杆倍数，为空时使用当前杠杆
+	Leverages []int
+	// Output 模拟结果 CSV 文件，为空时不输出
+	Output string
+	Seed   int64
+}
+
+// WithMonteCarlo 回测结束后对交易序列进行蒙特卡洛模拟
+func WithMonteCarlo(setting MonteCarloSetting) Option {
+	return func(bot *Bot) {
+		bot.monteCarlo = setting
+	}
+}
+
+type monteCarloRun struct {
+	leverage int
+	mode     string
+	result   metrics.MonteCarloResult
+}
+
+// monteCarloRuns 按杠杆分别打乱及重采样全部交易盈亏序列
+func (n *Bot) monteCarloRuns() []monteCarloRun {
+	if n.monteCarlo.Simulations <= 0 || n.paperWallet == nil {
+		return nil
+	}
+
+	values := make([]float64, 0)
+	for _, summary := range n.serviceOrder.Results {
+		values = append(values, summary.Win()...)
+		values = append(values, summary.Lose()...)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	leverages := n.monteCarlo.Leverages
+	if len(leverages) == 0 {
+		leverages = []int{n.callerSetting.Leverage}
+	}
+	runs := make([]monteCarloRun, 0, len(leverages)*2)
+	for _, leverage := range leverages {
+		// 交易盈亏按当前杠杆计算，其他杠杆按比例缩放
+		scale := 1.0
+		if n.callerSetting.Leverage > 0 {
+			scale = float64(leverage) / float64(n.callerSetting.Leverage)
+		}
+		for _, resample := range []bool{false, true} {
+			mode := "shuffle"
+			if resample {
+				mode = "resample"
+			}
+			runs = append(runs, monteCarloRun{
+				leverage: leverage,
+				mode:     mode,
+				result: metrics.MonteCarlo(values, metrics.MonteCarloSettings{
+					Simulations:  n.monteCarlo.Simulations,
+					InitialValue: n.paperWallet.InitialValue(),
+					Scale:        scale,
+					Ruin:         n.monteCarlo.Ruin,
+					Resample:     resample,
+					Seed:         n.monteCarlo.Seed,
+				}),
+			})
+		}
+	}
+	return runs
+}
+
+func (n *Bot) monteCarloSummary() {
+	runs := n.monteCarloRuns()
+	if len(runs) == 0 {
+		return
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.SetHeader([]string{"Leverage", "Mode", "Max DD 50%", "Max DD 95%", "Max DD 99%",
+		"Recover 50%", "Recover 95%", "Ruin", "Final 5%", "Final 50%", "Final 95%"})
+	for _, run := range runs {
+		table.Append([]string{
+			strconv.Itoa(run.leverage),
+			run.mode,
+			fmt.Sprintf("%.2f %%", run.result.MaxDrawdown(0.5)*100),
+			fmt.Sprintf("%.2f %%", run.result.MaxDrawdown(0.95)*100),
+			fmt.Sprintf("%.2f %%", run.result.MaxDrawdown(0.99)*100),
+			fmt.Sprintf("%.0f", run.result.Recovery(0.5)),
+			fmt.Sprintf("%.0f", run.result.Recovery(0.95)),
+			fmt.Sprintf("%.2f %%", run.result.RuinProbability()*100),
+			fmt.Sprintf("%.2f", run.result.FinalValue(0.05)),
+			fmt.Sprintf("%.2f", run.result.FinalValue(0.5)),
+			fmt.Sprintf("%.2f", run.result.FinalValue(0.95)),
+		})
+	}
+	table.Render()
+
+	fmt.Printf("------ MONTE CARLO (%d simulations, recover in trades) -------\n", n.monteCarlo.Simulations)
+	fmt.Println(buffer.String())
+
+	if n.monteCarlo.Output != "" {
+		if err := saveMonteCarlo(n.monteCarlo.Output, runs); err != nil {
+			fmt.Printf("save monte carlo error: %s\n", err.Error())
+		}
+	}
+}
+
+func saveMonteCarlo(output string, runs []monteCarloRun) error {
+	if err := os.MkdirAll(filepath.Dir(output), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"leverage", "mode", "simulation", "max_drawdown", "recover", "final_value", "ruined"}); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		for i, sample := range run.result.Samples {
+			if err := writer.Write([]string{
+				strconv.Itoa(run.leverage),
+				run.mode,
+				strconv.Itoa(i + 1),
+				strconv.FormatFloat(sample.MaxDrawdown, 'f', 6, 64),
+				strconv.Itoa(sample.Recovery),
+				strconv.FormatFloat(sample.FinalValue, 'f', 4, 64),
+				strconv.FormatBool(sample.Ruined),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
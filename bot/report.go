@@ -0,0 +1,196 @@
+package bot
+
+import (
+	_ "embed"
+	"encoding/json"
+	"floolishman/exchange"
+	"floolishman/service"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+//go:embed report.html
+var reportTemplate string
+
+// WithReport 回测结束后输出静态 HTML 报告
+func WithReport(filename string) Option {
+	return func(bot *Bot) {
+		bot.report = filename
+	}
+}
+
+type reportSeries struct {
+	Name   string                `json:"name"`
+	Points []exchange.AssetValue `json:"points"`
+}
+
+type reportMonth struct {
+	Month  int
+	Return float64
+	Valid  bool
+}
+
+type reportYear struct {
+	Year   int
+	Months [12]reportMonth
+	Total  float64
+}
+
+type reportData struct {
+	CreatedAt  time.Time
+	Result     Result
+	Charts     template.JS
+	Trades     []service.Result
+	Years      []reportYear
+	Strategies []StrategyStat
+}
+
+// drawdownSeries 根据权益曲线计算回撤曲线
+func drawdownSeries(equity []exchange.AssetValue) []exchange.AssetValue {
+	drawdown := make([]exchange.AssetValue, 0, len(equity))
+	peak := 0.0
+	for _, point := range equity {
+		if point.Value > peak {
+			peak = point.Value
+		}
+		value := 0.0
+		if peak > 0 {
+			value = -(peak - point.Value) / peak
+		}
+		drawdown = append(drawdown, exchange.AssetValue{Time: point.Time, Value: value})
+	}
+	return drawdown
+}
+
+// monthlyReturns 按月末权益计算月度收益
+func monthlyReturns(initial float64, equity []exchange.AssetValue) []reportYear {
+	years := make([]reportYear, 0)
+	if len(equity) == 0 || initial <= 0 {
+		return years
+	}
+
+	yearIndex := make(map[int]int)
+	previous := initial
+	yearStart := initial
+	for i, point := range equity {
+		// 仅处理每月最后一个点
+		if i+1 < len(equity) {
+			next := equity[i+1].Time
+			if next.Year() == point.Time.Year() && next.Month() == point.Time.Month() {
+				continue
+			}
+		}
+		year := point.Time.Year()
+		index, ok := yearIndex[year]
+		if !ok {
+			years = append(years, reportYear{Year: year})
+			index = len(years) - 1
+			yearIndex[year] = index
+			yearStart = previous
+		}
+		month := int(point.Time.Month())
+		years[index].Months[month-1] = reportMonth{
+			Month:  month,
+			Return: point.Value/previous - 1,
+			Valid:  true,
+		}
+		years[index].Total = point.Value/yearStart - 1
+		previous = point.Value
+	}
+	return years
+}
+
+// heatColor 收益热力图颜色，盈利为绿色，亏损为红色
+func heatColor(value float64) template.CSS {
+	alpha := value * 5
+	if alpha > 1 {
+		alpha = 1
+	}
+	if alpha < -1 {
+		alpha = -1
+	}
+	if alpha >= 0 {
+		return template.CSS(fmt.Sprintf("background-color: rgba(38, 166, 91, %.2f)", alpha))
+	}
+	return template.CSS(fmt.Sprintf("background-color: rgba(217, 30, 24, %.2f)", -alpha))
+}
+
+func (n *Bot) reportData() (reportData, error) {
+	data := reportData{
+		CreatedAt: time.Now(),
+		Result:    n.Result(),
+	}
+
+	charts := map[string][]reportSeries{
+		"equity":   {},
+		"drawdown": {},
+		"assets":   {},
+	}
+	pairs := make([]string, 0, len(n.serviceOrder.Results))
+	for pair := range n.serviceOrder.Results {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	if n.paperWallet != nil {
+		equity := n.paperWallet.EquityValues()
+		charts["equity"] = append(charts["equity"], reportSeries{Name: "Equity", Points: equity})
+		charts["drawdown"] = append(charts["drawdown"], reportSeries{Name: "Drawdown", Points: drawdownSeries(equity)})
+		for _, pair := range pairs {
+			charts["assets"] = append(charts["assets"], reportSeries{Name: pair, Points: n.paperWallet.AssetValues(pair)})
+		}
+		data.Years = monthlyReturns(n.paperWallet.InitialValue(), equity)
+	}
+	content, err := json.Marshal(charts)
+	if err != nil {
+		return data, err
+	}
+	data.Charts = template.JS(content)
+
+	for _, pair := range pairs {
+		summary := n.serviceOrder.Results[pair]
+		data.Trades = append(data.Trades, summary.Trades...)
+
+		data.Strategies = append(data.Strategies, pairStrategies(pair, summary.WinLongStrateis,
+			summary.WinShortStrateis, summary.LoseLongStrateis, summary.LoseShortStrateis)...)
+	}
+	sort.SliceStable(data.Trades, func(i, j int) bool {
+		return data.Trades[i].CreatedAt.Before(data.Trades[j].CreatedAt)
+	})
+	return data, nil
+}
+
+// SaveReport 输出单文件 HTML 回测报告，包含权益、回撤、交易对资产、交易明细、月度收益及策略胜负统计
+func (n *Bot) SaveReport(filename string) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"heat": heatColor,
+		"percent": func(value float64) string {
+			return fmt.Sprintf("%.2f%%", value*100)
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
+	}).Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	data, err := n.reportData()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tmpl.Execute(file, data)
+}
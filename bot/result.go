@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"encoding/json"
+	"floolishman/exchange"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Result 回测结果汇总，供参数优化等程序读取
+type Result struct {
+	Trades       int     `json:"trades"`
+	Win          int     `json:"win"`
+	Loss         int     `json:"loss"`
+	Profit       float64 `json:"profit"`
+	ProfitFactor float64 `json:"profitFactor"`
+	SQN          float64 `json:"sqn"`
+	Funding      float64 `json:"funding"`
+	Fees         float64 `json:"fees"`
+	Liquidations int     `json:"liquidations"`
+	Volume       float64 `json:"volume"`
+	InitialValue float64 `json:"initialValue"`
+	FinalValue   float64 `json:"finalValue"`
+	Return       float64 `json:"return"`
+	MaxDrawdown  float64 `json:"maxDrawdown"`
+	Sharpe       float64 `json:"sharpe"`
+	Sortino      float64 `json:"sortino"`
+	Calmar       float64 `json:"calmar"`
+	Ulcer        float64 `json:"ulcer"`
+	// Equity 每次成交后的账户权益，用于拼接分段回测的权益曲线
+	Equity []exchange.AssetValue `json:"equity,omitempty"`
+}
+
+// Result 汇总所有交易对的成交结果，盈亏因子及SQN按全部交易计算
+func (n *Bot) Result() Result {
+	var (
+		result    Result
+		values    []float64
+		winTotal  float64
+		lossTotal float64
+	)
+	for _, summary := range n.serviceOrder.Results {
+		result.Win += len(summary.Win())
+		result.Loss += len(summary.Lose())
+		result.Funding += summary.Funding
+		result.Fees += summary.Fees
+		result.Liquidations += summary.Liquidations
+		result.Volume += summary.Volume
+		for _, value := range summary.Win() {
+			winTotal += value
+		}
+		for _, value := range summary.Lose() {
+			lossTotal += value
+		}
+		values = append(values, summary.Win()...)
+		values = append(values, summary.Lose()...)
+	}
+	result.Trades = result.Win + result.Loss
+	result.Profit = winTotal + lossTotal
+	if lossTotal != 0 {
+		result.ProfitFactor = winTotal / math.Abs(lossTotal)
+	}
+	if result.Trades > 0 {
+		mean := result.Profit / float64(result.Trades)
+		stdDev := 0.0
+		for _, value := range values {
+			stdDev += math.Pow(value-mean, 2)
+		}
+		stdDev = math.Sqrt(stdDev / float64(result.Trades))
+		if stdDev > 0 {
+			result.SQN = math.Sqrt(float64(result.Trades)) * mean / stdDev
+		}
+	}
+
+	if n.paperWallet != nil {
+		result.InitialValue = n.paperWallet.InitialValue()
+		result.FinalValue = n.paperWallet.FinalValue()
+		if result.InitialValue > 0 {
+			result.Return = (result.FinalValue - result.InitialValue) / result.InitialValue
+		}
+		result.MaxDrawdown, _, _ = n.paperWallet.MaxDrawdown()
+		performance := n.paperWallet.Performance()
+		result.Sharpe = performance.Sharpe
+		result.Sortino = performance.Sortino
+		result.Calmar = performance.Calmar
+		result.Ulcer = performance.Ulcer
+		result.Equity = n.paperWallet.EquityValues()
+	}
+	return result
+}
+
+// SaveResult 将回测结果以JSON格式写入文件
+func (n *Bot) SaveResult(filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(n.Result(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, 0644)
+}
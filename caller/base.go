@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"github.com/jpillora/backoff"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 )
@@ -73,6 +74,7 @@ type Base struct {
 	setting               types.CallerSetting
 	broker                reference.Broker
 	exchange              reference.Exchange
+	clock                 reference.Clock
 	samples               map[string]map[string]map[string]*model.Dataframe
 	positionJudgers       map[string]*PositionJudger
 	pairOptions           map[string]*model.PairOption
@@ -81,6 +83,8 @@ type Base struct {
 	pairGridMapIndex      *model.ThreadSafeMap[string, int]
 	pairHedgeMode         *model.ThreadSafeMap[string, constants.PositionMode]
 	pairGirdStatus        *model.ThreadSafeMap[string, constants.GridStatus]
+	pairGridStats         *model.ThreadSafeMap[string, *model.GridStats]
+	pairGridOrders        *model.ThreadSafeMap[string, gridOrder]
 	pairProfitLevels      *model.ThreadSafeMap[string, []*model.StopProfitLevel]
 	pairCurrentProfit     *model.ThreadSafeMap[string, *model.PairProfit]
 	pairPrices            *model.ThreadSafeMap[string, float64]
@@ -100,10 +104,11 @@ func NewCaller(
 	strategy model.CompositesStrategy,
 	broker reference.Broker,
 	exchange reference.Exchange,
+	clock reference.Clock,
 	setting types.CallerSetting,
 ) reference.Caller {
 	realCaller := ConstCallers[setting.CheckMode]
-	realCaller.Init(ctx, strategy, broker, exchange, setting)
+	realCaller.Init(ctx, strategy, broker, exchange, clock, setting)
 	return realCaller
 }
 
@@ -112,12 +117,14 @@ func (c *Base) Init(
 	strategy model.CompositesStrategy,
 	broker reference.Broker,
 	exchange reference.Exchange,
+	clock reference.Clock,
 	setting types.CallerSetting,
 ) {
 	c.ctx = ctx
 	c.strategy = strategy
 	c.broker = broker
 	c.exchange = exchange
+	c.clock = clock
 	c.setting = setting
 	c.status = true
 	c.pairOptions = make(map[string]*model.PairOption)
@@ -135,6 +142,8 @@ func (c *Base) Init(
 	c.pairProfitLevels = model.NewThreadSafeMap[string, []*model.StopProfitLevel]()
 	c.pairHedgeMode = model.NewThreadSafeMap[string, constants.PositionMode]()
 	c.pairGirdStatus = model.NewThreadSafeMap[string, constants.GridStatus]()
+	c.pairGridStats = model.NewThreadSafeMap[string, *model.GridStats]()
+	c.pairGridOrders = model.NewThreadSafeMap[string, gridOrder]()
 	c.pairCurrentProfit = model.NewThreadSafeMap[string, *model.PairProfit]()
 
 	c.pairPrices = model.NewThreadSafeMap[string, float64]()
@@ -160,9 +169,10 @@ func (c *Base) Init(
 	if c.setting.Backtest == false {
 		go c.RegisterPairOption()
 		go c.RegisterPairPauser()
-	}
-	if c.setting.CheckMode == "grid" {
-		go c.RegisterPairGridBuilder()
+		// 回测时网格由 Grid.OnBacktestTick 同步生成
+		if c.setting.CheckMode == "grid" {
+			go c.RegisterPairGridBuilder()
+		}
 	}
 }
 
@@ -194,6 +204,7 @@ func (c *Base) SetPair(option model.PairOption) {
 	c.pairGridMapIndex.Set(option.Pair, -1)
 	c.pairHedgeMode.Set(option.Pair, constants.PositionModeNormal)
 	c.pairGirdStatus.Set(option.Pair, constants.GridStatusInside)
+	c.pairGridStats.Set(option.Pair, &model.GridStats{Fills: make(map[int]int)})
 	c.pairCurrentProfit.Set(option.Pair, &model.PairProfit{})
 	c.pairProfitLevels.Set(option.Pair, c.generateTriggerSequence(
 		option.ProfitableTrigger,
@@ -248,16 +259,42 @@ func (c *Base) RegisterPairPauser() {
 	for {
 		select {
 		case callerStatus := <-types.CallerPauserChan:
-			// 处理全局caller暂停
-			c.PauseCaller(callerStatus.Status)
-			// 处理pair暂停
-			for _, pairStatus := range callerStatus.PairStatuses {
-				c.PausePair(pairStatus, time.Duration(c.pairOptions[pairStatus.Pair].PauseCaller))
-			}
+			c.applyCallerStatus(callerStatus)
+		}
+	}
+}
+
+// drainPauser 回测时没有监听协程，由回放在每个时刻处理积压的暂停请求，避免通道写满阻塞
+func (c *Base) drainPauser() {
+	for {
+		select {
+		case callerStatus := <-types.CallerPauserChan:
+			c.applyCallerStatus(callerStatus)
+		default:
+			return
 		}
 	}
 }
 
+// sortedPairs 按名称排序的交易对，回测时按固定顺序处理以保证结果可复现
+func (c *Base) sortedPairs() []string {
+	pairs := make([]string, 0, len(c.pairOptions))
+	for pair := range c.pairOptions {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func (c *Base) applyCallerStatus(callerStatus types.CallerStatus) {
+	// 处理全局caller暂停
+	c.PauseCaller(callerStatus.Status)
+	// 处理pair暂停
+	for _, pairStatus := range callerStatus.PairStatuses {
+		c.PausePair(pairStatus, time.Duration(c.pairOptions[pairStatus.Pair].PauseCaller))
+	}
+}
+
 func (c *Base) PauseCaller(status bool) {
 	if status {
 		c.status = true
@@ -267,7 +304,7 @@ func (c *Base) PauseCaller(status bool) {
 		utils.Log.Infof("[CALLER - PAUSEED] Caller already paused ...")
 		return
 	}
-	postions, err := c.broker.GetPositionsForClosed(time.Now().Add(-60 * time.Minute))
+	postions, err := c.broker.GetPositionsForClosed(c.clock.Now().Add(-60 * time.Minute))
 	if err != nil {
 		utils.Log.Error(err)
 		return
@@ -291,20 +328,25 @@ func (c *Base) PauseCaller(status bool) {
 	nextBackOff := c.ba.Duration()
 	utils.Log.Infof(
 		"[CALLER - ALL PAUSE] Caller paused, will be resume in %v",
-		time.Now().Add(nextBackOff).In(Loc).Format("2006-01-02 15:04:05"),
+		c.clock.Now().Add(nextBackOff).In(Loc).Format("2006-01-02 15:04:05"),
 	)
 	// 暂停现有开仓功能
 	c.status = false
 	// 取消当前所有挂单
 	c.CloseOrder(false)
 	// 设置恢复状态的时间
-	time.AfterFunc(nextBackOff, func() {
+	c.clock.AfterFunc(nextBackOff, func() {
 		c.status = true
 	})
 }
 
 func (c *Base) PausePair(pairStatus types.PairStatus, minutes time.Duration) {
 	if pairStatus.Status == true {
+		// 回测时没有监听协程，直接恢复
+		if c.setting.Backtest {
+			c.pairOptions[pairStatus.Pair].Status = true
+			return
+		}
 		types.PairStatusChan <- pairStatus
 		return
 	}
@@ -317,7 +359,7 @@ func (c *Base) PausePair(pairStatus types.PairStatus, minutes time.Duration) {
 		minutes*time.Minute,
 	)
 	c.pairOptions[pairStatus.Pair].Status = false
-	time.AfterFunc(minutes*time.Minute, func() {
+	c.clock.AfterFunc(minutes*time.Minute, func() {
 		c.pairOptions[pairStatus.Pair].Status = true
 	})
 }
@@ -347,47 +389,52 @@ func (c *Base) ListenIndicator() {
 		select {
 		case <-time.After(CHeckPriceUndulateInterval * time.Millisecond):
 			for _, option := range c.pairOptions {
-				pairPrice, _ := c.pairPrices.Get(option.Pair)
-				pairVolume, _ := c.pairVolumes.Get(option.Pair)
-				pairOriginPrices, _ := c.pairOriginPrices.Get(option.Pair)
-				pairOriginVolumes, _ := c.pairOriginVolumes.Get(option.Pair)
-				// 记录循环价格数组
-				pairOriginPrices.Add(pairPrice)
-				pairOriginVolumes.Add(pairVolume)
-				// 重设数据
-				c.pairOriginPrices.Set(option.Pair, pairOriginPrices)
-				c.pairOriginVolumes.Set(option.Pair, pairOriginVolumes)
-				// 判断数据是否足够
-				if pairOriginPrices.Count() < ChangeRingCount || pairOriginVolumes.Count() < ChangeRingCount {
-					continue
-				}
-				// 本次量能小于上次量能，处理蜡烛收线时量能倍重置
-				if pairOriginVolumes.Last(0) < pairOriginVolumes.Last(1) {
-					pairOriginVolumes.Clear()
-					c.pairOriginVolumes.Set(option.Pair, pairOriginVolumes)
-					continue
-				}
-				// 计算量能异动诧异
-				currDiffVolume := pairOriginVolumes.Last(0) - pairOriginVolumes.Last(ChangeDiffInterval)
-				prevDiffVolume := pairOriginVolumes.Last(ChangeDiffInterval) - pairOriginVolumes.Last(2*ChangeDiffInterval)
-				// 计算价格差异
-				currDiffPrice := pairOriginPrices.Last(0) - pairOriginPrices.Last(ChangeDiffInterval)
-				// 处理价格变化率
-				c.pairPriceChangeRatio.Set(option.Pair, currDiffPrice/(option.UndulatePriceLimit*float64(ChangeDiffInterval)))
-				// 处理量能变化率
-				c.pairVolumeChangeRatio.Set(option.Pair, currDiffVolume/(option.UndulateVolumeLimit*float64(ChangeDiffInterval)))
-				// 判断当前量能差有没有达到最小限制
-				if currDiffVolume > (option.UndulateVolumeLimit * float64(ChangeDiffInterval)) {
-					// 处理量能每秒增长率
-					c.pairVolumeGrowRatio.Set(option.Pair, currDiffVolume/prevDiffVolume)
-				} else {
-					c.pairVolumeGrowRatio.Set(option.Pair, 0)
-				}
+				c.updateIndicator(option)
 			}
 		}
 	}
 }
 
+// updateIndicator 记录最新价格及量能，计算价格、量能变化率
+func (c *Base) updateIndicator(option *model.PairOption) {
+	pairPrice, _ := c.pairPrices.Get(option.Pair)
+	pairVolume, _ := c.pairVolumes.Get(option.Pair)
+	pairOriginPrices, _ := c.pairOriginPrices.Get(option.Pair)
+	pairOriginVolumes, _ := c.pairOriginVolumes.Get(option.Pair)
+	// 记录循环价格数组
+	pairOriginPrices.Add(pairPrice)
+	pairOriginVolumes.Add(pairVolume)
+	// 重设数据
+	c.pairOriginPrices.Set(option.Pair, pairOriginPrices)
+	c.pairOriginVolumes.Set(option.Pair, pairOriginVolumes)
+	// 判断数据是否足够
+	if pairOriginPrices.Count() < ChangeRingCount || pairOriginVolumes.Count() < ChangeRingCount {
+		return
+	}
+	// 本次量能小于上次量能，处理蜡烛收线时量能倍重置
+	if pairOriginVolumes.Last(0) < pairOriginVolumes.Last(1) {
+		pairOriginVolumes.Clear()
+		c.pairOriginVolumes.Set(option.Pair, pairOriginVolumes)
+		return
+	}
+	// 计算量能异动诧异
+	currDiffVolume := pairOriginVolumes.Last(0) - pairOriginVolumes.Last(ChangeDiffInterval)
+	prevDiffVolume := pairOriginVolumes.Last(ChangeDiffInterval) - pairOriginVolumes.Last(2*ChangeDiffInterval)
+	// 计算价格差异
+	currDiffPrice := pairOriginPrices.Last(0) - pairOriginPrices.Last(ChangeDiffInterval)
+	// 处理价格变化率
+	c.pairPriceChangeRatio.Set(option.Pair, currDiffPrice/(option.UndulatePriceLimit*float64(ChangeDiffInterval)))
+	// 处理量能变化率
+	c.pairVolumeChangeRatio.Set(option.Pair, currDiffVolume/(option.UndulateVolumeLimit*float64(ChangeDiffInterval)))
+	// 判断当前量能差有没有达到最小限制
+	if currDiffVolume > (option.UndulateVolumeLimit * float64(ChangeDiffInterval)) {
+		// 处理量能每秒增长率
+		c.pairVolumeGrowRatio.Set(option.Pair, currDiffVolume/prevDiffVolume)
+	} else {
+		c.pairVolumeGrowRatio.Set(option.Pair, 0)
+	}
+}
+
 func (c *Base) CheckHasUnfilledPositionOrders(pair string, side model.SideType, positionSide model.PositionSideType) (bool, error) {
 	// 判断当前是否已有同向挂单未成交，有则不在开单
 	existUnfilledOrderMap, err := c.broker.GetOrdersForPairUnfilled(pair)
@@ -440,10 +487,7 @@ func (c *Base) CloseOrder(checkTimeout bool) {
 			// 检查时间超时
 			if checkTimeout {
 				// 获取当前时间使用
-				currentTime := time.Now()
-				if c.setting.CheckMode == "candle" {
-					currentTime, _ = c.lastUpdate.Get(positionOrder.Pair)
-				}
+				currentTime := c.clock.Now()
 				// 获取挂单时间是否超长
 				cancelLimitTime := positionOrder.UpdatedAt.Add(CancelLimitDuration * time.Second)
 				// 判断当前时间是否在cancelLimitTime之前,在取消时间之前则不取消,防止挂单后被立马取消
@@ -540,8 +584,8 @@ func (c *Base) gridBuilder(pair string, timeframe string, isForce bool) {
 		utils.Log.Infof("[GRID: %s] Build - Living data has no exsit, wating...", pair)
 		return
 	}
-	dataframe := c.samples[pair][timeframe]["Grid1h"]
-	if len(dataframe.Close) == 0 {
+	dataframe, ok := c.samples[pair][timeframe]["Grid1h"]
+	if !ok || len(dataframe.Close) == 0 {
 		return
 	}
 	var dataIndex int
@@ -723,11 +767,26 @@ func (c *Base) gridBuilder(pair string, timeframe string, isForce bool) {
 		pairTubeOpen,
 	)
 	// 网格被重新生成时取消所有挂单
-	go c.CloseOrder(false)
+	c.cancelOrders()
+	// 记录网格重建次数
+	if gridExsit && len(currentGrid.GridItems) > 0 {
+		if stats, ok := c.pairGridStats.Get(pair); ok {
+			stats.Rebuilds++
+		}
+	}
 	// 将网格添加到网格映射中
 	c.pairGridMap.Set(pair, &grid)
 }
 
+// cancelOrders 取消所有挂单，回测时同步执行以保证回放结果可复现
+func (c *Base) cancelOrders() {
+	if c.setting.Backtest {
+		c.CloseOrder(false)
+		return
+	}
+	go c.CloseOrder(false)
+}
+
 func (c *Base) ResetGrid(pair string) {
 	currentGrid, gridExsit := c.pairGridMap.Get(pair)
 	if !gridExsit {
@@ -79,10 +79,7 @@ func (c *Candle) closePosition(option *model.PairOption) {
 	}
 
 	currentPrice, _ := c.pairPrices.Get(option.Pair)
-	currentTime := time.Now()
-	if c.setting.CheckMode == "candle" {
-		currentTime, _ = c.lastUpdate.Get(option.Pair)
-	}
+	currentTime := c.clock.Now()
 	var stopLossPrice float64
 	// 与当前方向相反有仓位,计算相对分界线距离，多空比达到反手标准平仓
 	// ***********************
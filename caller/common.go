@@ -62,7 +62,7 @@ func (c *Common) ResetJudger(pair string) {
 		Matchers:      []model.PositionStrategy{},
 		TendencyCount: make(map[string]int),
 		Count:         0,
-		CreatedAt:     time.Now(),
+		CreatedAt:     c.clock.Now(),
 	}
 }
 
@@ -285,10 +285,7 @@ func (c *Common) closePosition(option *model.PairOption) {
 	}
 
 	currentPrice, _ := c.pairPrices.Get(option.Pair)
-	currentTime := time.Now()
-	if c.setting.CheckMode == "candle" {
-		currentTime, _ = c.lastUpdate.Get(option.Pair)
-	}
+	currentTime := c.clock.Now()
 	// 与当前方向相反有仓位,计算相对分界线距离，多空比达到反手标准平仓
 	// ***********************
 	for _, openedPosition := range openedPositions {
@@ -19,20 +19,31 @@ var (
 
 type Grid struct {
 	Common
+	lastTick time.Time
+	// 上次采样价格及量能的时间，逐笔回放时与实盘一样按 CHeckPriceUndulateInterval 采样
+	lastIndicator time.Time
+	// 上次检查超时挂单的时间，与实盘 Listen 一样按 CheckTimeoutInterval 检查
+	lastTimeoutCheck time.Time
+}
+
+// gridOrder 等待成交的网格开仓挂单
+type gridOrder struct {
+	ID    int64
+	Level int
 }
 
 func (c *Grid) Start() {
+	// 回测时由 OnBacktestTick 同步驱动
+	if c.setting.Backtest {
+		return
+	}
 	go func() {
 		tickerCheck := time.NewTicker(CheckStrategyInterval * time.Millisecond)
 		for {
 			select {
 			case <-tickerCheck.C:
-				currentHour := time.Now().Hour()
 				for _, option := range c.pairOptions {
-					if option.Status == false {
-						continue
-					}
-					if strutil.IsInArray(option.IgnoreHours, currentHour) {
+					if c.gridOpenable(option) == false {
 						continue
 					}
 					go c.openGridPosition(option)
@@ -55,6 +66,110 @@ func (c *Grid) Start() {
 	go c.ListenIndicator()
 }
 
+// OnBacktestTick 回测时所有交易对同一时刻的K线处理完成后执行，依次完成超时挂单撤销、指标更新、平仓、网格重建及开仓
+// 交易对按名称顺序处理
+func (c *Grid) OnBacktestTick() {
+	c.drainPauser()
+	now := c.clock.Now()
+	sampling := now.Sub(c.lastIndicator) >= CHeckPriceUndulateInterval*time.Millisecond
+	if sampling {
+		c.lastIndicator = now
+	}
+	// 取消超时未成交的开仓挂单，否则该交易对在网格重建前无法继续开仓
+	if now.Sub(c.lastTimeoutCheck) >= CheckTimeoutInterval*time.Millisecond {
+		c.lastTimeoutCheck = now
+		c.CloseOrder(true)
+	}
+	for _, pair := range c.sortedPairs() {
+		option := c.pairOptions[pair]
+		if sampling {
+			c.updateIndicator(option)
+		}
+		c.updateGridStats(option, now)
+		c.closeGridPosition(option)
+		c.drainPauser()
+		if c.gridOpenable(option) {
+			c.openGridPosition(option)
+		}
+		c.drainPauser()
+	}
+	c.lastTick = now
+}
+
+func (c *Grid) EventCallOpen(pair string) {
+	// 回测时由 OnBacktestTick 统一开仓
+	if c.setting.Backtest {
+		return
+	}
+	if c.gridOpenable(c.pairOptions[pair]) {
+		go c.openGridPosition(c.pairOptions[pair])
+	}
+}
+
+func (c *Grid) EventCallClose(pair string) {
+	// 回测时由 OnBacktestTick 统一平仓
+	if c.setting.Backtest {
+		return
+	}
+	c.closeGridPosition(c.pairOptions[pair])
+}
+
+// GridStats 各交易对网格统计，成交次数仅在回测时记录
+func (c *Grid) GridStats() map[string]*model.GridStats {
+	stats := make(map[string]*model.GridStats)
+	for pair := range c.pairOptions {
+		if item, ok := c.pairGridStats.Get(pair); ok {
+			stats[pair] = item
+		}
+	}
+	return stats
+}
+
+// gridOpenable 交易对开启且不在忽略时段内时允许网格开仓
+func (c *Grid) gridOpenable(option *model.PairOption) bool {
+	if option.Status == false {
+		return false
+	}
+	return strutil.IsInArray(option.IgnoreHours, c.clock.Now().Local().Hour()) == false
+}
+
+// gridLevel 网格距基准线的格数，负数为多单网格，正数为空单网格
+func (c *Grid) gridLevel(grid *model.PositionGrid, index int) int {
+	if grid.GridItems[index].PositionSide == model.PositionSideTypeLong {
+		return index - int(grid.CountLong)
+	}
+	return index - int(grid.CountLong) + 1
+}
+
+// updateGridStats 统计网格挂单成交次数及价格处于网格边界外的时长
+func (c *Grid) updateGridStats(option *model.PairOption, now time.Time) {
+	stats, ok := c.pairGridStats.Get(option.Pair)
+	if !ok {
+		return
+	}
+	if pending, ok := c.pairGridOrders.Get(option.Pair); ok {
+		order, err := c.broker.Order(option.Pair, pending.ID)
+		switch {
+		case err != nil:
+			c.pairGridOrders.Delete(option.Pair)
+		case order.Status == model.OrderStatusTypeFilled:
+			stats.Fills[pending.Level]++
+			c.pairGridOrders.Delete(option.Pair)
+		case order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled:
+			// 挂单已取消
+			c.pairGridOrders.Delete(option.Pair)
+		}
+	}
+	pairGrid, ok := c.pairGridMap.Get(option.Pair)
+	if !ok || len(pairGrid.GridItems) == 0 || c.lastTick.IsZero() {
+		return
+	}
+	currentPrice, _ := c.pairPrices.Get(option.Pair)
+	if currentPrice > pairGrid.BoundaryUpper || currentPrice < pairGrid.BoundaryLower {
+		stats.Outside += now.Sub(c.lastTick)
+	}
+}
+
 func (c *Grid) Listen() {
 	for {
 		select {
@@ -280,7 +395,7 @@ func (c *Grid) openGridPosition(option *model.PairOption) {
 			// 暂停该交易对新的仓位请求
 			types.CallerPauserChan <- callerStatus
 			// 取消所有挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			// 日志
 			utils.Log.Infof(
 				"[POSITION PAUSE] Pair: %s | Side: %v, PositionSide: %s | Quantity: %v, Price: %v | Current: %v , %.2f%% (Change) | Volume: %.2f%% (Change), %.2f%% (Grow)",
@@ -313,7 +428,7 @@ func (c *Grid) openGridPosition(option *model.PairOption) {
 			// 暂停该交易对新的仓位请求
 			types.CallerPauserChan <- callerStatus
 			// 取消所有挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		// 判断开仓时，保证后方有足够的加仓次数才开仓否则，可能会只加一次仓后突破仓位限制导致平仓
@@ -359,11 +474,15 @@ func (c *Grid) openGridPosition(option *model.PairOption) {
 		pairVolumeGrowRatio*100,
 	)
 	// 根据最新价格创建限价单
-	_, err = c.broker.CreateOrderLimit(openPositionGrid.Side, openPositionGrid.PositionSide, option.Pair, amount, openPositionGrid.Price, orderExtra)
+	order, err := c.broker.CreateOrderLimit(openPositionGrid.Side, openPositionGrid.PositionSide, option.Pair, amount, openPositionGrid.Price, orderExtra)
 	if err != nil {
 		utils.Log.Error(err)
 		return
 	}
+	// 回测时记录挂单所在网格，成交后计入统计
+	if c.setting.Backtest {
+		c.pairGridOrders.Set(option.Pair, gridOrder{ID: order.ExchangeID, Level: c.gridLevel(pairGrid, openIndex)})
+	}
 	// 处理网格锁定状态及当前网格索引
 	pairGrid.GridItems[openIndex].Lock = true
 	// 修改map
@@ -384,6 +503,11 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 	}
 	// 当前没有仓位 重新生成网格
 	if len(openedPositions) == 0 {
+		// 回测时数据均为已收线K线，同步以最新K线生成
+		if c.setting.Backtest {
+			c.gridBuilder(option.Pair, "1h", false)
+			return
+		}
 		types.PairGridBuilderParamChan <- types.PairGridBuilderParam{
 			Pair:      option.Pair,
 			Timeframe: "1h",
@@ -468,7 +592,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 			// 暂停交易
 			types.CallerPauserChan <- callerStatus
 			// 取消所有挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		pairCurrentProfit, _ := c.pairCurrentProfit.Get(option.Pair)
@@ -502,7 +626,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 				c.ResetGrid(option.Pair)
 			}
 			// 取消挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		profitTriggerRatio := pairCurrentProfit.Floor
@@ -513,7 +637,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 				profitTriggerRatio = pairCurrentProfit.Decrease
 			}
 			// 计算持仓时间周期倍数，获取盈利触发百分比
-			holdPeriod := int(time.Now().Sub(mainPosition.UpdatedAt).Minutes() / float64(option.HoldPositionPeriod))
+			holdPeriod := int(c.clock.Now().Sub(mainPosition.UpdatedAt).Minutes() / float64(option.HoldPositionPeriod))
 			if pairCurrentProfit.Close == 0 && holdPeriod >= 1 {
 				profitTriggerRatio = profitTriggerRatio - option.HoldPositionPeriodDecrStep*float64(holdPeriod)
 				if profitTriggerRatio <= option.HoldPositionPeriodDecrStep {
@@ -662,7 +786,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 			// 暂停交易
 			types.CallerPauserChan <- callerStatus
 			// 取消挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		// 判断是否是平仓模式
@@ -705,7 +829,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 			// 暂停交易
 			types.CallerPauserChan <- callerStatus
 			// 取消所有挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		// ********** 对冲开启 **********
@@ -735,7 +859,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 				// 暂停交易
 				types.CallerPauserChan <- callerStatus
 				// 取消挂单
-				go c.CloseOrder(false)
+				c.cancelOrders()
 			} else {
 				utils.Log.Infof(
 					"[POSITION - HOLD] Pair: %s | Main OrderFlag: %s, Quantity: %v, Price: %v, Time: %s | Sub OrderFlag: %s, Quantity: %v, Price: %v, Time: %s | Current: %v | PR.%%: %s < LossRatio: %s",
@@ -776,7 +900,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 			// 暂停交易
 			types.CallerPauserChan <- callerStatus
 			// 取消挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		// 仓位亏损比例过大取消对冲直接平仓
@@ -801,7 +925,7 @@ func (c *Grid) closeGridPosition(option *model.PairOption) {
 			// 暂停交易
 			types.CallerPauserChan <- callerStatus
 			// 取消挂单
-			go c.CloseOrder(false)
+			c.cancelOrders()
 			return
 		}
 		morePosition = subPosition
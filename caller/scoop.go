@@ -25,9 +25,9 @@ type ScoopCheckItem struct {
 }
 
 func (c *Scoop) Start() {
-	now := time.Now()
+	now := c.clock.Now()
 	next := now.Truncate(time.Minute * ExecStart).Add(time.Minute * ExecStart)
-	duration := time.Until(next)
+	duration := next.Sub(now)
 	// 在下一个n分钟倍数时执行任务
 	if c.setting.Backtest == false {
 		time.AfterFunc(duration, func() {
@@ -52,121 +52,148 @@ func (c *Scoop) tickCheckForOpen() {
 	for {
 		select {
 		case <-ticker.C:
-			if c.status == false {
-				continue
-			}
-			// 判断总仓位数量
-			totalOpenedPositions, err := c.broker.GetPositionsForOpened()
-			if err != nil {
-				utils.Log.Error(err)
-				continue
-			}
-			if len(totalOpenedPositions) >= MaxPairPositions {
-				utils.Log.Infof("[POSITION - MAX PAIR] Pair position reach to max, waiting...")
-				continue
-			}
-			unfilledOrderCount := 0
-			totalUnfilledOrders, err := c.broker.GetOrdersForUnfilled()
-			if err != nil {
-				utils.Log.Error(err)
-				continue
-			}
-			for _, existOrders := range totalUnfilledOrders {
-				_, ok := existOrders["position"]
-				if !ok {
-					continue
-				}
-				unfilledOrderCount += 1
-			}
-			if len(totalOpenedPositions)+unfilledOrderCount >= MaxPairPositions {
-				utils.Log.Infof("[POSITION - MAX PAIR] Pair position (%v) or order (%v) reach to max, waiting...", len(totalOpenedPositions), unfilledOrderCount)
-				continue
-			}
-			mapOpenedPosition := map[string][]string{
-				string(model.PositionSideTypeLong):  {},
-				string(model.PositionSideTypeShort): {},
-			}
-			if len(totalOpenedPositions) > 0 {
-				for _, openedPosition := range totalOpenedPositions {
-					mapOpenedPosition[openedPosition.PositionSide] = append(mapOpenedPosition[openedPosition.PositionSide], openedPosition.Pair)
-				}
-			}
+			c.checkForOpen()
+		}
+	}
+}
 
-			// 检查所有币种,获取可以开仓的币种
-			var tempMatcherScore float64
-			openAliablePairs := []ScoopCheckItem{}
-			scoopCheckSlice := []ScoopCheckItem{}
-			currentHour := time.Now().Hour()
-			currentWeek := time.Now().Weekday()
-			for _, option := range c.pairOptions {
-				if option.Status == false {
-					continue
-				}
-				// 如果今天不是周六或周日，且当前时间在 IgnoreHours 中，则跳过
-				if currentWeek != time.Saturday && currentWeek != time.Sunday {
-					if strutil.IsInArray(option.IgnoreHours, currentHour) {
-						continue
-					}
-				}
-				tempMatcherScore = 0
-				longShortRatio, currentMatchers := c.checkScoopPosition(option)
-				if longShortRatio < 0 {
-					continue
-				}
-				for _, matcher := range currentMatchers {
-					tempMatcherScore += matcher.Score
-				}
-				scoopCheckSlice = append(scoopCheckSlice, ScoopCheckItem{
-					PairOption:     option,
-					Score:          tempMatcherScore,
-					LongShortRatio: longShortRatio,
-					Matchers:       currentMatchers,
-				})
-			}
-			if len(scoopCheckSlice) == 0 {
-				utils.Log.Infof("[POSITION - SCOOP NONE] No trading pair was selected, waiting...")
+// OnBacktestTick 回测时所有交易对同一时刻的K线处理完成后执行，与实盘定时检查使用相同的排序开仓逻辑
+func (c *Scoop) OnBacktestTick() {
+	c.drainPauser()
+	c.checkForOpen()
+	c.drainPauser()
+}
+
+// checkForOpen 检查所有交易对，按评分排序后在仓位上限内开仓
+func (c *Scoop) checkForOpen() {
+	if c.status == false {
+		return
+	}
+	// 判断总仓位数量
+	totalOpenedPositions, err := c.broker.GetPositionsForOpened()
+	if err != nil {
+		utils.Log.Error(err)
+		return
+	}
+	if len(totalOpenedPositions) >= MaxPairPositions {
+		if c.setting.Backtest == false {
+			utils.Log.Infof("[POSITION - MAX PAIR] Pair position reach to max, waiting...")
+		}
+		return
+	}
+	unfilledOrderCount := 0
+	totalUnfilledOrders, err := c.broker.GetOrdersForUnfilled()
+	if err != nil {
+		utils.Log.Error(err)
+		return
+	}
+	for _, existOrders := range totalUnfilledOrders {
+		_, ok := existOrders["position"]
+		if !ok {
+			continue
+		}
+		unfilledOrderCount += 1
+	}
+	if len(totalOpenedPositions)+unfilledOrderCount >= MaxPairPositions {
+		if c.setting.Backtest == false {
+			utils.Log.Infof("[POSITION - MAX PAIR] Pair position (%v) or order (%v) reach to max, waiting...", len(totalOpenedPositions), unfilledOrderCount)
+		}
+		return
+	}
+	mapOpenedPosition := map[string][]string{
+		string(model.PositionSideTypeLong):  {},
+		string(model.PositionSideTypeShort): {},
+	}
+	if len(totalOpenedPositions) > 0 {
+		for _, openedPosition := range totalOpenedPositions {
+			mapOpenedPosition[openedPosition.PositionSide] = append(mapOpenedPosition[openedPosition.PositionSide], openedPosition.Pair)
+		}
+	}
+
+	// 检查所有币种,获取可以开仓的币种
+	var tempMatcherScore float64
+	openAliablePairs := []ScoopCheckItem{}
+	scoopCheckSlice := []ScoopCheckItem{}
+	// 按本地时区判断忽略时段，回测时钟为K线的UTC时间
+	now := c.clock.Now().Local()
+	currentHour := now.Hour()
+	currentWeek := now.Weekday()
+	for _, pair := range c.sortedPairs() {
+		option := c.pairOptions[pair]
+		if option.Status == false {
+			continue
+		}
+		// 如果今天不是周六或周日，且当前时间在 IgnoreHours 中，则跳过
+		if currentWeek != time.Saturday && currentWeek != time.Sunday {
+			if strutil.IsInArray(option.IgnoreHours, currentHour) {
 				continue
 			}
-			utils.Log.Infof("[POSITION SCOOP TICK] Check for all pair to open position ...")
-			// 根据评分排序，倒叙排列
-			sort.Slice(scoopCheckSlice, func(i, j int) bool {
-				return scoopCheckSlice[i].Score > scoopCheckSlice[j].Score
-			})
-			openAliableCount := MaxPairPositions - len(totalOpenedPositions)
-			// 判断当前获取的币种是否大于可开的仓位，大于：截断，小于等于时直接使用
-			if len(scoopCheckSlice) > openAliableCount {
-				openAliablePairs = scoopCheckSlice[:openAliableCount]
-			} else {
-				openAliablePairs = scoopCheckSlice
-			}
-			// 本次同向单只开一个
-			var positionSide model.PositionSideType
-			opendPositionSide := map[model.PositionSideType]float64{}
-			for _, openItem := range openAliablePairs {
-				if openItem.LongShortRatio > 0.5 {
-					positionSide = model.PositionSideTypeLong
-				} else {
-					positionSide = model.PositionSideTypeShort
-				}
-				// 判断当前开单方向是否已达到当前仓位方向最多
-				// 已有同向仓位已达到总仓位的一半以上，则不在开仓
-				if float64(len(mapOpenedPosition[string(positionSide)])) >= float64(MaxPairPositions/2) {
-					continue
-				}
-				// 当前开单币种暂停防止在同一根蜡烛线内再次开单
-				if _, ok := opendPositionSide[positionSide]; ok {
-					types.CallerPauserChan <- types.CallerStatus{
-						Status: true,
-						PairStatuses: []types.PairStatus{
-							{Pair: openItem.PairOption.Pair, Status: false},
-						},
-					}
-					continue
-				}
-				opendPositionSide[positionSide] = openItem.LongShortRatio
-				// 执行
-				go c.openScoopPosition(openItem.PairOption, openItem.LongShortRatio, openItem.Matchers)
+		}
+		tempMatcherScore = 0
+		longShortRatio, currentMatchers := c.checkScoopPosition(option)
+		if longShortRatio < 0 {
+			continue
+		}
+		for _, matcher := range currentMatchers {
+			tempMatcherScore += matcher.Score
+		}
+		scoopCheckSlice = append(scoopCheckSlice, ScoopCheckItem{
+			PairOption:     option,
+			Score:          tempMatcherScore,
+			LongShortRatio: longShortRatio,
+			Matchers:       currentMatchers,
+		})
+	}
+	if len(scoopCheckSlice) == 0 {
+		if c.setting.Backtest == false {
+			utils.Log.Infof("[POSITION - SCOOP NONE] No trading pair was selected, waiting...")
+		}
+		return
+	}
+	if c.setting.Backtest == false {
+		utils.Log.Infof("[POSITION SCOOP TICK] Check for all pair to open position ...")
+	}
+	// 根据评分排序，倒叙排列，评分相同时保持交易对名称顺序
+	sort.SliceStable(scoopCheckSlice, func(i, j int) bool {
+		return scoopCheckSlice[i].Score > scoopCheckSlice[j].Score
+	})
+	openAliableCount := MaxPairPositions - len(totalOpenedPositions)
+	// 判断当前获取的币种是否大于可开的仓位，大于：截断，小于等于时直接使用
+	if len(scoopCheckSlice) > openAliableCount {
+		openAliablePairs = scoopCheckSlice[:openAliableCount]
+	} else {
+		openAliablePairs = scoopCheckSlice
+	}
+	// 本次同向单只开一个
+	var positionSide model.PositionSideType
+	opendPositionSide := map[model.PositionSideType]float64{}
+	for _, openItem := range openAliablePairs {
+		if openItem.LongShortRatio > 0.5 {
+			positionSide = model.PositionSideTypeLong
+		} else {
+			positionSide = model.PositionSideTypeShort
+		}
+		// 判断当前开单方向是否已达到当前仓位方向最多
+		// 已有同向仓位已达到总仓位的一半以上，则不在开仓
+		if float64(len(mapOpenedPosition[string(positionSide)])) >= float64(MaxPairPositions/2) {
+			continue
+		}
+		// 当前开单币种暂停防止在同一根蜡烛线内再次开单
+		if _, ok := opendPositionSide[positionSide]; ok {
+			types.CallerPauserChan <- types.CallerStatus{
+				Status: true,
+				PairStatuses: []types.PairStatus{
+					{Pair: openItem.PairOption.Pair, Status: false},
+				},
 			}
+			continue
+		}
+		opendPositionSide[positionSide] = openItem.LongShortRatio
+		// 执行，回测时同步开仓保证结果可复现
+		if c.setting.Backtest {
+			c.openScoopPosition(openItem.PairOption, openItem.LongShortRatio, openItem.Matchers)
+		} else {
+			go c.openScoopPosition(openItem.PairOption, openItem.LongShortRatio, openItem.Matchers)
 		}
 	}
 }
@@ -184,6 +211,10 @@ func (c *Scoop) tickerCheckForClose() {
 }
 
 func (c *Scoop) EventCallOpen(pair string) {
+	// 回测时由 OnBacktestTick 统一排序开仓，单个交易对不再单独开仓
+	if c.setting.Backtest {
+		return
+	}
 	longShortRatio, currentMatchers := c.checkScoopPosition(c.pairOptions[pair])
 	if longShortRatio >= 0 {
 		go c.openScoopPosition(c.pairOptions[pair], longShortRatio, currentMatchers)
@@ -383,10 +414,7 @@ func (c *Scoop) closeScoopPosition(option *model.PairOption) {
 	}
 
 	currentPrice, _ := c.pairPrices.Get(option.Pair)
-	currentTime := time.Now()
-	if c.setting.Backtest {
-		currentTime, _ = c.lastUpdate.Get(option.Pair)
-	}
+	currentTime := c.clock.Now()
 	// 与当前方向相反有仓位,计算相对分界线距离，多空比达到反手标准平仓
 	// ***********************
 	for _, openedPosition := range openedPositions {
@@ -6,20 +6,26 @@ import (
 	"floolishman/constants"
 	"floolishman/exchange"
 	"floolishman/model"
+	"floolishman/reference"
 	"floolishman/storage"
 	"floolishman/types"
 	"floolishman/utils"
+	"floolishman/utils/clock"
+	"floolishman/utils/config"
 	"floolishman/utils/fileutil"
 	"floolishman/utils/strutil"
 	"fmt"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/glebarez/sqlite"
+	"github.com/samber/lo"
 	"github.com/spf13/viper"
+	"github.com/xhit/go-str2duration/v2"
 	"gorm.io/gorm"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func main() {
@@ -50,7 +56,7 @@ func main() {
 			MaxMarginLossRatio:        viper.GetFloat64("caller.maxMarginLossRatio"),
 			PauseCaller:               viper.GetInt64("caller.pauseCaller"),
 		}
-		pairsSetting      = viper.GetStringMap("pairs")
+		pairsSetting      = config.GetPairs()
 		strategiesSetting = viper.GetStringSlice("strategies")
 	)
 
@@ -73,7 +79,8 @@ func main() {
 			if strutil.ContainsString(callerSetting.IgnorePairs, pair) {
 				continue
 			}
-			dataCsvPath = fmt.Sprintf("testdata/%s-%s.csv", pair, "30m")
+			// 与下方加载的原始K线一致，使用 1m 数据
+			dataCsvPath = exchange.FeedFile("testdata", strings.ToUpper(pair), "1m")
 			exists, err := fileutil.PathExists(dataCsvPath)
 			if err != nil {
 				utils.Log.Error(err)
@@ -135,17 +142,84 @@ func main() {
 		if option.Status == false {
 			continue
 		}
-		dataCsvPath = fmt.Sprintf("testdata/%s-%s.csv", option.Pair, "1m")
+		dataCsvPath = exchange.FeedFile("testdata", option.Pair, "1m")
+		// 合约市场数据，读取 testdata/{pair}-{dataset}.csv 合并到K线 Metadata
+		marketData := []string{}
+		for _, dataset := range viper.GetStringSlice("backtest.marketData") {
+			marketData = append(marketData, fmt.Sprintf("testdata/%s-%s.csv", option.Pair, dataset))
+		}
 		pairFeeds = append(pairFeeds, exchange.PairFeed{
-			Pair:      option.Pair,
-			File:      dataCsvPath,
-			Timeframe: "1m",
+			Pair:       option.Pair,
+			File:       dataCsvPath,
+			Timeframe:  "1m",
+			MarketData: marketData,
 		})
 	}
 
-	csvFeed, err := exchange.NewCSVFeed("30m", pairFeeds...)
-	if err != nil {
-		log.Fatal(err)
+	// 分段回测，开始时间前保留策略预热所需的K线
+	start := viper.GetTime("backtest.start")
+	end := viper.GetTime("backtest.end")
+	if !start.IsZero() {
+		var warmup time.Duration
+		for timeframe, period := range compositesStrategy.TimeWarmupMap() {
+			interval, err := str2duration.ParseDuration(timeframe)
+			if err != nil {
+				log.Fatal(err)
+			}
+			warmup = max(warmup, interval*time.Duration(period))
+		}
+		start = start.Add(-warmup)
+	}
+	var (
+		feeder       reference.Feeder
+		originSource exchange.OriginCandleSource
+	)
+	if storeFeedable(pairFeeds, compositesStrategy.TimeWarmupMap()) {
+		// 列式文件且无需重采样时按需分批读取，不将全部K线载入内存
+		storeFeed, err := exchange.NewStoreFeed(pairFeeds...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer storeFeed.Close()
+		if _, err := storeFeed.Period(start, end); err != nil {
+			log.Fatal(err)
+		}
+		feeder, originSource = storeFeed, storeFeed
+	} else {
+		csvFeed, err := exchange.NewCSVFeed("1m", pairFeeds...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// 由原始K线重采样出组合策略所需的全部周期
+		if err := csvFeed.Resample(lo.Keys(compositesStrategy.TimeWarmupMap())...); err != nil {
+			log.Fatal(err)
+		}
+		if !start.IsZero() || !end.IsZero() {
+			csvFeed.Period(start, end)
+		}
+		// 对齐各周期预热结束时间，跟随模式及双向持仓模式不预热
+		if !callerSetting.FollowSymbol && callerSetting.CheckMode != "dual" {
+			if err := csvFeed.AlignWarmup(compositesStrategy.TimeWarmupMap()); err != nil {
+				log.Fatal(err)
+			}
+		}
+		feeder, originSource = csvFeed, csvFeed
+	}
+	// 逐笔回放，由 aggTrades/bookTicker 实时合成未收线K线驱动策略，K线文件仅用于预热
+	if viper.GetBool("backtest.ticks.enabled") {
+		tickPairFeeds := []exchange.TickPairFeed{}
+		for _, feed := range pairFeeds {
+			files, err := exchange.TickFiles(viper.GetString("backtest.ticks.path"), feed.Pair)
+			if err != nil {
+				log.Fatal(err)
+			}
+			tickPairFeeds = append(tickPairFeeds, exchange.TickPairFeed{Pair: feed.Pair, Files: files})
+		}
+		tickFeed, err := exchange.NewTickFeed(feeder, viper.GetDuration("backtest.ticks.interval"), tickPairFeeds...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		feeder = tickFeed.Period(viper.GetTime("backtest.start"), viper.GetTime("backtest.end"))
 	}
 	// initialize a database in memory
 	//memory, err := storage.FromFile("runtime/data/backtest.db")
@@ -157,14 +231,16 @@ func main() {
 	storagePath := viper.GetString("storage.path")
 	dir := filepath.Dir(storagePath)
 	// 判断文件目录是否存在
-	_, err = os.Stat(dir)
+	_, err := os.Stat(dir)
 	if err != nil {
 		err = os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
 			utils.Log.Panicf("mkdir error : %s", err.Error())
 		}
 	}
-	st, err := storage.FromSQL(sqlite.Open(storagePath), &gorm.Config{})
+	// 回测时钟由K线时间驱动，存储的时间戳与回放时间保持一致
+	candleClock := clock.NewCandle()
+	st, err := storage.FromSQL(sqlite.Open(storagePath), &gorm.Config{NowFunc: candleClock.Now})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -173,13 +249,76 @@ func main() {
 	if err != nil {
 		return
 	}
-	// create a paper wallet for simulation, initializing with 10.000 USDT
-	wallet := exchange.NewPaperWallet(
-		ctx,
-		"USDT",
+	// 资金费率，存在 testdata/{pair}-funding.csv 时按文件结算，否则使用默认费率
+	walletOptions := []exchange.PaperWalletOption{
 		exchange.WithPaperAsset("USDT", 850),
-		exchange.WithDataFeed(csvFeed),
+		exchange.WithDataFeed(feeder),
+		exchange.WithPaperFundingRate(viper.GetFloat64("backtest.fundingRate")),
+		exchange.WithPaperFeeTier(viper.GetInt("backtest.feeTier")),
+	}
+	if viper.GetBool("backtest.bnbDiscount") {
+		walletOptions = append(walletOptions, exchange.WithPaperBNBDiscount())
+	}
+	for _, option := range settings.PairOptions {
+		fundingCsvPath := fmt.Sprintf("testdata/%s-funding.csv", option.Pair)
+		exists, err := fileutil.PathExists(fundingCsvPath)
+		if err != nil || !exists {
+			continue
+		}
+		rates, err := exchange.NewFundingRatesFromCSV(fundingCsvPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		walletOptions = append(walletOptions, exchange.WithPaperFundingRates(option.Pair, rates))
+	}
+	// 外部基准，读取 testdata/{pair}-1m 的列式文件或 CSV
+	if benchmarkPair := strings.ToUpper(viper.GetString("backtest.benchmark")); benchmarkPair != "" {
+		candles, err := exchange.NewCandlesFromFile(exchange.PairFeed{
+			Pair:      benchmarkPair,
+			File:      exchange.FeedFile("testdata", benchmarkPair, "1m"),
+			Timeframe: "1m",
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		walletOptions = append(walletOptions, exchange.WithPaperBenchmark(benchmarkPair, candles))
+	}
+	// 撮合模型
+	fillModels := []exchange.FillModel{}
+	if slippageBps := viper.GetFloat64("backtest.slippageBps"); slippageBps > 0 {
+		fillModels = append(fillModels, exchange.FixedSlippage{Bps: slippageBps})
+	}
+	if volumeImpact := viper.GetFloat64("backtest.volumeImpact"); volumeImpact > 0 {
+		fillModels = append(fillModels, exchange.VolumeSlippage{Impact: volumeImpact, MaxBps: viper.GetFloat64("backtest.maxSlippageBps")})
+	}
+	if queueProbability := viper.GetFloat64("backtest.queueProbability"); queueProbability > 0 {
+		fillModels = append(fillModels, exchange.NewQueueFill(queueProbability, viper.GetInt64("backtest.seed")))
+	}
+	if maxParticipation := viper.GetFloat64("backtest.maxParticipation"); maxParticipation > 0 {
+		fillModels = append(fillModels, exchange.PartialFill{MaxParticipation: maxParticipation})
+	}
+	walletOptions = append(
+		walletOptions,
+		exchange.WithPaperFillModel(fillModels...),
+		exchange.WithPaperLatency(viper.GetDuration("backtest.latency")),
 	)
+	// K线内价格路径模型 none | ohlc | drilldown
+	switch viper.GetString("backtest.pathModel") {
+	case "ohlc":
+		walletOptions = append(walletOptions, exchange.WithPaperPathModel(exchange.OHLCPath{}))
+	case "drilldown":
+		walletOptions = append(walletOptions, exchange.WithPaperPathModel(exchange.NewDrillDownPath(originSource, exchange.OHLCPath{})))
+	}
+	// 杠杆分层文件，用于强平模拟
+	if bracketsPath := viper.GetString("backtest.leverageBrackets"); bracketsPath != "" {
+		brackets, err := exchange.NewLeverageBracketsFromFile(bracketsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		walletOptions = append(walletOptions, exchange.WithPaperLeverageBrackets(brackets))
+	}
+	// create a paper wallet for simulation, initializing with 10.000 USDT
+	wallet := exchange.NewPaperWallet(ctx, "USDT", walletOptions...)
 	b, err := bot.NewBot(
 		ctx,
 		settings,
@@ -188,10 +327,49 @@ func main() {
 		compositesStrategy,
 		bot.WithBacktest(wallet),
 		bot.WithStorage(st),
+		bot.WithClock(candleClock),
+		bot.WithMonteCarlo(bot.MonteCarloSetting{
+			Simulations: viper.GetInt("backtest.monteCarlo.simulations"),
+			Ruin:        viper.GetFloat64("backtest.monteCarlo.ruin"),
+			Leverages:   viper.GetIntSlice("backtest.monteCarlo.leverages"),
+			Output:      viper.GetString("backtest.monteCarlo.output"),
+			Seed:        viper.GetInt64("backtest.seed"),
+		}),
+		bot.WithReport(viper.GetString("backtest.report")),
+		bot.WithExport(bot.ExportSetting{
+			JSON:   viper.GetString("backtest.export.json"),
+			SQLite: viper.GetString("backtest.export.sqlite"),
+			Config: map[string]interface{}{
+				"strategies": strategiesSetting,
+				"backtest":   config.GetSection("backtest"),
+			},
+		}),
 	)
 	if err != nil {
 		utils.Log.Fatalln(err)
 	}
 
 	b.Run(ctx)
+
+	// 输出回测结果文件，供 optimize 命令读取
+	if resultPath := viper.GetString("backtest.resultPath"); resultPath != "" {
+		if err := b.SaveResult(resultPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// storeFeedable 所有交易对均为列式K线文件、无合约市场数据且策略只使用 1m 周期时可直接使用 StoreFeed
+func storeFeedable(feeds []exchange.PairFeed, warmup map[string]int) bool {
+	for timeframe := range warmup {
+		if timeframe != "1m" {
+			return false
+		}
+	}
+	for _, feed := range feeds {
+		if !exchange.IsCandleStore(feed.File) || len(feed.MarketData) > 0 {
+			return false
+		}
+	}
+	return len(feeds) > 0
 }
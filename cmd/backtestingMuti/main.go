@@ -9,10 +9,12 @@ import (
 	"floolishman/storage"
 	"floolishman/types"
 	"floolishman/utils"
+	"floolishman/utils/clock"
+	"floolishman/utils/config"
 	"floolishman/utils/fileutil"
-	"fmt"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/glebarez/sqlite"
+	"github.com/samber/lo"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 	"log"
@@ -77,7 +79,7 @@ func main() {
 		//if strutil.ContainsString(callerSetting.IgnorePairs, pair) {
 		//	continue
 		//}
-		dataCsvPath = fmt.Sprintf("testdata/%s-%s.csv", pair, "30m")
+		dataCsvPath = exchange.FeedFile("testdata", pair, "30m")
 		exists, err := fileutil.PathExists(dataCsvPath)
 		if err != nil {
 			utils.Log.Error(err)
@@ -116,7 +118,9 @@ func main() {
 			utils.Log.Panicf("mkdir error : %s", err.Error())
 		}
 	}
-	st, err := storage.FromSQL(sqlite.Open(storagePath), &gorm.Config{})
+	// 回测时钟由K线时间驱动，存储的时间戳与回放时间保持一致
+	candleClock := clock.NewCandle()
+	st, err := storage.FromSQL(sqlite.Open(storagePath), &gorm.Config{NowFunc: candleClock.Now})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -133,7 +137,7 @@ func main() {
 	for _, val := range pairOptions {
 		pairFeeds = append(pairFeeds, exchange.PairFeed{
 			Pair:      val.Pair,
-			File:      fmt.Sprintf("testdata/%s-%s.csv", val.Pair, "30m"),
+			File:      exchange.FeedFile("testdata", val.Pair, "30m"),
 			Timeframe: "30m",
 		})
 	}
@@ -142,6 +146,16 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// 由原始K线重采样出组合策略所需的全部周期
+	if err := csvFeed.Resample(lo.Keys(compositesStrategy.TimeWarmupMap())...); err != nil {
+		log.Fatal(err)
+	}
+	// 对齐各周期预热结束时间，跟随模式及双向持仓模式不预热
+	if !callerSetting.FollowSymbol && callerSetting.CheckMode != "dual" {
+		if err := csvFeed.AlignWarmup(compositesStrategy.TimeWarmupMap()); err != nil {
+			log.Fatal(err)
+		}
+	}
 	// create a paper wallet for simulation, initializing with 10.000 USDT
 	wallet := exchange.NewPaperWallet(
 		ctx,
@@ -157,6 +171,15 @@ func main() {
 		compositesStrategy,
 		bot.WithBacktest(wallet),
 		bot.WithStorage(st),
+		bot.WithClock(candleClock),
+		bot.WithExport(bot.ExportSetting{
+			JSON:   viper.GetString("backtest.export.json"),
+			SQLite: viper.GetString("backtest.export.sqlite"),
+			Config: map[string]interface{}{
+				"strategies": strategiesSetting,
+				"backtest":   config.GetSection("backtest"),
+			},
+		}),
 	)
 	if err != nil {
 		utils.Log.Fatalln(err)
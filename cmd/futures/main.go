@@ -6,24 +6,31 @@ import (
 	"floolishman/constants"
 	"floolishman/exchange"
 	"floolishman/model"
+	"floolishman/reference"
 	"floolishman/storage"
 	"floolishman/strategies"
 	"floolishman/types"
 	"floolishman/utils"
+	"floolishman/utils/config"
 	"floolishman/utils/strutil"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/glebarez/sqlite"
 	"github.com/spf13/viper"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 func main() {
 	// 获取基础配置
+	// 收到退出信号时取消 ctx，返回前执行 defer (关闭录制文件等)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	var (
-		ctx           = context.Background()
 		mode          = viper.GetString("mode")
 		apiKeyType    = viper.GetString("api.encrypt")
 		apiKey        = viper.GetString("api.key")
@@ -55,7 +62,7 @@ func main() {
 			MaxMarginLossRatio:        viper.GetFloat64("caller.maxMarginLossRatio"),
 			PauseCaller:               viper.GetInt64("caller.pauseCaller"),
 		}
-		pairsSetting      = viper.GetStringMap("pairs")
+		pairsSetting      = config.GetPairs()
 		strategiesSetting = viper.GetStringSlice("strategies")
 	)
 
@@ -180,21 +187,59 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	b, err := bot.NewBot(
-		ctx,
-		settings,
-		binance,
-		callerSetting,
-		compositesStrategy,
+	botOptions := []bot.Option{
 		bot.WithStorage(st),
 		bot.WithProxy(types.ProxyOption{
 			Status: proxyStatus,
 			Url:    proxyUrl,
 		}),
+	}
+	// 录制实盘行情，用于逐笔回放
+	if viper.GetBool("recorder.enabled") {
+		recorderOptions := []exchange.RecorderOption{}
+		if proxyStatus {
+			recorderOptions = append(recorderOptions, exchange.WithRecorderProxy(proxyUrl))
+		}
+		recorder, err := exchange.NewRecorder(viper.GetString("recorder.path"), recorderOptions...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		for _, option := range settings.PairOptions {
+			for _, stream := range viper.GetStringSlice("recorder.streams") {
+				if err := recorder.Record(ctx, option.Pair, stream); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		botOptions = append(botOptions, bot.WithCandleSubscription(recorder))
+	}
+	// 模拟盘模式，使用币安实时K线驱动模拟钱包
+	var exch reference.Exchange = binance
+	if mode == "paper" {
+		wallet := exchange.NewPaperWallet(
+			ctx,
+			"USDT",
+			exchange.WithPaperAsset("USDT", viper.GetFloat64("paper.balance")),
+			exchange.WithPaperFundingRate(viper.GetFloat64("backtest.fundingRate")),
+			exchange.WithDataFeed(binance),
+		)
+		exch = wallet
+		botOptions = append(botOptions, bot.WithPaperWallet(wallet))
+	}
+	b, err := bot.NewBot(
+		ctx,
+		settings,
+		exch,
+		callerSetting,
+		compositesStrategy,
+		botOptions...,
 	)
 	if err != nil {
 		utils.Log.Fatalln(err)
 	}
 
-	b.Run(ctx)
+	go b.Run(ctx)
+	<-ctx.Done()
+	utils.Log.Info("Shutting down")
 }
@@ -6,6 +6,7 @@ import (
 	"floolishman/storage"
 	"floolishman/types"
 	"floolishman/utils"
+	"floolishman/utils/config"
 	"floolishman/utils/strutil"
 	"github.com/glebarez/sqlite"
 	"github.com/spf13/viper"
@@ -18,7 +19,7 @@ func main() {
 	var (
 		proxyStatus   = viper.GetBool("proxy.status")
 		proxyUrl      = viper.GetString("proxy.url")
-		pairsSetting  = viper.GetStringMap("pairs")
+		pairsSetting  = config.GetPairs()
 		guiderSetting = viper.Get("guiders")
 	)
 	// 转换配置
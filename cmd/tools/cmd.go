@@ -3,14 +3,20 @@ package main
 import (
 	"floolishman/download"
 	"floolishman/exchange"
+	"floolishman/optimize"
 	"floolishman/reference"
 	"floolishman/types"
+	"floolishman/utils/config"
 	"floolishman/utils/strutil"
 	"fmt"
 	"github.com/spf13/viper"
 	"github.com/urfave/cli/v2"
+	"github.com/xhit/go-str2duration/v2"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 func main() {
@@ -69,7 +75,7 @@ func main() {
 					&cli.StringFlag{
 						Name:     "output",
 						Aliases:  []string{"o"},
-						Usage:    "eg. ./btc.csv",
+						Usage:    "eg. ./btc.csv or ./btc.fcs",
 						Required: false,
 					},
 					&cli.BoolFlag{
@@ -79,6 +85,18 @@ func main() {
 						Value:    false,
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "output format for pairs without --output, csv or fcs",
+						Value:    "csv",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "dataset",
+						Usage:    "kline, funding, openInterest, longShort, takerVolume or markPrice (futures only except kline)",
+						Value:    "kline",
+						Required: false,
+					},
 				},
 				Action: func(c *cli.Context) error {
 					var (
@@ -113,7 +131,6 @@ func main() {
 						log.Fatal("START and END must be informed together")
 					}
 					var output string
-					timeframe := c.String("timeframe")
 					pair := c.String("pair")
 					if len(pair) == 0 {
 						//var wg sync.WaitGroup // 用于等待所有并发任务完成
@@ -130,8 +147,8 @@ func main() {
 							if assetInfo.QuoteAsset != "USDT" {
 								continue
 							}
-							output = fmt.Sprintf("./testdata/%s-%s.csv", pair, c.String("timeframe"))
-							err := download.NewDownloader(exc).Download(c.Context, pair, timeframe, output, options...)
+							output = defaultOutput(c, pair)
+							err := downloadDataset(c, exc, pair, output, options...)
 							if err != nil {
 								return err
 							}
@@ -152,12 +169,308 @@ func main() {
 					} else {
 						output = c.String("output")
 						if len(output) == 0 {
-							output = fmt.Sprintf("./testdata/%s-%s.csv", pair, timeframe)
+							output = defaultOutput(c, pair)
 						}
-						return download.NewDownloader(exc).Download(c.Context, pair, timeframe, output, options...)
+						return downloadDataset(c, exc, pair, output, options...)
 					}
 				},
 			},
+			{
+				Name:     "import",
+				HelpName: "import",
+				Usage:    "Import Binance public-data kline ZIP archives",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "input",
+						Aliases:  []string{"i"},
+						Usage:    "zip file or directory with {PAIR}-{timeframe}-{date}.zip and .CHECKSUM files",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "pair",
+						Aliases:  []string{"p"},
+						Usage:    "only import this pair, eg. BTCUSDT",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "timeframe",
+						Aliases:  []string{"t"},
+						Usage:    "only import this timeframe, eg. 1m",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "output file when importing a single pair and timeframe (default ./testdata/{pair}-{timeframe}.{format})",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "format",
+						Usage:    "csv or fcs",
+						Value:    "csv",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "no-checksum",
+						Usage:    "skip CHECKSUM verification",
+						Value:    false,
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					input := c.String("input")
+					files := []string{input}
+					if info, err := os.Stat(input); err != nil {
+						return err
+					} else if info.IsDir() {
+						if files, err = filepath.Glob(filepath.Join(input, "*.zip")); err != nil {
+							return err
+						}
+					}
+					// 按交易对及周期分组
+					groups := make(map[string][]download.Archive)
+					for _, file := range files {
+						archive, ok := download.ParseArchive(file)
+						if !ok {
+							continue
+						}
+						if pair := c.String("pair"); pair != "" && !strings.EqualFold(pair, archive.Pair) {
+							continue
+						}
+						if timeframe := c.String("timeframe"); timeframe != "" && timeframe != archive.Timeframe {
+							continue
+						}
+						key := fmt.Sprintf("%s-%s", archive.Pair, archive.Timeframe)
+						groups[key] = append(groups[key], archive)
+					}
+					if len(groups) == 0 {
+						return fmt.Errorf("%s: no kline archives found", input)
+					}
+					if c.String("output") != "" && len(groups) > 1 {
+						return fmt.Errorf("OUTPUT can only be used with a single pair and timeframe")
+					}
+					for key, archives := range groups {
+						output := c.String("output")
+						if output == "" {
+							output = fmt.Sprintf("./testdata/%s.%s", key, c.String("format"))
+						}
+						if err := download.ImportArchives(archives, output, !c.Bool("no-checksum")); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:     "convert",
+				HelpName: "convert",
+				Usage:    "Convert CSV candles to the columnar candle store",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "input",
+						Aliases:  []string{"i"},
+						Usage:    "csv file or directory, eg. ./testdata",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "output file or directory (default next to the input)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "pair",
+						Aliases:  []string{"p"},
+						Usage:    "eg. BTCUSDT (default from file name)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "timeframe",
+						Aliases:  []string{"t"},
+						Usage:    "eg. 1m (default from file name)",
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					input := c.String("input")
+					info, err := os.Stat(input)
+					if err != nil {
+						return err
+					}
+					// 单个文件
+					if !info.IsDir() {
+						pair, timeframe, _ := parseFeedFile(input)
+						if c.String("pair") != "" {
+							pair = c.String("pair")
+						}
+						if c.String("timeframe") != "" {
+							timeframe = c.String("timeframe")
+						}
+						if pair == "" || timeframe == "" {
+							return fmt.Errorf("%s: PAIR and TIMEFRAME must be informed", input)
+						}
+						output := c.String("output")
+						if output == "" {
+							output = strings.TrimSuffix(input, filepath.Ext(input)) + exchange.CandleStoreExt
+						}
+						return convertFeedFile(input, output, pair, timeframe)
+					}
+					// 目录下全部 {pair}-{timeframe}.csv 文件
+					files, err := filepath.Glob(filepath.Join(input, "*.csv"))
+					if err != nil {
+						return err
+					}
+					outputDir := c.String("output")
+					if outputDir == "" {
+						outputDir = input
+					}
+					if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+						return err
+					}
+					for _, file := range files {
+						pair, timeframe, ok := parseFeedFile(file)
+						if !ok {
+							continue
+						}
+						name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + exchange.CandleStoreExt
+						if err := convertFeedFile(file, filepath.Join(outputDir, name), pair, timeframe); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:     "optimize",
+				HelpName: "optimize",
+				Usage:    "Search backtest parameters",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "space",
+						Aliases:  []string{"s"},
+						Usage:    "parameter space file, eg. ./space.yaml",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "leaderboard file (.csv or .json)",
+						Value:    "./runtime/optimize/leaderboard.csv",
+						Required: false,
+					},
+				}, searchFlags()...),
+				Action: func(c *cli.Context) error {
+					space, err := loadSpace(c.String("space"))
+					if err != nil {
+						return err
+					}
+					output := c.String("output")
+					runner := optimize.CommandRunner{
+						Command: strings.Fields(c.String("command")),
+						WorkDir: ".",
+						Output:  filepath.Join(filepath.Dir(output), "trials"),
+					}
+					optimizer, err := optimize.NewOptimizer(runner, space, searchOptions(c)...)
+					if err != nil {
+						return err
+					}
+					trials, err := optimizer.Run(c.Context)
+					if err != nil {
+						return err
+					}
+					if err := optimizer.SaveLeaderboard(output, trials); err != nil {
+						return err
+					}
+					for i := 0; i < len(trials) && i < 10; i++ {
+						fmt.Printf("#%d score: %.4f params: %v\n", i+1, trials[i].Score, trials[i].Params)
+					}
+					return nil
+				},
+			},
+			{
+				Name:     "walkforward",
+				HelpName: "walkforward",
+				Usage:    "Walk-forward analysis with rolling in-sample/out-of-sample windows",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "space",
+						Aliases:  []string{"s"},
+						Usage:    "parameter space file, eg. ./space.yaml",
+						Required: true,
+					},
+					&cli.TimestampFlag{
+						Name:     "start",
+						Usage:    "eg. 2024-01-01",
+						Layout:   "2006-01-02",
+						Required: true,
+					},
+					&cli.TimestampFlag{
+						Name:     "end",
+						Usage:    "eg. 2024-12-31",
+						Layout:   "2006-01-02",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "in-sample",
+						Usage:    "in-sample window, eg. 90d",
+						Value:    "90d",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "out-sample",
+						Usage:    "out-of-sample window, eg. 30d",
+						Value:    "30d",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "anchored",
+						Usage:    "in-sample windows always start at the beginning",
+						Value:    false,
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "report directory",
+						Value:    "./runtime/walkforward",
+						Required: false,
+					},
+				}, searchFlags()...),
+				Action: func(c *cli.Context) error {
+					space, err := loadSpace(c.String("space"))
+					if err != nil {
+						return err
+					}
+					inSample, err := str2duration.ParseDuration(c.String("in-sample"))
+					if err != nil {
+						return err
+					}
+					outSample, err := str2duration.ParseDuration(c.String("out-sample"))
+					if err != nil {
+						return err
+					}
+					windows := optimize.Windows(*c.Timestamp("start"), *c.Timestamp("end"), inSample, outSample, c.Bool("anchored"))
+					if len(windows) == 0 {
+						return fmt.Errorf("period is shorter than one in-sample and out-of-sample window")
+					}
+
+					output := c.String("output")
+					command := strings.Fields(c.String("command"))
+					walkForward := optimize.NewWalkForward(space, windows, func(name string) optimize.Runner {
+						return optimize.CommandRunner{
+							Command: command,
+							WorkDir: ".",
+							Output:  filepath.Join(output, name),
+						}
+					}, searchOptions(c)...)
+					report, err := walkForward.Run(c.Context)
+					if err != nil {
+						return err
+					}
+					fmt.Println(report.String())
+					return report.Save(output)
+				},
+			},
 		},
 	}
 
@@ -166,3 +479,133 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// defaultOutput K线保存为 {pair}-{timeframe}，市场数据保存为 {pair}-{dataset}.csv，回测按此命名读取
+func defaultOutput(c *cli.Context, pair string) string {
+	if dataset := c.String("dataset"); dataset != "kline" {
+		return fmt.Sprintf("./testdata/%s-%s.csv", pair, dataset)
+	}
+	return fmt.Sprintf("./testdata/%s-%s.%s", pair, c.String("timeframe"), c.String("format"))
+}
+
+// downloadDataset 按 dataset 下载K线或合约市场数据
+func downloadDataset(c *cli.Context, exc reference.Feeder, pair, output string, options ...download.Option) error {
+	downloader := download.NewDownloader(exc)
+	if dataset := c.String("dataset"); dataset != "kline" {
+		return downloader.DownloadMarketData(c.Context, pair, dataset, c.String("timeframe"), output, options...)
+	}
+	return downloader.Download(c.Context, pair, c.String("timeframe"), output, options...)
+}
+
+// parseFeedFile 从 {pair}-{timeframe}.csv 文件名中解析交易对及周期
+func parseFeedFile(path string) (string, string, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	index := strings.LastIndex(name, "-")
+	if index <= 0 {
+		return "", "", false
+	}
+	pair, timeframe := name[:index], name[index+1:]
+	if _, err := str2duration.ParseDuration(timeframe); err != nil {
+		return "", "", false
+	}
+	return pair, timeframe, true
+}
+
+func convertFeedFile(input, output, pair, timeframe string) error {
+	count, err := exchange.ConvertCSVToCandleStore(input, output, pair, timeframe)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s -> %s (%d candles)\n", input, output, count)
+	return nil
+}
+
+// searchFlags 参数搜索相关的公共参数
+func searchFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "method",
+			Aliases:  []string{"m"},
+			Usage:    "grid, random or genetic",
+			Value:    optimize.MethodGrid,
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "objective",
+			Usage:    "profit, pf, sqn, calmar, sharpe or sortino",
+			Value:    "profit",
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "parallel",
+			Aliases:  []string{"p"},
+			Usage:    "number of backtests running at the same time",
+			Value:    runtime.NumCPU(),
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "samples",
+			Usage:    "random search samples",
+			Value:    50,
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "population",
+			Usage:    "genetic search population size",
+			Value:    20,
+			Required: false,
+		},
+		&cli.IntFlag{
+			Name:     "generations",
+			Usage:    "genetic search generations",
+			Value:    10,
+			Required: false,
+		},
+		&cli.Float64Flag{
+			Name:     "mutation",
+			Usage:    "genetic search mutation probability",
+			Value:    0.1,
+			Required: false,
+		},
+		&cli.Int64Flag{
+			Name:     "seed",
+			Usage:    "random seed",
+			Value:    1,
+			Required: false,
+		},
+		&cli.StringFlag{
+			Name:     "command",
+			Aliases:  []string{"c"},
+			Usage:    "backtest command, eg. ./backtesting",
+			Value:    "go run ./cmd/backtesting",
+			Required: false,
+		},
+	}
+}
+
+// searchOptions 根据命令行参数构建搜索配置
+func searchOptions(c *cli.Context) []optimize.Option {
+	return []optimize.Option{
+		optimize.WithMethod(c.String("method")),
+		optimize.WithObjective(c.String("objective")),
+		optimize.WithParallel(c.Int("parallel")),
+		optimize.WithSamples(c.Int("samples")),
+		optimize.WithGenetic(c.Int("population"), c.Int("generations"), c.Float64("mutation")),
+		optimize.WithSeed(c.Int64("seed")),
+	}
+}
+
+// loadSpace 读取参数空间，非选币模式下参数被交易对配置覆盖时返回错误，避免调参不生效
+func loadSpace(file string) (optimize.Space, error) {
+	space, err := optimize.LoadSpace(file)
+	if err != nil {
+		return nil, err
+	}
+	if viper.GetString("caller.checkMode") == "scoop" {
+		return space, nil
+	}
+	if shadowed := space.Shadowed(config.GetPairs()); len(shadowed) > 0 {
+		return nil, fmt.Errorf("parameters overridden by pair settings, use the pair keys instead: %s", strings.Join(shadowed, ", "))
+	}
+	return space, nil
+}
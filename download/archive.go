@@ -0,0 +1,189 @@
+package download
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Archive 币安公开数据K线压缩包，文件名格式为 {PAIR}-{timeframe}-{yyyy-mm}[-dd].zip
+type Archive struct {
+	File      string
+	Pair      string
+	Timeframe string
+	Period    string
+}
+
+// ParseArchive 从文件名解析交易对、周期及日期
+func ParseArchive(file string) (Archive, bool) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	parts := strings.Split(name, "-")
+	if !strings.EqualFold(filepath.Ext(file), ".zip") || len(parts) < 4 {
+		return Archive{}, false
+	}
+	if _, err := str2duration.ParseDuration(parts[1]); err != nil {
+		return Archive{}, false
+	}
+	return Archive{
+		File:      file,
+		Pair:      strings.ToUpper(parts[0]),
+		Timeframe: parts[1],
+		Period:    strings.Join(parts[2:], "-"),
+	}, true
+}
+
+// VerifyChecksum 校验压缩包与同目录 {file}.CHECKSUM 中的 SHA256 是否一致
+func VerifyChecksum(file string) error {
+	content, err := os.ReadFile(file + ".CHECKSUM")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s: empty checksum file", file)
+	}
+
+	archiveFile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, bufio.NewReader(archiveFile)); err != nil {
+		return err
+	}
+	if !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), fields[0]) {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file)
+	}
+	return nil
+}
+
+// ReadArchive 读取压缩包内的K线CSV
+// 列依次为 open_time, open, high, low, close, volume, ...，合约数据带表头，现货数据不带表头
+// 开盘时间为毫秒，2025年起现货数据为微秒
+func ReadArchive(archive Archive) ([]model.Candle, error) {
+	reader, err := zip.OpenReader(archive.File)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	candles := make([]model.Candle, 0)
+	for _, file := range reader.File {
+		if !strings.EqualFold(filepath.Ext(file.Name), ".csv") {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		lines, err := csv.NewReader(content).ReadAll()
+		content.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archive.File, err)
+		}
+		for _, line := range lines {
+			if len(line) < 6 {
+				continue
+			}
+			openTime, err := strconv.ParseInt(line[0], 10, 64)
+			if err != nil {
+				// 表头
+				continue
+			}
+			var candleTime time.Time
+			if openTime > 1e14 {
+				candleTime = time.UnixMicro(openTime).UTC()
+			} else {
+				candleTime = time.UnixMilli(openTime).UTC()
+			}
+			candle := model.Candle{
+				Pair:      archive.Pair,
+				Time:      candleTime,
+				UpdatedAt: candleTime,
+				Complete:  true,
+			}
+			values := make([]float64, 5)
+			for i := range values {
+				if values[i], err = strconv.ParseFloat(line[i+1], 64); err != nil {
+					return nil, fmt.Errorf("%s: %w", archive.File, err)
+				}
+			}
+			candle.Open, candle.High, candle.Low, candle.Close, candle.Volume = values[0], values[1], values[2], values[3], values[4]
+			candles = append(candles, candle)
+		}
+	}
+	return candles, nil
+}
+
+// ImportArchives 导入同一交易对及周期的K线压缩包，与 output 已有数据合并去重后写回
+// 同一时间的K线以压缩包为准，verify 为 true 时逐个校验 CHECKSUM，缺少或不一致时中止导入
+func ImportArchives(archives []Archive, output string, verify bool) error {
+	if len(archives) == 0 {
+		return nil
+	}
+	pair, timeframe := archives[0].Pair, archives[0].Timeframe
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return err
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Period < archives[j].Period
+	})
+
+	candles, err := readCandles(output, pair, timeframe)
+	if err != nil {
+		return err
+	}
+	existing := len(candles)
+	for _, archive := range archives {
+		if archive.Pair != pair || archive.Timeframe != timeframe {
+			return fmt.Errorf("%s: expected %s %s", archive.File, pair, timeframe)
+		}
+		if verify {
+			if err := VerifyChecksum(archive.File); err != nil {
+				return err
+			}
+		}
+		items, err := ReadArchive(archive)
+		if err != nil {
+			return err
+		}
+		candles = append(candles, items...)
+	}
+
+	candles, duplicates := dedupe(candles)
+	if err := writeCandles(output, pair, timeframe, candles, -1); err != nil {
+		return err
+	}
+	utils.Log.Infof("[IMPORT] %s %s: %d archives, %d candles (%d existing, %d duplicates) -> %s",
+		pair, timeframe, len(archives), len(candles), existing, duplicates, output)
+
+	// 校验连续性
+	if len(candles) > 0 {
+		for _, gap := range Gaps(candles, candles[0].Time, candles[len(candles)-1].Time, interval) {
+			utils.Log.Warnf("%s: missing %d candles from %s to %s", pair, gap.Count(interval),
+				gap.Start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
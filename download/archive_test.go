@@ -0,0 +1,155 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testdata 中的压缩包：2024-01-01 为合约格式（带表头、毫秒），2025-01-01 为现货格式（无表头、微秒）
+const (
+	futuresArchive = "testdata/BTCUSDT-1h-2024-01-01.zip"
+	spotArchive    = "testdata/BTCUSDT-1h-2025-01-01.zip"
+)
+
+// copyArchive 将压缩包复制到临时目录，checksum 为空时不写入 .CHECKSUM
+func copyArchive(t *testing.T, file, checksum string) string {
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	target := filepath.Join(t.TempDir(), filepath.Base(file))
+	require.NoError(t, os.WriteFile(target, content, 0644))
+	if checksum != "" {
+		require.NoError(t, os.WriteFile(target+".CHECKSUM", []byte(checksum), 0644))
+	}
+	return target
+}
+
+func parseArchive(t *testing.T, file string) Archive {
+	archive, ok := ParseArchive(file)
+	require.True(t, ok)
+	return archive
+}
+
+func TestParseArchive(t *testing.T) {
+	archive := parseArchive(t, futuresArchive)
+	require.Equal(t, Archive{File: futuresArchive, Pair: "BTCUSDT", Timeframe: "1h", Period: "2024-01-01"}, archive)
+
+	archive = parseArchive(t, "ethusdt-15m-2024-02.zip")
+	require.Equal(t, "ETHUSDT", archive.Pair)
+	require.Equal(t, "2024-02", archive.Period)
+
+	for _, file := range []string{"BTCUSDT-1h-2024-01-01.csv", "BTCUSDT-1h.zip", "BTCUSDT-batata-2024-01.zip"} {
+		_, ok := ParseArchive(file)
+		require.False(t, ok, file)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	t.Run("match", func(t *testing.T) {
+		require.NoError(t, VerifyChecksum(futuresArchive))
+		require.NoError(t, VerifyChecksum(spotArchive))
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		file := copyArchive(t, futuresArchive, "0000000000000000000000000000000000000000000000000000000000000000  BTCUSDT-1h-2024-01-01.zip\n")
+		require.ErrorIs(t, VerifyChecksum(file), ErrChecksumMismatch)
+	})
+
+	t.Run("missing checksum", func(t *testing.T) {
+		file := copyArchive(t, futuresArchive, "")
+		require.ErrorIs(t, VerifyChecksum(file), os.ErrNotExist)
+	})
+
+	t.Run("empty checksum", func(t *testing.T) {
+		file := copyArchive(t, futuresArchive, "\n")
+		require.Error(t, VerifyChecksum(file))
+	})
+}
+
+func TestReadArchive(t *testing.T) {
+	t.Run("header and milliseconds", func(t *testing.T) {
+		candles, err := ReadArchive(parseArchive(t, futuresArchive))
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		for i, candle := range candles {
+			require.Equal(t, "BTCUSDT", candle.Pair)
+			require.Equal(t, downloadStart.Add(time.Duration(i)*time.Hour), candle.Time)
+			require.True(t, candle.Complete)
+		}
+		require.Equal(t, 42000.1, candles[0].Open)
+		require.Equal(t, 42100.5, candles[0].High)
+		require.Equal(t, 41900.2, candles[0].Low)
+		require.Equal(t, 42050.3, candles[0].Close)
+		require.Equal(t, 120.5, candles[0].Volume)
+	})
+
+	t.Run("headerless and microseconds", func(t *testing.T) {
+		candles, err := ReadArchive(parseArchive(t, spotArchive))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.Equal(t, start, candles[0].Time)
+		require.Equal(t, start.Add(time.Hour), candles[1].Time)
+		require.Equal(t, 93500.0, candles[0].Open)
+		require.Equal(t, 93900.0, candles[1].Close)
+	})
+}
+
+func TestImportArchives(t *testing.T) {
+	t.Run("merge with existing file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		// 已有数据与压缩包在 2024-01-01 00:00 重叠，且带有附加列
+		existing := hourCandles(-2, 1)
+		for i := range existing {
+			existing[i].Metadata = map[string]float64{"funding": float64(i + 1)}
+		}
+		require.NoError(t, writeCandles(output, "BTCUSDT", "1h", existing, -1))
+
+		archives := []Archive{parseArchive(t, spotArchive), parseArchive(t, futuresArchive)}
+		require.NoError(t, ImportArchives(archives, output, true))
+
+		candles, err := readCandles(output, "BTCUSDT", "1h")
+		require.NoError(t, err)
+		require.Len(t, candles, 7)
+		for i := 1; i < len(candles); i++ {
+			require.True(t, candles[i-1].Time.Before(candles[i].Time))
+		}
+		require.Equal(t, downloadStart.Add(-2*time.Hour), candles[0].Time)
+		require.Equal(t, 1.0, candles[0].Metadata["funding"])
+
+		// 重叠的K线以压缩包为准，附加列保留已有数据，压缩包独有的K线附加列为0
+		require.Equal(t, downloadStart, candles[2].Time)
+		require.Equal(t, 42050.3, candles[2].Close)
+		require.Equal(t, 3.0, candles[2].Metadata["funding"])
+		require.Equal(t, 0.0, candles[3].Metadata["funding"])
+		require.Equal(t, time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC), candles[6].Time)
+	})
+
+	t.Run("missing checksum aborts", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		file := copyArchive(t, futuresArchive, "")
+		require.ErrorIs(t, ImportArchives([]Archive{parseArchive(t, file)}, output, true), os.ErrNotExist)
+		require.NoFileExists(t, output)
+
+		require.NoError(t, ImportArchives([]Archive{parseArchive(t, file)}, output, false))
+		candles, err := readCandles(output, "BTCUSDT", "1h")
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+	})
+
+	t.Run("checksum mismatch aborts", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		file := copyArchive(t, futuresArchive, "0000  BTCUSDT-1h-2024-01-01.zip\n")
+		require.ErrorIs(t, ImportArchives([]Archive{parseArchive(t, file)}, output, true), ErrChecksumMismatch)
+		require.NoFileExists(t, output)
+	})
+
+	t.Run("mixed pairs", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "ETHUSDT-1h.csv")
+		archives := []Archive{{File: futuresArchive, Pair: "ETHUSDT", Timeframe: "1h", Period: "2023-12-31"}, parseArchive(t, futuresArchive)}
+		require.Error(t, ImportArchives(archives, output, false))
+	})
+}
@@ -3,9 +3,14 @@ package download
 import (
 	"context"
 	"encoding/csv"
+	"errors"
+	"floolishman/exchange"
+	"floolishman/model"
 	"floolishman/reference"
 	"floolishman/utils"
 	"os"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -45,23 +50,8 @@ func WithDays(days int) Option {
 	}
 }
 
-func candlesCount(start, end time.Time, timeframe string) (int, time.Duration, error) {
-	totalDuration := end.Sub(start)
-	interval, err := str2duration.ParseDuration(timeframe)
-	if err != nil {
-		return 0, 0, err
-	}
-	return int(totalDuration / interval), interval, nil
-}
-
-func (d Downloader) Download(ctx context.Context, pair, timeframe string, output string, options ...Option) error {
-	recordFile, err := os.Create(output)
-	if err != nil {
-		return err
-	}
-	defer recordFile.Close()
-
-	now := time.Now()
+// newParameters 默认下载最近一个月，开始时间对齐到UTC零点，结束时间早于当前时间时同样对齐
+func newParameters(now time.Time, options ...Option) *Parameters {
 	parameters := &Parameters{
 		Start: now.AddDate(0, -1, 0),
 		End:   now,
@@ -80,69 +70,192 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 	} else {
 		parameters.End = now
 	}
+	return parameters
+}
+
+func candlesCount(start, end time.Time, timeframe string) (int, time.Duration, error) {
+	totalDuration := end.Sub(start)
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(totalDuration / interval), interval, nil
+}
+
+// Download 下载K线写入 output，扩展名为 .fcs 时写入列式文件，否则写入 CSV
+// output 已存在时增量更新：读取已有K线并去重，仅下载请求区间及已有数据中缺失的K线，合并后整体写回
+// 只保留已收线的K线，写入完成后检查连续性，交易所本身缺失的区间以警告输出
+// 请求后仍没有数据的区间记录在 output+EmptyGapsExt 中，之后的增量下载不再请求
+func (d Downloader) Download(ctx context.Context, pair, timeframe string, output string, options ...Option) error {
+	now := time.Now()
+	parameters := newParameters(now, options...)
 
 	candlesCount, interval, err := candlesCount(parameters.Start, parameters.End, timeframe)
 	if err != nil {
 		return err
 	}
-	candlesCount++
 
-	utils.Log.Infof("Downloading %d candles of %s for %s", candlesCount, timeframe, pair)
-	info := d.exchange.AssetsInfo(pair)
-	writer := csv.NewWriter(recordFile)
+	// 读取已有数据
+	existing, err := readCandles(output, pair, timeframe)
+	if err != nil {
+		return err
+	}
+	candles, duplicates := dedupe(existing)
+	if duplicates > 0 {
+		utils.Log.Warnf("%s: %d duplicate candles removed", output, duplicates)
+	}
 
-	progressBar := progressbar.Default(int64(candlesCount))
-	lostData := 0
-	isLastLoop := false
+	// 已有数据早于请求区间时一并检查，修复序列中间的缺口
+	start := parameters.Start.Truncate(interval)
+	if len(candles) > 0 && candles[0].Time.Before(start) {
+		start = candles[0].Time
+	}
+	// 最后一根已收线K线的开盘时间
+	end := parameters.End.Truncate(interval).Add(-interval)
+	emptyGaps, err := readEmptyGaps(output)
+	if err != nil {
+		return err
+	}
+	missing := subtractGaps(Gaps(candles, start, end, interval), emptyGaps, interval)
+	missingCount := 0
+	for _, gap := range missing {
+		missingCount += gap.Count(interval)
+	}
 
-	// write headers
-	err = writer.Write([]string{
-		"time", "open", "close", "low", "high", "volume",
-	})
+	utils.Log.Infof("Downloading %d of %d candles of %s for %s (%d existing)", missingCount, candlesCount, timeframe, pair, len(candles))
+	fetched, err := d.fetch(ctx, pair, timeframe, interval, missing, missingCount)
 	if err != nil {
 		return err
 	}
 
-	for begin := parameters.Start; begin.Before(parameters.End); begin = begin.Add(interval * batchSize) {
-		end := begin.Add(interval * batchSize)
-		if end.Before(parameters.End) {
-			end = end.Add(-1 * time.Second)
-		} else {
-			end = parameters.End
-			isLastLoop = true
-		}
+	// 合并后仅保留已收线的K线
+	candles, _ = dedupe(append(candles, fetched...))
 
-		candles, err := d.exchange.CandlesByPeriod(ctx, pair, timeframe, begin, end)
-		if err != nil {
+	// 记录请求后仍缺失的区间，末尾的区间可能只是交易所尚未生成数据，下次继续请求
+	var newEmptyGaps []Gap
+	for _, gap := range subtractGaps(Gaps(candles, start, end, interval), emptyGaps, interval) {
+		if gap.End.Before(end) {
+			newEmptyGaps = append(newEmptyGaps, gap)
+		}
+	}
+	if len(newEmptyGaps) > 0 {
+		emptyGaps = append(emptyGaps, newEmptyGaps...)
+		sort.Slice(emptyGaps, func(i, j int) bool {
+			return emptyGaps[i].Start.Before(emptyGaps[j].Start)
+		})
+		if err := writeEmptyGaps(output, emptyGaps); err != nil {
 			return err
 		}
-
-		for _, candle := range candles {
-			err := writer.Write(candle.ToSlice(info.QuotePrecision))
-			if err != nil {
-				return err
-			}
+	}
+	closed := candles[:0]
+	for _, candle := range candles {
+		if !candle.Time.Add(interval).After(now) {
+			closed = append(closed, candle)
 		}
+	}
+	candles = closed
+
+	if err := writeCandles(output, pair, timeframe, candles, d.exchange.AssetsInfo(pair).QuotePrecision); err != nil {
+		return err
+	}
 
-		countCandles := len(candles)
-		if !isLastLoop {
-			lostData += batchSize - countCandles
+	// 校验连续性
+	if len(candles) > 0 {
+		gaps := Gaps(candles, candles[0].Time, candles[len(candles)-1].Time, interval)
+		lostData := 0
+		for _, gap := range gaps {
+			lostData += gap.Count(interval)
+			utils.Log.Warnf("%s: missing %d candles from %s to %s", pair, gap.Count(interval),
+				gap.Start.Format(time.RFC3339), gap.End.Format(time.RFC3339))
+		}
+		if lostData > 0 {
+			utils.Log.Warnf("%d missing candles", lostData)
 		}
+	}
+
+	utils.Log.Info("Done!")
+	return nil
+}
 
-		if err = progressBar.Add(countCandles); err != nil {
-			utils.Log.Warnf("update progresbar fail: %s", err.Error())
+// fetch 分批下载缺失区间的K线
+func (d Downloader) fetch(ctx context.Context, pair, timeframe string, interval time.Duration, missing []Gap, total int) ([]model.Candle, error) {
+	progressBar := progressbar.Default(int64(total))
+	records := make([]model.Candle, 0, total)
+	for _, gap := range missing {
+		for begin := gap.Start; !begin.After(gap.End); begin = begin.Add(interval * batchSize) {
+			end := begin.Add(interval * (batchSize - 1))
+			if end.After(gap.End) {
+				end = gap.End
+			}
+
+			candles, err := d.exchange.CandlesByPeriod(ctx, pair, timeframe, begin, end)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, candles...)
+
+			if err = progressBar.Add(int(end.Sub(begin)/interval) + 1); err != nil {
+				utils.Log.Warnf("update progresbar fail: %s", err.Error())
+			}
 		}
 	}
 
-	if err = progressBar.Close(); err != nil {
+	if err := progressBar.Close(); err != nil {
 		utils.Log.Warnf("close progresbar fail: %s", err.Error())
 	}
+	return records, nil
+}
 
-	if lostData > 0 {
-		utils.Log.Warnf("%d missing candles", lostData)
+// readCandles 读取已存在的K线文件，文件不存在时返回空
+func readCandles(output, pair, timeframe string) ([]model.Candle, error) {
+	if _, err := os.Stat(output); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
 	}
+	return exchange.NewCandlesFromFile(exchange.PairFeed{Pair: pair, File: output, Timeframe: timeframe})
+}
 
+// writeCandles 先写入临时文件再替换 output，避免中断时损坏已有数据
+func writeCandles(output, pair, timeframe string, candles []model.Candle, precision int) error {
+	temp := output + ".tmp"
+	if exchange.IsCandleStore(output) {
+		if err := exchange.WriteCandleStore(temp, pair, timeframe, candles); err != nil {
+			return err
+		}
+		return os.Rename(temp, output)
+	}
+
+	recordFile, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+
+	// 保留已有数据的附加列，缺少该列的K线写入0
+	metadata := exchange.CandleMetadata(candles)
+
+	writer := csv.NewWriter(recordFile)
+	// write headers
+	err = writer.Write(append([]string{
+		"time", "open", "close", "low", "high", "volume",
+	}, metadata...))
+	if err != nil {
+		return err
+	}
+	for _, candle := range candles {
+		record := candle.ToSlice(precision)
+		for _, name := range metadata {
+			record = append(record, strconv.FormatFloat(candle.Metadata[name], 'f', -1, 64))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
 	writer.Flush()
-	utils.Log.Info("Done!")
-	return writer.Error()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	if err := recordFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, output)
 }
@@ -2,12 +2,12 @@ package download
 
 import (
 	"context"
+	"floolishman/model"
 	"floolishman/reference"
-	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"floolishman/exchange"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -52,46 +52,174 @@ func TestDownloader_withInterval(t *testing.T) {
 	assert.Equal(t, startingParams[0], startingParams[1])
 }
 
-func TestDownloader_download(t *testing.T) {
-	ctx := context.Background()
-	tmpFile, err := os.CreateTemp(os.TempDir(), "*.csv")
-	require.NoError(t, err)
+var downloadStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func hourCandle(index int) model.Candle {
+	candleTime := downloadStart.Add(time.Duration(index) * time.Hour)
+	return model.Candle{
+		Pair:      "BTCUSDT",
+		Time:      candleTime,
+		UpdatedAt: candleTime.Add(time.Hour),
+		Open:      float64(100 + index),
+		Close:     float64(101 + index),
+		Low:       float64(99 + index),
+		High:      float64(102 + index),
+		Volume:    10,
+		Complete:  true,
+	}
+}
 
-	time, err := time.Parse("2006-01-02", "2021-04-26")
-	require.NoError(t, err)
+// fakeFeeder 按小时生成K线，empty 中的区间没有数据，记录每次请求的区间
+type fakeFeeder struct {
+	reference.Feeder
+	empty    []Gap
+	requests []Gap
+}
+
+func (f *fakeFeeder) AssetsInfo(_ string) model.AssetInfo {
+	return model.AssetInfo{QuotePrecision: 2}
+}
 
-	param := Parameters{
-		Start: time,
-		End:   time.AddDate(0, 0, 20),
+func (f *fakeFeeder) CandlesByPeriod(_ context.Context, _, _ string, start, end time.Time) ([]model.Candle, error) {
+	f.requests = append(f.requests, Gap{Start: start, End: end})
+	var candles []model.Candle
+	for index := int(start.Sub(downloadStart) / time.Hour); index <= int(end.Sub(downloadStart)/time.Hour); index++ {
+		candle := hourCandle(index)
+		empty := false
+		for _, gap := range f.empty {
+			if !candle.Time.Before(gap.Start) && !candle.Time.After(gap.End) {
+				empty = true
+			}
+		}
+		if !empty {
+			candles = append(candles, candle)
+		}
 	}
+	return candles, nil
+}
 
-	csvFeed, err := exchange.NewCSVFeed(
-		exchange.PairFeed{
-			Pair:      "BTCUSDT",
-			File:      "../testdata/btc-1d.csv",
-			Timeframe: "1d",
-		})
-	require.NoError(t, err)
+func hourCandles(from, to int) []model.Candle {
+	var candles []model.Candle
+	for index := from; index < to; index++ {
+		candles = append(candles, hourCandle(index))
+	}
+	return candles
+}
 
-	fakeExchange := struct {
-		reference.Feeder
-	}{
-		Feeder: csvFeed,
+func TestDownloader_Download(t *testing.T) {
+	interval := WithInterval(downloadStart, downloadStart.AddDate(0, 0, 2))
+	hour := func(index int) time.Time {
+		return downloadStart.Add(time.Duration(index) * time.Hour)
+	}
+	download := func(t *testing.T, feeder *fakeFeeder, output string) []model.Candle {
+		require.NoError(t, NewDownloader(feeder).Download(context.Background(), "BTCUSDT", "1h", output, interval))
+		candles, err := readCandles(output, "BTCUSDT", "1h")
+		require.NoError(t, err)
+		return candles
 	}
 
-	downloader := Downloader{fakeExchange}
+	t.Run("new file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		feeder := &fakeFeeder{}
+		candles := download(t, feeder, output)
+		require.Len(t, candles, 48)
+		require.Equal(t, []Gap{{Start: hour(0), End: hour(47)}}, feeder.requests)
+	})
 
-	t.Run("success", func(t *testing.T) {
-		err = downloader.Download(ctx, "BTCUSDT", "1d", tmpFile.Name(), WithInterval(param.Start, param.End))
-		require.NoError(t, err)
+	t.Run("already complete", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		require.NoError(t, writeCandles(output, "BTCUSDT", "1h", hourCandles(0, 48), 2))
+		feeder := &fakeFeeder{}
+		candles := download(t, feeder, output)
+		require.Len(t, candles, 48)
+		require.Empty(t, feeder.requests)
+	})
+
+	t.Run("interior gap", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		existing := append(hourCandles(0, 10), hourCandles(15, 48)...)
+		require.NoError(t, writeCandles(output, "BTCUSDT", "1h", existing, 2))
+		feeder := &fakeFeeder{}
+		candles := download(t, feeder, output)
+		require.Len(t, candles, 48)
+		require.Equal(t, []Gap{{Start: hour(10), End: hour(14)}}, feeder.requests)
+		require.Empty(t, Gaps(candles, hour(0), hour(47), time.Hour))
+	})
+
+	t.Run("duplicate rows", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		existing := append(hourCandles(0, 48), hourCandle(3), hourCandle(20))
+		require.NoError(t, writeCandles(output, "BTCUSDT", "1h", existing, 2))
+		feeder := &fakeFeeder{}
+		candles := download(t, feeder, output)
+		require.Len(t, candles, 48)
+		require.Empty(t, feeder.requests)
+	})
 
-		csvFeed, err := exchange.NewCSVFeed(
-			exchange.PairFeed{
-				Pair:      "BTCUSDT",
-				File:      "../testdata/btc-1d.csv",
-				Timeframe: "1d",
-			})
+	t.Run("exchange gap is skipped on the next run", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "BTCUSDT-1h.csv")
+		feeder := &fakeFeeder{empty: []Gap{{Start: hour(20), End: hour(23)}}}
+		candles := download(t, feeder, output)
+		require.Len(t, candles, 44)
+
+		gaps, err := readEmptyGaps(output)
 		require.NoError(t, err)
-		require.Len(t, csvFeed.CandlePairTimeFrame["BTCUSDT--1d"], 14)
+		require.Equal(t, []Gap{{Start: hour(20), End: hour(23)}}, gaps)
+
+		feeder.requests = nil
+		candles = download(t, feeder, output)
+		require.Len(t, candles, 44)
+		require.Empty(t, feeder.requests)
 	})
 }
+
+func TestGaps(t *testing.T) {
+	hour := func(index int) time.Time {
+		return downloadStart.Add(time.Duration(index) * time.Hour)
+	}
+	tests := []struct {
+		name    string
+		candles []model.Candle
+		want    []Gap
+	}{
+		{name: "empty", want: []Gap{{Start: hour(0), End: hour(9)}}},
+		{name: "complete", candles: hourCandles(0, 10)},
+		{name: "interior", candles: append(hourCandles(0, 3), hourCandles(5, 10)...),
+			want: []Gap{{Start: hour(3), End: hour(4)}}},
+		{name: "leading and trailing", candles: hourCandles(2, 8),
+			want: []Gap{{Start: hour(0), End: hour(1)}, {Start: hour(8), End: hour(9)}}},
+		{name: "outside range", candles: append(hourCandles(-5, 0), hourCandles(10, 12)...),
+			want: []Gap{{Start: hour(0), End: hour(9)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Gaps(tt.candles, hour(0), hour(9), time.Hour))
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	existing := hourCandle(1)
+	existing.Metadata = map[string]float64{"funding": 0.01}
+	replacement := hourCandle(1)
+	replacement.Close = 200
+
+	candles, duplicates := dedupe([]model.Candle{hourCandle(2), existing, hourCandle(0), replacement})
+	require.Equal(t, 1, duplicates)
+	require.Len(t, candles, 3)
+	for i, candle := range candles {
+		require.Equal(t, downloadStart.Add(time.Duration(i)*time.Hour), candle.Time)
+	}
+	// 同一时间保留最后出现的K线，并保留被替换K线的附加列
+	require.Equal(t, 200.0, candles[1].Close)
+	require.Equal(t, 0.01, candles[1].Metadata["funding"])
+}
+
+func TestSubtractGaps(t *testing.T) {
+	hour := func(index int) time.Time {
+		return downloadStart.Add(time.Duration(index) * time.Hour)
+	}
+	gaps := []Gap{{Start: hour(0), End: hour(9)}, {Start: hour(20), End: hour(22)}}
+	skip := []Gap{{Start: hour(3), End: hour(4)}, {Start: hour(8), End: hour(12)}, {Start: hour(20), End: hour(22)}}
+	require.Equal(t, []Gap{{Start: hour(0), End: hour(2)}, {Start: hour(5), End: hour(7)}}, subtractGaps(gaps, skip, time.Hour))
+}
@@ -0,0 +1,137 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"floolishman/model"
+)
+
+// Gap 连续缺失的K线区间，Start 与 End 均为缺失K线的开盘时间
+type Gap struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Count 区间内缺失的K线数量
+func (g Gap) Count(interval time.Duration) int {
+	return int(g.End.Sub(g.Start)/interval) + 1
+}
+
+// Gaps 按周期检查 [start, end] 范围内缺失的K线，candles 须已按时间排序且无重复
+func Gaps(candles []model.Candle, start, end time.Time, interval time.Duration) []Gap {
+	var gaps []Gap
+	expected := start
+	appendGap := func(to time.Time) {
+		if !to.Before(expected) {
+			gaps = append(gaps, Gap{Start: expected, End: to})
+		}
+	}
+	for _, candle := range candles {
+		if candle.Time.Before(start) {
+			continue
+		}
+		if candle.Time.After(end) {
+			break
+		}
+		appendGap(candle.Time.Add(-interval))
+		expected = candle.Time.Add(interval)
+	}
+	appendGap(end)
+	return gaps
+}
+
+// dedupe 按开盘时间排序并去重，同一时间保留最后出现的K线，返回重复的数量
+// 被替换K线中后者没有的附加列会保留下来
+func dedupe(candles []model.Candle) ([]model.Candle, int) {
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	result := make([]model.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if last := len(result) - 1; last >= 0 && result[last].Time.Equal(candle.Time) {
+			for name, value := range result[last].Metadata {
+				if _, ok := candle.Metadata[name]; ok {
+					continue
+				}
+				if candle.Metadata == nil {
+					candle.Metadata = make(map[string]float64, len(result[last].Metadata))
+				}
+				candle.Metadata[name] = value
+			}
+			result[last] = candle
+			continue
+		}
+		result = append(result, candle)
+	}
+	return result, len(candles) - len(result)
+}
+
+// EmptyGapsExt 记录交易所没有数据的区间的文件后缀，每行为 开始时间,结束时间 (RFC3339)
+// 增量下载时跳过这些区间，不再每次重复请求
+const EmptyGapsExt = ".gaps"
+
+// readEmptyGaps 读取 output 对应的无数据区间，文件不存在时返回空
+func readEmptyGaps(output string) ([]Gap, error) {
+	content, err := os.ReadFile(output + EmptyGapsExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var gaps []Gap
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", output+EmptyGapsExt, err)
+		}
+		end, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", output+EmptyGapsExt, err)
+		}
+		gaps = append(gaps, Gap{Start: start, End: end})
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].Start.Before(gaps[j].Start)
+	})
+	return gaps, nil
+}
+
+// writeEmptyGaps 写入 output 对应的无数据区间
+func writeEmptyGaps(output string, gaps []Gap) error {
+	var content strings.Builder
+	for _, gap := range gaps {
+		fmt.Fprintf(&content, "%s,%s\n", gap.Start.UTC().Format(time.RFC3339), gap.End.UTC().Format(time.RFC3339))
+	}
+	return os.WriteFile(output+EmptyGapsExt, []byte(content.String()), 0644)
+}
+
+// subtractGaps 从 gaps 中去除 skip (须按开始时间排序) 覆盖的K线
+func subtractGaps(gaps, skip []Gap, interval time.Duration) []Gap {
+	var result []Gap
+	for _, gap := range gaps {
+		start := gap.Start
+		for _, item := range skip {
+			if item.End.Before(start) || item.Start.After(gap.End) {
+				continue
+			}
+			if item.Start.After(start) {
+				result = append(result, Gap{Start: start, End: item.Start.Add(-interval)})
+			}
+			start = item.End.Add(interval)
+		}
+		if !start.After(gap.End) {
+			result = append(result, Gap{Start: start, End: gap.End})
+		}
+	}
+	return result
+}
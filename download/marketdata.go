@@ -0,0 +1,93 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"floolishman/exchange"
+	"floolishman/model"
+	"floolishman/reference"
+	"floolishman/utils"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// DownloadMarketData 下载合约市场数据写入 output (CSV)，回测时通过 PairFeed.MarketData 合并到K线 Metadata
+// output 已存在时只下载最后一条数据之后的部分
+func (d Downloader) DownloadMarketData(ctx context.Context, pair, dataset, period string, output string, options ...Option) error {
+	feeder, ok := d.exchange.(reference.MarketDataFeeder)
+	if !ok {
+		return errors.New("exchange does not provide market data, use futures")
+	}
+	columns, ok := exchange.MarketDataColumns[dataset]
+	if !ok {
+		return fmt.Errorf("invalid dataset: %s", dataset)
+	}
+
+	interval := exchange.FundingInterval
+	if dataset != exchange.MarketDataFunding {
+		var err error
+		if interval, err = str2duration.ParseDuration(period); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	parameters := newParameters(now, options...)
+	var existing []model.MarketData
+	if _, err := os.Stat(output); err == nil {
+		if existing, err = exchange.NewMarketDataFromCSV(output); err != nil {
+			return err
+		}
+	}
+	start := parameters.Start
+	if len(existing) > 0 && !existing[len(existing)-1].Time.Before(start) {
+		start = existing[len(existing)-1].Time.Add(time.Second)
+		// 统计周期数据按周期结束时间记录，即下一周期的开始时间
+		if dataset != exchange.MarketDataFunding {
+			start = existing[len(existing)-1].Time
+		}
+	}
+
+	utils.Log.Infof("Downloading %s of %s for %s since %s", dataset, period, pair, start.Format(time.RFC3339))
+	data := existing
+	for begin := start; begin.Before(parameters.End); begin = begin.Add(interval * batchSize) {
+		end := begin.Add(interval*batchSize - time.Second)
+		if end.After(parameters.End) {
+			end = parameters.End
+		}
+		items, err := feeder.MarketData(ctx, dataset, pair, period, begin, end)
+		if err != nil {
+			return err
+		}
+		// 未结束的统计周期数据仍会变化，不写入
+		for _, item := range items {
+			if !item.Time.After(now) {
+				data = append(data, item)
+			}
+		}
+	}
+
+	// 按时间去重，同一时间保留最新下载的数据
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Time.Before(data[j].Time)
+	})
+	result := make([]model.MarketData, 0, len(data))
+	for _, item := range data {
+		if last := len(result) - 1; last >= 0 && result[last].Time.Equal(item.Time) {
+			result[last] = item
+			continue
+		}
+		result = append(result, item)
+	}
+
+	if err := exchange.WriteMarketDataCSV(output, columns, result); err != nil {
+		return err
+	}
+	utils.Log.Infof("Done! %d records (%d new)", len(result), len(result)-len(existing))
+	return nil
+}
@@ -75,6 +75,7 @@ func NewBinance(ctx context.Context, options ...BinanceOption) (*Binance, error)
 	exchange.client = binance.NewClient(exchange.APIKey, exchange.APISecret)
 	exchange.client.KeyType = exchange.APIKeyType
 	exchange.client.Debug = futures.UseTestnet
+	exchange.client.HTTPClient = SpotRateLimiter.Client(exchange.client.HTTPClient)
 
 	err := exchange.client.NewPingService().Do(ctx)
 	if err != nil {
@@ -85,6 +86,11 @@ func NewBinance(ctx context.Context, options ...BinanceOption) (*Binance, error)
 	if err != nil {
 		return nil, err
 	}
+	limits := make([]rateLimit, 0, len(results.RateLimits))
+	for _, limit := range results.RateLimits {
+		limits = append(limits, rateLimit(limit))
+	}
+	SpotRateLimiter.SetLimits(rateLimits(limits))
 
 	// Initialize with orders precision and assets limits
 	exchange.assetsInfo = make(map[string]model.AssetInfo)
@@ -34,6 +34,8 @@ type BinanceFuture struct {
 	APISecret  string
 
 	ProxyOption types.ProxyOption
+	// 默认使用 FuturesRateLimiter，同一 IP 的多个实例共用权重
+	RateLimiter *RateLimiter
 
 	MetadataFetchers []MetadataFetchers
 	PairOptions      []model.PairOption
@@ -79,10 +81,17 @@ func WithBinanceFutureProxy(proxyUrl string) BinanceFutureOption {
 	}
 }
 
+// WithBinanceFutureRateLimiter 使用独立的 REST 限速器，如不同出口 IP 的账户
+func WithBinanceFutureRateLimiter(limiter *RateLimiter) BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.RateLimiter = limiter
+	}
+}
+
 // NewBinanceFuture will create a new BinanceFuture instance
 func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*BinanceFuture, error) {
 	binance.WebsocketKeepalive = true
-	exchange := &BinanceFuture{ctx: ctx}
+	exchange := &BinanceFuture{ctx: ctx, RateLimiter: FuturesRateLimiter}
 	for _, option := range options {
 		option(exchange)
 	}
@@ -97,6 +106,7 @@ func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*Bin
 
 	exchange.client.KeyType = exchange.APIKeyType
 	exchange.client.Debug = exchange.DebugMode
+	exchange.client.HTTPClient = exchange.RateLimiter.Client(exchange.client.HTTPClient)
 
 	err := exchange.client.NewPingService().Do(ctx)
 	if err != nil {
@@ -107,6 +117,11 @@ func NewBinanceFuture(ctx context.Context, options ...BinanceFutureOption) (*Bin
 	if err != nil {
 		return nil, err
 	}
+	limits := make([]rateLimit, 0, len(results.RateLimits))
+	for _, limit := range results.RateLimits {
+		limits = append(limits, rateLimit(limit))
+	}
+	exchange.RateLimiter.SetLimits(rateLimits(limits))
 
 	// Initialize with orders precision and assets limits
 	exchange.assetsInfo = make(map[string]model.AssetInfo)
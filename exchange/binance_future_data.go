@@ -0,0 +1,144 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils/httputil"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// MarketData 获取 [start, end] 范围内的合约市场数据，period 为统计周期，资金费率不使用 period
+// 持仓量、多空比及主动买卖量接口仅提供最近30天的数据
+// start/end 按接口的周期开始时间筛选，返回数据的时间为周期结束时间，见 marketDataTime
+func (b *BinanceFuture) MarketData(ctx context.Context, dataset, pair, period string, start, end time.Time) ([]model.MarketData, error) {
+	var interval time.Duration
+	if dataset != MarketDataFunding {
+		var err error
+		if interval, err = str2duration.ParseDuration(period); err != nil {
+			return nil, err
+		}
+	}
+	startTime, endTime := start.UnixMilli(), end.UnixMilli()
+	data := make([]model.MarketData, 0)
+	appendData := func(timestamp int64, values ...string) error {
+		item := model.MarketData{
+			Time:   marketDataTime(timestamp, interval),
+			Values: make(map[string]float64, len(values)),
+		}
+		for i, column := range MarketDataColumns[dataset] {
+			value, err := strconv.ParseFloat(values[i], 64)
+			if err != nil {
+				return err
+			}
+			item.Values[column] = value
+		}
+		data = append(data, item)
+		return nil
+	}
+
+	switch dataset {
+	case MarketDataFunding:
+		rates, err := b.client.NewFundingRateHistoryService().Symbol(pair).
+			StartTime(startTime).EndTime(endTime).Limit(1000).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, rate := range rates {
+			if err := appendData(rate.FundingTime, rate.FundingRate); err != nil {
+				return nil, err
+			}
+		}
+	case MarketDataOpenInterest:
+		stats, err := b.client.NewOpenInterestStatisticsService().Symbol(pair).Period(period).
+			StartTime(startTime).EndTime(endTime).Limit(500).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range stats {
+			if err := appendData(stat.Timestamp, stat.SumOpenInterest, stat.SumOpenInterestValue); err != nil {
+				return nil, err
+			}
+		}
+	case MarketDataLongShort:
+		var ratios []struct {
+			LongShortRatio string `json:"longShortRatio"`
+			LongAccount    string `json:"longAccount"`
+			ShortAccount   string `json:"shortAccount"`
+			Timestamp      int64  `json:"timestamp"`
+		}
+		if err := b.futuresData(ctx, "/futures/data/topLongShortPositionRatio", pair, period, startTime, endTime, &ratios); err != nil {
+			return nil, err
+		}
+		for _, ratio := range ratios {
+			if err := appendData(ratio.Timestamp, ratio.LongShortRatio, ratio.LongAccount, ratio.ShortAccount); err != nil {
+				return nil, err
+			}
+		}
+	case MarketDataTakerVolume:
+		var volumes []struct {
+			BuySellRatio string `json:"buySellRatio"`
+			BuyVol       string `json:"buyVol"`
+			SellVol      string `json:"sellVol"`
+			Timestamp    int64  `json:"timestamp"`
+		}
+		if err := b.futuresData(ctx, "/futures/data/takerlongshortRatio", pair, period, startTime, endTime, &volumes); err != nil {
+			return nil, err
+		}
+		for _, volume := range volumes {
+			if err := appendData(volume.Timestamp, volume.BuySellRatio, volume.BuyVol, volume.SellVol); err != nil {
+				return nil, err
+			}
+		}
+	case MarketDataMarkPrice:
+		klines, err := b.client.NewMarkPriceKlinesService().Symbol(pair).Interval(period).
+			StartTime(startTime).EndTime(endTime).Limit(1500).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, kline := range klines {
+			if err := appendData(kline.OpenTime, kline.Open, kline.High, kline.Low, kline.Close); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid dataset: %s", dataset)
+	}
+	return data, nil
+}
+
+// futuresData 请求 SDK 未封装的 /futures/data 统计接口，无需签名
+func (b *BinanceFuture) futuresData(ctx context.Context, endpoint, pair, period string, startTime, endTime int64, result interface{}) error {
+	params := url.Values{}
+	params.Set("symbol", pair)
+	params.Set("period", period)
+	params.Set("startTime", strconv.FormatInt(startTime, 10))
+	params.Set("endTime", strconv.FormatInt(endTime, 10))
+	params.Set("limit", "500")
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.client.BaseURL+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	client := b.client.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httputil.BodyCloser(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", endpoint, response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
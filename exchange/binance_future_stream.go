@@ -0,0 +1,204 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/jpillora/backoff"
+)
+
+// UserDataKeepalive listenKey 有效期为60分钟，按此间隔续期
+var UserDataKeepalive = 30 * time.Minute
+
+var ErrListenKeyExpired = errors.New("listen key expired")
+
+// UserDataSubscription 维护 listenKey 用户数据流，推送订单更新、仓位变化及追加保证金通知
+// 连接建立及断开时分别推送 UserDataConnected 与 UserDataDisconnected，断开或 listenKey 过期后自动重连
+func (b *BinanceFuture) UserDataSubscription(ctx context.Context) (chan model.UserDataEvent, chan error) {
+	cevent := make(chan model.UserDataEvent)
+	cerr := make(chan error)
+	send := func(event model.UserDataEvent) bool {
+		select {
+		case cevent <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(cevent)
+		defer close(cerr)
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 10 * time.Second,
+		}
+		// backoff 非并发安全，回调中仅标记收到过事件，由本协程重置
+		var received atomic.Bool
+		for {
+			err := b.serveUserData(ctx, &received, send, sendErr)
+			if received.Swap(false) {
+				ba.Reset()
+			}
+			if !send(model.UserDataEvent{Type: model.UserDataDisconnected, Time: time.Now()}) {
+				return
+			}
+			if err != nil {
+				sendErr(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+			}
+		}
+	}()
+	return cevent, cerr
+}
+
+// serveUserData 创建 listenKey 并连接数据流，连接断开、listenKey 过期或续期失败时返回，收到事件时置位 received
+func (b *BinanceFuture) serveUserData(ctx context.Context, received *atomic.Bool, send func(model.UserDataEvent) bool, sendErr func(error)) error {
+	listenKey, err := b.client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := b.client.NewCloseUserStreamService().ListenKey(listenKey).Do(context.Background()); err != nil {
+			utils.Log.Warnf("[USER DATA] close listen key: %s", err.Error())
+		}
+	}()
+
+	if b.ProxyOption.Status {
+		futures.SetWsProxyUrl(b.ProxyOption.Url)
+	}
+	expired := make(chan struct{}, 1)
+	done, stop, err := futures.WsUserDataServe(listenKey, func(event *futures.WsUserDataEvent) {
+		received.Store(true)
+		eventTime := time.UnixMilli(event.Time)
+		switch event.Event {
+		case futures.UserDataEventTypeListenKeyExpired:
+			select {
+			case expired <- struct{}{}:
+			default:
+			}
+		case futures.UserDataEventTypeOrderTradeUpdate:
+			send(model.UserDataEvent{
+				Type:  model.UserDataOrderUpdate,
+				Time:  eventTime,
+				Order: newFutureOrderUpdate(event.OrderTradeUpdate),
+			})
+		case futures.UserDataEventTypeAccountUpdate:
+			send(model.UserDataEvent{
+				Type:      model.UserDataAccountUpdate,
+				Time:      eventTime,
+				Positions: newFuturePositions(event.AccountUpdate.Positions),
+			})
+		case futures.UserDataEventTypeMarginCall:
+			send(model.UserDataEvent{
+				Type:      model.UserDataMarginCall,
+				Time:      eventTime,
+				Positions: newFuturePositions(event.MarginCallPositions),
+			})
+		}
+	}, sendErr)
+	if err != nil {
+		return err
+	}
+	utils.Log.Info("[USER DATA] Connected to user data stream.")
+	if !send(model.UserDataEvent{Type: model.UserDataConnected, Time: time.Now()}) {
+		close(stop)
+		return nil
+	}
+
+	keepalive := time.NewTicker(UserDataKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			close(stop)
+			return nil
+		case <-done:
+			return errors.New("user data stream disconnected")
+		case <-expired:
+			close(stop)
+			return ErrListenKeyExpired
+		case <-keepalive.C:
+			if err := b.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+				close(stop)
+				return err
+			}
+		}
+	}
+}
+
+// newFutureOrderUpdate 转换订单推送，已有成交时价格及数量为成交均价及累计成交量，与 newFutureOrder 一致
+func newFutureOrderUpdate(update futures.WsOrderTradeUpdate) model.Order {
+	price, _ := strconv.ParseFloat(update.AveragePrice, 64)
+	quantity, _ := strconv.ParseFloat(update.AccumulatedFilledQty, 64)
+	amount := price * quantity
+	if price == 0 || quantity == 0 {
+		price, _ = strconv.ParseFloat(update.OriginalPrice, 64)
+		quantity, _ = strconv.ParseFloat(update.OriginalQty, 64)
+		amount = 0
+	}
+	// 条件单触发后 Type 变为实际下单类型，使用原始类型与下单时保持一致
+	orderType := update.OriginalType
+	if orderType == "" {
+		orderType = update.Type
+	}
+	return model.Order{
+		ExchangeID:    update.ID,
+		ClientOrderId: update.ClientOrderID,
+		Pair:          update.Symbol,
+		Amount:        amount,
+		CreatedAt:     time.UnixMilli(update.TradeTime),
+		UpdatedAt:     time.UnixMilli(update.TradeTime),
+		Side:          model.SideType(update.Side),
+		PositionSide:  model.PositionSideType(update.PositionSide),
+		Type:          model.OrderType(orderType),
+		Status:        model.OrderStatusType(update.Status),
+		Price:         price,
+		Quantity:      quantity,
+	}
+}
+
+// newFuturePositions 转换推送的仓位，推送中不含杠杆倍数
+func newFuturePositions(items []futures.WsPosition) []model.Position {
+	positions := make([]model.Position, 0, len(items))
+	for _, item := range items {
+		avgPrice, _ := strconv.ParseFloat(item.EntryPrice, 64)
+		quantity, _ := strconv.ParseFloat(item.Amount, 64)
+		side := "SELL"
+		if item.Side == futures.PositionSideTypeLong {
+			side = "BUY"
+		}
+		// 推送中保证金模式为小写的 isolated | cross
+		marginType := "CROSSED"
+		if strings.EqualFold(string(item.MarginType), string(futures.MarginTypeIsolated)) {
+			marginType = "ISOLATED"
+		}
+		positions = append(positions, model.Position{
+			Pair:         item.Symbol,
+			Side:         side,
+			PositionSide: string(item.Side),
+			AvgPrice:     avgPrice,
+			Quantity:     quantity,
+			MarginType:   marginType,
+		})
+	}
+	return positions
+}
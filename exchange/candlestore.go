@@ -0,0 +1,347 @@
+package exchange
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"floolishman/model"
+)
+
+// CandleStoreExt 列式K线文件扩展名
+const CandleStoreExt = ".fcs"
+
+const (
+	candleStoreMagic   = "FLCS"
+	candleStoreVersion = 1
+)
+
+var ErrInvalidCandleStore = errors.New("invalid candle store")
+
+// 固定列，元数据列依次排在其后
+var candleStoreColumns = []string{"time", "open", "close", "low", "high", "volume"}
+
+// CandleStore 列式二进制K线文件
+//
+// 文件布局 (小端序):
+//
+//	magic "FLCS" | version uint16 | pair | timeframe | 元数据列名 | rows uint64
+//	time int64 * rows | open float64 * rows | close | low | high | volume | 元数据列 ...
+//
+// 字符串均以 uint16 长度前缀存储，时间为Unix秒
+// 每列定长且时间列有序，时间列即为索引，按时间定位只需二分读取时间列，读取区间时每列一次连续读取
+type CandleStore struct {
+	file      *os.File
+	pair      string
+	timeframe string
+	metadata  []string
+	rows      int
+	offset    int64
+}
+
+// OpenCandleStore 打开列式K线文件，仅读取文件头
+func OpenCandleStore(path string) (*CandleStore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &CandleStore{file: file}
+	if err := store.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return store, nil
+}
+
+func (s *CandleStore) readHeader() error {
+	reader := bufio.NewReader(s.file)
+	magic := make([]byte, len(candleStoreMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != candleStoreMagic {
+		return ErrInvalidCandleStore
+	}
+	var version uint16
+	if err := binary.Read(reader, binary.LittleEndian, &version); err != nil {
+		return err
+	}
+	if version != candleStoreVersion {
+		return fmt.Errorf("%w: version %d", ErrInvalidCandleStore, version)
+	}
+	var err error
+	size := int64(len(candleStoreMagic) + 2)
+	if s.pair, err = readStoreString(reader, &size); err != nil {
+		return err
+	}
+	if s.timeframe, err = readStoreString(reader, &size); err != nil {
+		return err
+	}
+	var columns uint16
+	if err := binary.Read(reader, binary.LittleEndian, &columns); err != nil {
+		return err
+	}
+	size += 2
+	for i := 0; i < int(columns); i++ {
+		name, err := readStoreString(reader, &size)
+		if err != nil {
+			return err
+		}
+		s.metadata = append(s.metadata, name)
+	}
+	var rows uint64
+	if err := binary.Read(reader, binary.LittleEndian, &rows); err != nil {
+		return err
+	}
+	s.rows = int(rows)
+	s.offset = size + 8
+	return nil
+}
+
+func readStoreString(reader io.Reader, size *int64) (string, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+		return "", err
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return "", err
+	}
+	*size += 2 + int64(length)
+	return string(value), nil
+}
+
+func (s *CandleStore) Close() error {
+	return s.file.Close()
+}
+
+func (s *CandleStore) Pair() string {
+	return s.pair
+}
+
+func (s *CandleStore) Timeframe() string {
+	return s.timeframe
+}
+
+// Metadata 附加列名称
+func (s *CandleStore) Metadata() []string {
+	return s.metadata
+}
+
+func (s *CandleStore) Len() int {
+	return s.rows
+}
+
+// readColumn 读取第 column 列 [from, to) 行的原始数据
+func (s *CandleStore) readColumn(column, from, to int) ([]uint64, error) {
+	buffer := make([]byte, (to-from)*8)
+	offset := s.offset + int64(column)*int64(s.rows)*8 + int64(from)*8
+	if _, err := s.file.ReadAt(buffer, offset); err != nil {
+		return nil, err
+	}
+	values := make([]uint64, to-from)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint64(buffer[i*8:])
+	}
+	return values, nil
+}
+
+// Search 返回第一根开盘时间不早于 t 的K线位置，不存在时返回 Len()
+func (s *CandleStore) Search(t time.Time) (int, error) {
+	var err error
+	index := sort.Search(s.rows, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var values []uint64
+		values, err = s.readColumn(0, i, i+1)
+		if err != nil {
+			return true
+		}
+		return int64(values[0]) >= t.Unix()
+	})
+	return index, err
+}
+
+// Read 读取 [from, to) 行的K线
+func (s *CandleStore) Read(from, to int) ([]model.Candle, error) {
+	from = max(from, 0)
+	to = min(to, s.rows)
+	if from >= to {
+		return nil, nil
+	}
+	columns := make([][]uint64, len(candleStoreColumns)+len(s.metadata))
+	for i := range columns {
+		values, err := s.readColumn(i, from, to)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = values
+	}
+	candles := make([]model.Candle, to-from)
+	for i := range candles {
+		candleTime := time.Unix(int64(columns[0][i]), 0).UTC()
+		candles[i] = model.Candle{
+			Pair:      s.pair,
+			Time:      candleTime,
+			UpdatedAt: candleTime,
+			Open:      math.Float64frombits(columns[1][i]),
+			Close:     math.Float64frombits(columns[2][i]),
+			Low:       math.Float64frombits(columns[3][i]),
+			High:      math.Float64frombits(columns[4][i]),
+			Volume:    math.Float64frombits(columns[5][i]),
+			Complete:  true,
+		}
+		if len(s.metadata) > 0 {
+			candles[i].Metadata = make(map[string]float64, len(s.metadata))
+			for j, name := range s.metadata {
+				candles[i].Metadata[name] = math.Float64frombits(columns[len(candleStoreColumns)+j][i])
+			}
+		}
+	}
+	return candles, nil
+}
+
+// Range 读取开盘时间在 [start, end] 范围内的K线
+func (s *CandleStore) Range(start, end time.Time) ([]model.Candle, error) {
+	from, err := s.Search(start)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.Search(end.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return s.Read(from, to)
+}
+
+// CandleMetadata 所有K线附加列名称的并集，按名称排序
+func CandleMetadata(candles []model.Candle) []string {
+	names := make(map[string]bool)
+	for _, candle := range candles {
+		for name := range candle.Metadata {
+			names[name] = true
+		}
+	}
+	metadata := make([]string, 0, len(names))
+	for name := range names {
+		metadata = append(metadata, name)
+	}
+	sort.Strings(metadata)
+	return metadata
+}
+
+// WriteCandleStore 将按时间排序的K线写入列式文件，元数据列取所有K线附加列的并集
+func WriteCandleStore(path, pair, timeframe string, candles []model.Candle) error {
+	metadata := CandleMetadata(candles)
+	if len(metadata) > math.MaxUint16 {
+		return fmt.Errorf("%w: too many columns", ErrInvalidCandleStore)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	writer.WriteString(candleStoreMagic)
+	binary.Write(writer, binary.LittleEndian, uint16(candleStoreVersion))
+	writeStoreString(writer, pair)
+	writeStoreString(writer, timeframe)
+	binary.Write(writer, binary.LittleEndian, uint16(len(metadata)))
+	for _, name := range metadata {
+		writeStoreString(writer, name)
+	}
+	binary.Write(writer, binary.LittleEndian, uint64(len(candles)))
+
+	buffer := make([]byte, 8)
+	columns := append(append([]string{}, candleStoreColumns...), metadata...)
+	for i, name := range columns {
+		for _, candle := range candles {
+			var value uint64
+			switch i {
+			case 0:
+				value = uint64(candle.Time.Unix())
+			case 1:
+				value = math.Float64bits(candle.Open)
+			case 2:
+				value = math.Float64bits(candle.Close)
+			case 3:
+				value = math.Float64bits(candle.Low)
+			case 4:
+				value = math.Float64bits(candle.High)
+			case 5:
+				value = math.Float64bits(candle.Volume)
+			default:
+				value = math.Float64bits(candle.Metadata[name])
+			}
+			binary.LittleEndian.PutUint64(buffer, value)
+			if _, err := writer.Write(buffer); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeStoreString(writer *bufio.Writer, value string) {
+	binary.Write(writer, binary.LittleEndian, uint16(len(value)))
+	writer.WriteString(value)
+}
+
+// IsCandleStore 判断文件是否为列式K线文件
+func IsCandleStore(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), CandleStoreExt)
+}
+
+// ConvertCSVToCandleStore 将 CSV K线文件转换为列式文件
+func ConvertCSVToCandleStore(input, output, pair, timeframe string) (int, error) {
+	candles, err := NewCandlesFromCSV(PairFeed{Pair: pair, File: input, Timeframe: timeframe})
+	if err != nil {
+		return 0, err
+	}
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return len(candles), WriteCandleStore(output, pair, timeframe, candles)
+}
+
+// NewCandlesFromStore 读取交易对列式K线文件，不做重采样
+func NewCandlesFromStore(feed PairFeed) ([]model.Candle, error) {
+	store, err := OpenCandleStore(feed.File)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	candles, err := store.Read(0, store.Len())
+	if err != nil {
+		return nil, err
+	}
+	ha := model.NewHeikinAshi()
+	for i := range candles {
+		candles[i].Pair = feed.Pair
+		if feed.HeikinAshi {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+	return candles, nil
+}
+
+// FeedFile 返回 {dir}/{pair}-{timeframe} K线文件路径，存在列式文件时优先使用，否则使用 CSV
+func FeedFile(dir, pair, timeframe string) string {
+	name := filepath.Join(dir, fmt.Sprintf("%s-%s", pair, timeframe))
+	if _, err := os.Stat(name + CandleStoreExt); err == nil {
+		return name + CandleStoreExt
+	}
+	return name + ".csv"
+}
@@ -0,0 +1,109 @@
+package exchange
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"floolishman/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func storeCandles(count int) []model.Candle {
+	candles := make([]model.Candle, 0, count)
+	for i := 0; i < count; i++ {
+		candle := paperCandle(i, 100+float64(i), 101+float64(i), 99+float64(i), 100.5+float64(i), 10)
+		candle.Metadata = map[string]float64{"funding": float64(i) / 1000}
+		// 后半段K线带有额外列，写入时取并集
+		if i >= count/2 {
+			candle.Metadata["open_interest"] = float64(i)
+		}
+		candles = append(candles, candle)
+	}
+	return candles
+}
+
+func TestCandleStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BTCUSDT-1m"+CandleStoreExt)
+	candles := storeCandles(10)
+	require.NoError(t, WriteCandleStore(path, "BTCUSDT", "1m", candles))
+
+	store, err := OpenCandleStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	require.Equal(t, "BTCUSDT", store.Pair())
+	require.Equal(t, "1m", store.Timeframe())
+	require.Equal(t, []string{"funding", "open_interest"}, store.Metadata())
+	require.Equal(t, 10, store.Len())
+
+	read, err := store.Read(0, store.Len())
+	require.NoError(t, err)
+	require.Len(t, read, 10)
+	for i, candle := range read {
+		require.True(t, candle.Time.Equal(candles[i].Time))
+		require.Equal(t, candles[i].Open, candle.Open)
+		require.Equal(t, candles[i].High, candle.High)
+		require.Equal(t, candles[i].Low, candle.Low)
+		require.Equal(t, candles[i].Close, candle.Close)
+		require.Equal(t, candles[i].Volume, candle.Volume)
+		require.Equal(t, candles[i].Metadata["funding"], candle.Metadata["funding"])
+		require.Equal(t, candles[i].Metadata["open_interest"], candle.Metadata["open_interest"])
+	}
+
+	tests := []struct {
+		name string
+		time time.Time
+		want int
+	}{
+		{name: "before first", time: paperStart.Add(-time.Hour), want: 0},
+		{name: "exact", time: paperStart.Add(3 * time.Minute), want: 3},
+		{name: "between candles", time: paperStart.Add(3*time.Minute + time.Second), want: 4},
+		{name: "after last", time: paperStart.Add(time.Hour), want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := store.Search(tt.time)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, index)
+		})
+	}
+
+	ranged, err := store.Range(paperStart.Add(2*time.Minute), paperStart.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, ranged, 3)
+	require.True(t, ranged[0].Time.Equal(paperStart.Add(2*time.Minute)))
+}
+
+func TestStoreFeed_PeriodAndWarmup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BTCUSDT-1m"+CandleStoreExt)
+	require.NoError(t, WriteCandleStore(path, "BTCUSDT", "1m", storeCandles(10)))
+
+	feed, err := NewStoreFeed(PairFeed{Pair: "BTCUSDT", File: path, Timeframe: "1m"})
+	require.NoError(t, err)
+	defer feed.Close()
+	_, err = feed.Period(paperStart.Add(2*time.Minute), paperStart.Add(8*time.Minute))
+	require.NoError(t, err)
+
+	warmup, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", "1m", 2)
+	require.NoError(t, err)
+	require.Len(t, warmup, 2)
+	require.True(t, warmup[0].Time.Equal(paperStart.Add(2*time.Minute)))
+
+	ccandle, cerr := feed.CandlesSubscription(context.Background(), "BTCUSDT", "1m")
+	var streamed []time.Time
+	for candle := range ccandle {
+		streamed = append(streamed, candle.Time)
+	}
+	require.NoError(t, <-cerr)
+	require.Equal(t, []time.Time{
+		paperStart.Add(4 * time.Minute),
+		paperStart.Add(5 * time.Minute),
+		paperStart.Add(6 * time.Minute),
+		paperStart.Add(7 * time.Minute),
+	}, streamed)
+
+	origins := feed.OriginCandles("BTCUSDT", paperStart, paperStart.Add(time.Minute))
+	require.Len(t, origins, 2)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/xhit/go-str2duration/v2"
 	"math"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -22,6 +23,8 @@ type PairFeed struct {
 	File       string
 	Timeframe  string
 	HeikinAshi bool
+	// 合并到K线 Metadata 的市场数据文件
+	MarketData []string
 }
 
 type CSVFeed struct {
@@ -68,89 +71,124 @@ func parseHeaders(headers []string) (index map[string]int, additional []string,
 	return headerMap, additional, true
 }
 
-// NewCSVFeed creates a new data feed from CSV files and resample
-func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
-	csvFeed := &CSVFeed{
-		Feeds:                     make(map[string]PairFeed),
-		CandlePairTimeFrame:       make(map[string][]model.Candle),
-		OriginCandlePairTimeFrame: make(map[string][]model.Candle),
+// NewCandlesFromCSV 读取交易对K线文件，不做重采样
+func NewCandlesFromCSV(feed PairFeed) ([]model.Candle, error) {
+	csvFile, err := os.Open(feed.File)
+	if err != nil {
+		return nil, err
 	}
+	defer csvFile.Close()
 
-	for _, feed := range feeds {
-		csvFeed.Feeds[feed.Pair] = feed
+	csvLines, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var candles []model.Candle
+	ha := model.NewHeikinAshi()
 
-		csvFile, err := os.Open(feed.File)
+	// map each header label with its index
+	headerMap, additionalHeaders, hasCustomHeaders := parseHeaders(csvLines[0])
+	if hasCustomHeaders {
+		csvLines = csvLines[1:]
+	}
+
+	for _, line := range csvLines {
+		timestamp, err := strconv.Atoi(line[headerMap["time"]])
 		if err != nil {
 			return nil, err
 		}
 
-		csvLines, err := csv.NewReader(csvFile).ReadAll()
+		candle := model.Candle{
+			Time:      time.Unix(int64(timestamp), 0).UTC(),
+			UpdatedAt: time.Unix(int64(timestamp), 0).UTC(),
+			Pair:      feed.Pair,
+			Complete:  true,
+		}
+
+		candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
 		if err != nil {
 			return nil, err
 		}
 
-		var candles []model.Candle
-		ha := model.NewHeikinAshi()
+		candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-		// map each header label with its index
-		headerMap, additionalHeaders, hasCustomHeaders := parseHeaders(csvLines[0])
-		if hasCustomHeaders {
-			csvLines = csvLines[1:]
+		candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
+		if err != nil {
+			return nil, err
 		}
 
-		for _, line := range csvLines {
-			timestamp, err := strconv.Atoi(line[headerMap["time"]])
-			if err != nil {
-				return nil, err
-			}
+		candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-			candle := model.Candle{
-				Time:      time.Unix(int64(timestamp), 0).UTC(),
-				UpdatedAt: time.Unix(int64(timestamp), 0).UTC(),
-				Pair:      feed.Pair,
-				Complete:  true,
-			}
+		candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-			candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
-			if err != nil {
-				return nil, err
+		if hasCustomHeaders {
+			candle.Metadata = make(map[string]float64)
+			for _, header := range additionalHeaders {
+				candle.Metadata[header], err = strconv.ParseFloat(line[headerMap[header]], 64)
+				if err != nil {
+					return nil, err
+				}
 			}
+		}
 
-			candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
-			if err != nil {
-				return nil, err
-			}
+		if feed.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
 
-			candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
-			if err != nil {
-				return nil, err
-			}
+		candles = append(candles, candle)
+	}
 
-			candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
-			if err != nil {
-				return nil, err
-			}
+	return candles, nil
+}
 
-			candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
-			if err != nil {
-				return nil, err
-			}
+// NewCandlesFromFile 按扩展名读取 CSV 或列式K线文件并合并市场数据，不做重采样
+func NewCandlesFromFile(feed PairFeed) ([]model.Candle, error) {
+	var (
+		candles []model.Candle
+		err     error
+	)
+	if IsCandleStore(feed.File) {
+		candles, err = NewCandlesFromStore(feed)
+	} else {
+		candles, err = NewCandlesFromCSV(feed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range feed.MarketData {
+		data, err := NewMarketDataFromCSV(file)
+		if err != nil {
+			return nil, err
+		}
+		MergeMarketData(candles, data)
+	}
+	return candles, nil
+}
 
-			if hasCustomHeaders {
-				candle.Metadata = make(map[string]float64)
-				for _, header := range additionalHeaders {
-					candle.Metadata[header], err = strconv.ParseFloat(line[headerMap[header]], 64)
-					if err != nil {
-						return nil, err
-					}
-				}
-			}
+// NewCSVFeed creates a new data feed from CSV files and resample
+func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
+	csvFeed := &CSVFeed{
+		Feeds:                     make(map[string]PairFeed),
+		CandlePairTimeFrame:       make(map[string][]model.Candle),
+		OriginCandlePairTimeFrame: make(map[string][]model.Candle),
+	}
 
-			if feed.HeikinAshi {
-				candle = candle.ToHeikinAshi(ha)
-			}
+	for _, feed := range feeds {
+		csvFeed.Feeds[feed.Pair] = feed
 
-			candles = append(candles, candle)
+		candles, err := NewCandlesFromFile(feed)
+		if err != nil {
+			return nil, err
 		}
 
 		csvFeed.OriginCandlePairTimeFrame[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)] = candles
@@ -175,6 +213,23 @@ func (c CSVFeed) LastQuote(_ context.Context, _ string) (float64, error) {
 	return 0, errors.New("invalid operation")
 }
 
+// OriginCandles 返回原始周期中 [start, end] 范围内的K线
+func (c *CSVFeed) OriginCandles(pair string, start, end time.Time) []model.Candle {
+	feed, ok := c.Feeds[pair]
+	if !ok {
+		return nil
+	}
+	candles := c.OriginCandlePairTimeFrame[c.feedTimeframeKey(pair, feed.Timeframe)]
+	from := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Time.Before(start)
+	})
+	to := from
+	for to < len(candles) && !candles[to].Time.After(end) {
+		to++
+	}
+	return candles[from:to]
+}
+
 func (c *CSVFeed) Limit(duration time.Duration) *CSVFeed {
 	for pair, candles := range c.CandlePairTimeFrame {
 		start := candles[len(candles)-1].Time.Add(-duration)
@@ -185,6 +240,26 @@ func (c *CSVFeed) Limit(duration time.Duration) *CSVFeed {
 	return c
 }
 
+// Period 仅保留 [start, end) 范围内的K线，零值表示不限制，用于分段回测
+func (c *CSVFeed) Period(start, end time.Time) *CSVFeed {
+	inPeriod := func(candle model.Candle, _ int) bool {
+		if !start.IsZero() && candle.Time.Before(start) {
+			return false
+		}
+		if !end.IsZero() && !candle.Time.Before(end) {
+			return false
+		}
+		return true
+	}
+	for key, candles := range c.CandlePairTimeFrame {
+		c.CandlePairTimeFrame[key] = lo.Filter(candles, inPeriod)
+	}
+	for key, candles := range c.OriginCandlePairTimeFrame {
+		c.OriginCandlePairTimeFrame[key] = lo.Filter(candles, inPeriod)
+	}
+	return c
+}
+
 func isFistCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (bool, error) {
 	fromDuration, err := str2duration.ParseDuration(fromTimeframe)
 	if err != nil {
@@ -236,6 +311,75 @@ func isLastCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (boo
 	return false, fmt.Errorf("invalid timeframe: %s", targetTimeframe)
 }
 
+// Resample 将各交易对的原始K线重采样到多个周期，用于回测多周期组合策略，已存在的周期不重复处理
+func (c *CSVFeed) Resample(timeframes ...string) error {
+	for pair, feed := range c.Feeds {
+		for _, timeframe := range timeframes {
+			if _, ok := c.CandlePairTimeFrame[c.feedTimeframeKey(pair, timeframe)]; ok {
+				continue
+			}
+			if err := c.resample(pair, feed.Timeframe, timeframe); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AlignWarmup 对齐各周期的预热区间
+// 各周期预热所需K线数量不同，分别截取时预热结束时间不一致，大周期会提前看到小周期尚未回放的行情
+// 此处以各周期满足预热数量的最晚收盘时间为准，丢弃更早的多余K线，使 CandlesByLimit 预热后各周期从同一时刻开始回放
+func (c *CSVFeed) AlignWarmup(warmup map[string]int) error {
+	intervals := make(map[string]time.Duration)
+	for timeframe := range warmup {
+		interval, err := str2duration.ParseDuration(timeframe)
+		if err != nil {
+			return err
+		}
+		intervals[timeframe] = interval
+	}
+
+	for pair := range c.Feeds {
+		var end time.Time
+		for timeframe, period := range warmup {
+			complete := 0
+			for _, candle := range c.CandlePairTimeFrame[c.feedTimeframeKey(pair, timeframe)] {
+				if !candle.Complete {
+					continue
+				}
+				complete++
+				if complete == period {
+					if closeTime := candle.Time.Add(intervals[timeframe]); closeTime.After(end) {
+						end = closeTime
+					}
+					break
+				}
+			}
+		}
+		if end.IsZero() {
+			continue
+		}
+
+		for timeframe, period := range warmup {
+			key := c.feedTimeframeKey(pair, timeframe)
+			candles := c.CandlePairTimeFrame[key]
+			closed := make([]int, 0)
+			for i, candle := range candles {
+				if candle.Time.Add(intervals[timeframe]).After(end) {
+					break
+				}
+				if candle.Complete {
+					closed = append(closed, i)
+				}
+			}
+			if len(closed) > period {
+				c.CandlePairTimeFrame[key] = candles[closed[len(closed)-period-1]+1:]
+			}
+		}
+	}
+	return nil
+}
+
 func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error {
 	sourceKey := c.feedTimeframeKey(pair, sourceTimeframe)
 	targetKey := c.feedTimeframeKey(pair, targetTimeframe)
@@ -245,6 +389,18 @@ func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error
 		return nil
 	}
 
+	sourceDuration, err := str2duration.ParseDuration(sourceTimeframe)
+	if err != nil {
+		return err
+	}
+	targetDuration, err := str2duration.ParseDuration(targetTimeframe)
+	if err != nil {
+		return err
+	}
+	if targetDuration < sourceDuration || targetDuration%sourceDuration != 0 {
+		return fmt.Errorf("%s: can not resample %s to %s", pair, sourceTimeframe, targetTimeframe)
+	}
+
 	var i int
 	for ; i < len(c.OriginCandlePairTimeFrame[sourceKey]); i++ {
 		if ok, err := isFistCandlePeriod(c.OriginCandlePairTimeFrame[sourceKey][i].Time, sourceTimeframe,
@@ -278,7 +434,7 @@ func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error
 	}
 
 	// remove last candle if not complete
-	if !candles[len(candles)-1].Complete {
+	if len(candles) > 0 && !candles[len(candles)-1].Complete {
 		candles = candles[:len(candles)-1]
 	}
 
@@ -343,13 +499,14 @@ func (c CSVFeed) CandlesBatchSubscription(ctx context.Context, combineConfig map
 		pairCcandle[c.feedTimeframeKey(pair, timeframe)] = make(chan model.Candle)
 	}
 
-	for feedKey, candles := range c.CandlePairTimeFrame {
-		go func(feedKey string, candles []model.Candle) {
+	// 仅推送订阅的交易对周期，无数据时直接关闭
+	for feedKey, ccandle := range pairCcandle {
+		go func(candles []model.Candle, ccandle chan model.Candle) {
 			for _, candle := range candles {
-				pairCcandle[feedKey] <- candle
+				ccandle <- candle
 			}
-			close(pairCcandle[feedKey])
-		}(feedKey, candles)
+			close(ccandle)
+		}(c.CandlePairTimeFrame[feedKey], ccandle)
 	}
 	close(cerr)
 	return pairCcandle, cerr
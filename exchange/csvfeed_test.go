@@ -0,0 +1,198 @@
+package exchange
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"floolishman/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+// minuteCandles 自 paperStart 起第 from 至 to-1 分钟的1分钟K线，高低点不单调以检验重采样的极值
+func minuteCandles(from, to int) []model.Candle {
+	candles := make([]model.Candle, 0, to-from)
+	for i := from; i < to; i++ {
+		candleTime := paperStart.Add(time.Duration(i) * time.Minute)
+		candles = append(candles, model.Candle{
+			Pair:      "BTCUSDT",
+			Time:      candleTime,
+			UpdatedAt: candleTime,
+			Open:      100 + float64(i),
+			Close:     100.5 + float64(i),
+			High:      101 + float64(i) + float64(i%5),
+			Low:       99 + float64(i) - float64(i%4),
+			Volume:    1 + float64(i%3),
+			Complete:  true,
+			Metadata:  map[string]float64{},
+		})
+	}
+	return candles
+}
+
+func newTestCSVFeed(t *testing.T, candles []model.Candle) *CSVFeed {
+	file := filepath.Join(t.TempDir(), "BTCUSDT-1m.csv")
+	csvFile, err := os.Create(file)
+	require.NoError(t, err)
+	writer := csv.NewWriter(csvFile)
+	require.NoError(t, writer.Write([]string{"time", "open", "close", "low", "high", "volume"}))
+	for _, candle := range candles {
+		require.NoError(t, writer.Write(candle.ToSlice(-1)))
+	}
+	writer.Flush()
+	require.NoError(t, writer.Error())
+	require.NoError(t, csvFile.Close())
+
+	feed, err := NewCSVFeed("1m", PairFeed{Pair: "BTCUSDT", File: file, Timeframe: "1m"})
+	require.NoError(t, err)
+	return feed
+}
+
+// aggregate 将连续的1分钟K线合并为一根收盘K线
+func aggregate(candles []model.Candle) model.Candle {
+	result := candles[0]
+	for _, candle := range candles[1:] {
+		result.High = max(result.High, candle.High)
+		result.Low = min(result.Low, candle.Low)
+		result.Volume += candle.Volume
+	}
+	last := candles[len(candles)-1]
+	result.Close = last.Close
+	result.UpdatedAt = last.UpdatedAt
+	return result
+}
+
+func completeCandles(candles []model.Candle) []model.Candle {
+	result := make([]model.Candle, 0)
+	for _, candle := range candles {
+		if candle.Complete {
+			result = append(result, candle)
+		}
+	}
+	return result
+}
+
+func TestCSVFeed_Resample(t *testing.T) {
+	// 自 00:07 开始，首个不完整的15分钟周期被跳过
+	source := minuteCandles(7, 187)
+	feed := newTestCSVFeed(t, source)
+	require.NoError(t, feed.Resample("15m", "1h"))
+
+	tests := []struct {
+		timeframe string
+		minutes   int
+		count     int
+	}{
+		{timeframe: "15m", minutes: 15, count: 11},
+		{timeframe: "1h", minutes: 60, count: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timeframe, func(t *testing.T) {
+			candles := feed.CandlePairTimeFrame[feed.feedTimeframeKey("BTCUSDT", tt.timeframe)]
+			complete := completeCandles(candles)
+			require.Len(t, complete, tt.count)
+
+			// 首根K线起始于第一个完整周期，其后每根原始K线对应一次推送
+			first := paperStart.Add(time.Duration(tt.minutes) * time.Minute)
+			require.Equal(t, first, candles[0].Time)
+			for i, candle := range candles {
+				require.Equal(t, first.Add(time.Duration(i)*time.Minute), candle.UpdatedAt)
+			}
+
+			for i, candle := range complete {
+				start := tt.minutes*(i+1) - 7
+				want := aggregate(source[start : start+tt.minutes])
+				require.Equal(t, first.Add(time.Duration(i*tt.minutes)*time.Minute), candle.Time)
+				require.Equal(t, want, candle)
+			}
+		})
+	}
+
+	t.Run("existing timeframe is kept", func(t *testing.T) {
+		key := feed.feedTimeframeKey("BTCUSDT", "15m")
+		feed.CandlePairTimeFrame[key] = feed.CandlePairTimeFrame[key][:1]
+		require.NoError(t, feed.Resample("15m"))
+		require.Len(t, feed.CandlePairTimeFrame[key], 1)
+	})
+
+	t.Run("invalid timeframe", func(t *testing.T) {
+		require.Error(t, feed.Resample("7m"))
+		require.Error(t, newTestCSVFeed(t, source).Resample("30s"))
+	})
+}
+
+// replay 按 bot.backtestCandles 的规则合并各周期K线：UpdatedAt 最早者优先，相同时小周期优先
+func replay(feed *CSVFeed, timeframes []string) ([]string, []model.Candle) {
+	queues := make(map[string][]model.Candle)
+	for _, timeframe := range timeframes {
+		queues[timeframe] = feed.CandlePairTimeFrame[feed.feedTimeframeKey("BTCUSDT", timeframe)]
+	}
+	var (
+		order  []string
+		result []model.Candle
+	)
+	for {
+		var (
+			timeframe string
+			candle    model.Candle
+		)
+		for _, item := range timeframes {
+			if len(queues[item]) == 0 {
+				continue
+			}
+			if next := queues[item][0]; timeframe == "" || next.UpdatedAt.Before(candle.UpdatedAt) {
+				timeframe, candle = item, next
+			}
+		}
+		if timeframe == "" {
+			return order, result
+		}
+		queues[timeframe] = queues[timeframe][1:]
+		order = append(order, timeframe)
+		result = append(result, candle)
+	}
+}
+
+func TestCSVFeed_AlignWarmup(t *testing.T) {
+	source := minuteCandles(0, 240)
+	feed := newTestCSVFeed(t, source)
+	warmup := map[string]int{"1m": 30, "15m": 4, "1h": 2}
+	timeframes := []string{"1m", "15m", "1h"}
+	require.NoError(t, feed.Resample(timeframes...))
+	require.NoError(t, feed.AlignWarmup(warmup))
+
+	// 1h 需要2根收盘K线，预热以 02:00 收盘为准，各周期的预热区间在同一时刻结束
+	end := paperStart.Add(2 * time.Hour)
+	intervals := map[string]time.Duration{"1m": time.Minute, "15m": 15 * time.Minute, "1h": time.Hour}
+	for _, timeframe := range timeframes {
+		candles, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", timeframe, warmup[timeframe])
+		require.NoError(t, err)
+		require.Len(t, candles, warmup[timeframe])
+		require.Equal(t, end, candles[len(candles)-1].Time.Add(intervals[timeframe]), timeframe)
+	}
+
+	order, replayed := replay(feed, timeframes)
+	require.NotEmpty(t, replayed)
+	require.Equal(t, "1m", order[0])
+	require.Equal(t, end, replayed[0].Time)
+
+	// 大周期K线紧随构成它的1分钟K线回放，不会提前看到尚未回放的行情
+	var last model.Candle
+	minutes := 0
+	for i, candle := range replayed {
+		require.False(t, candle.Time.Before(end))
+		if order[i] == "1m" {
+			require.Equal(t, source[120+minutes], candle)
+			last = candle
+			minutes++
+			continue
+		}
+		require.Equal(t, last.UpdatedAt, candle.UpdatedAt)
+		require.Equal(t, last.Close, candle.Close)
+	}
+	require.Equal(t, 120, minutes)
+}
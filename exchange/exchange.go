@@ -97,16 +97,29 @@ func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.C
 func (d *DataFeedSubscription) BatchConnect() {
 	utils.Log.Infof("Batch connecting to the exchange.")
 
-	combineConfig := map[string]string{}
+	// combineConfig 中每个交易对只能对应一个周期，多周期时按周期分为多组订阅
+	combineConfigs := []map[string]string{}
 	for feed := range d.Feeds.Iter() {
 		pair, timeframe := d.pairTimeframeFromKey(feed)
-		combineConfig[pair] = timeframe
+		grouped := false
+		for _, combineConfig := range combineConfigs {
+			if _, ok := combineConfig[pair]; !ok {
+				combineConfig[pair] = timeframe
+				grouped = true
+				break
+			}
+		}
+		if !grouped {
+			combineConfigs = append(combineConfigs, map[string]string{pair: timeframe})
+		}
 	}
-	pairCcandle, cerr := d.exchange.CandlesBatchSubscription(context.Background(), combineConfig)
-	for feed, ccandle := range pairCcandle {
-		d.DataFeeds[feed] = &DataFeed{
-			Data: ccandle,
-			Err:  cerr,
+	for _, combineConfig := range combineConfigs {
+		pairCcandle, cerr := d.exchange.CandlesBatchSubscription(context.Background(), combineConfig)
+		for feed, ccandle := range pairCcandle {
+			d.DataFeeds[feed] = &DataFeed{
+				Data: ccandle,
+				Err:  cerr,
+			}
 		}
 	}
 }
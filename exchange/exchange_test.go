@@ -0,0 +1,37 @@
+package exchange
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"floolishman/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataFeedSubscription_BatchMultiTimeframe(t *testing.T) {
+	feed := &CSVFeed{CandlePairTimeFrame: map[string][]model.Candle{
+		"BTCUSDT--1m":  {{Pair: "BTCUSDT", Complete: true}, {Pair: "BTCUSDT", Complete: true}},
+		"BTCUSDT--15m": {{Pair: "BTCUSDT", Complete: true}},
+		"ETHUSDT--1m":  {{Pair: "ETHUSDT", Complete: true}},
+		// 未订阅的周期不推送
+		"ETHUSDT--1h": {{Pair: "ETHUSDT", Complete: true}},
+	}}
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 0), WithDataFeed(feed))
+	subscription := NewDataFeed(wallet)
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	consumer := func(timeframe string, candle model.Candle) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[candle.Pair+"--"+timeframe]++
+	}
+	subscription.Subscribe("BTCUSDT", "1m", consumer, false)
+	subscription.Subscribe("BTCUSDT", "15m", consumer, false)
+	subscription.Subscribe("ETHUSDT", "1m", consumer, false)
+	subscription.Start(true, true)
+
+	require.Equal(t, map[string]int{"BTCUSDT--1m": 2, "BTCUSDT--15m": 1, "ETHUSDT--1m": 1}, counts)
+}
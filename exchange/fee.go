@@ -0,0 +1,31 @@
+package exchange
+
+import "floolishman/model"
+
+// FeeTier 手续费费率
+type FeeTier struct {
+	Maker float64
+	Taker float64
+}
+
+// FeeTiers 币安U本位合约 VIP0 - VIP9 手续费等级
+var FeeTiers = []FeeTier{
+	{Maker: 0.0002, Taker: 0.0005},
+	{Maker: 0.00016, Taker: 0.0004},
+	{Maker: 0.00014, Taker: 0.00035},
+	{Maker: 0.00012, Taker: 0.00032},
+	{Maker: 0.0001, Taker: 0.0003},
+	{Maker: 0.00008, Taker: 0.00027},
+	{Maker: 0.00006, Taker: 0.00025},
+	{Maker: 0.00004, Taker: 0.00022},
+	{Maker: 0.00002, Taker: 0.0002},
+	{Maker: 0, Taker: 0.00017},
+}
+
+// BNBDiscount 合约使用BNB抵扣手续费的折扣比例
+const BNBDiscount = 0.1
+
+// isMaker 限价单按挂单费率计算，市价单及止损单按吃单费率计算
+func isMaker(order model.Order) bool {
+	return order.Type == model.OrderTypeLimit || order.Type == model.OrderTypeLimitMaker
+}
@@ -0,0 +1,105 @@
+package exchange
+
+import (
+	"floolishman/model"
+	"math"
+	"math/rand"
+)
+
+// FillModel 模拟撮合模型，PaperWallet 按注册顺序依次应用
+type FillModel interface {
+	// TakerPrice 吃单(市价单/止损单)的实际成交价格
+	TakerPrice(side model.SideType, price, quantity float64, candle model.Candle) float64
+	// LimitQuantity 限价单触价后在当前K线内可成交的数量，quantity 为上一个模型给出的可成交数量
+	LimitQuantity(order model.Order, quantity float64, candle model.Candle) float64
+}
+
+// adversePrice 按不利方向偏移价格，买单上移，卖单下移
+func adversePrice(side model.SideType, price, ratio float64) float64 {
+	if side == model.SideTypeBuy {
+		return price * (1 + ratio)
+	}
+	return price * (1 - ratio)
+}
+
+// FixedSlippage 固定基点滑点
+type FixedSlippage struct {
+	Bps float64
+}
+
+func (f FixedSlippage) TakerPrice(side model.SideType, price, _ float64, _ model.Candle) float64 {
+	return adversePrice(side, price, f.Bps/10000)
+}
+
+func (f FixedSlippage) LimitQuantity(_ model.Order, quantity float64, _ model.Candle) float64 {
+	return quantity
+}
+
+// VolumeSlippage 按成交量占比计算滑点: 滑点 = Impact * 订单数量 / K线成交量，MaxBps 为上限
+type VolumeSlippage struct {
+	Impact float64
+	MaxBps float64
+}
+
+func (v VolumeSlippage) TakerPrice(side model.SideType, price, quantity float64, candle model.Candle) float64 {
+	if candle.Volume <= 0 {
+		return adversePrice(side, price, v.MaxBps/10000)
+	}
+	ratio := v.Impact * quantity / candle.Volume
+	if v.MaxBps > 0 {
+		ratio = math.Min(ratio, v.MaxBps/10000)
+	}
+	return adversePrice(side, price, ratio)
+}
+
+func (v VolumeSlippage) LimitQuantity(_ model.Order, quantity float64, _ model.Candle) float64 {
+	return quantity
+}
+
+// QueueFill 限价单排队模型，价格穿过挂单价时必定成交，仅触及挂单价时按概率成交
+type QueueFill struct {
+	Probability float64
+	random      *rand.Rand
+}
+
+// NewQueueFill 创建排队模型，固定随机种子保证回测结果可复现
+func NewQueueFill(probability float64, seed int64) *QueueFill {
+	return &QueueFill{
+		Probability: probability,
+		random:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (q *QueueFill) TakerPrice(_ model.SideType, price, _ float64, _ model.Candle) float64 {
+	return price
+}
+
+func (q *QueueFill) LimitQuantity(order model.Order, quantity float64, candle model.Candle) float64 {
+	// 市价单无需排队
+	if order.Type == model.OrderTypeMarket {
+		return quantity
+	}
+	if order.Side == model.SideTypeBuy && candle.Low < order.Price {
+		return quantity
+	}
+	if order.Side == model.SideTypeSell && candle.High > order.Price {
+		return quantity
+	}
+	if q.random.Float64() < q.Probability {
+		return quantity
+	}
+	return 0
+}
+
+// PartialFill 单根K线内最多成交 K线成交量 * MaxParticipation
+type PartialFill struct {
+	MaxParticipation float64
+}
+
+func (p PartialFill) TakerPrice(_ model.SideType, price, _ float64, _ model.Candle) float64 {
+	return price
+}
+
+func (p PartialFill) LimitQuantity(_ model.Order, quantity float64, candle model.Candle) float64 {
+	return math.Min(quantity, candle.Volume*p.MaxParticipation)
+}
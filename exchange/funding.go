@@ -0,0 +1,62 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"floolishman/model"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FundingInterval 永续合约资金费结算周期 (00:00 / 08:00 / 16:00 UTC)
+const FundingInterval = 8 * time.Hour
+
+// NewFundingRatesFromCSV 读取资金费率文件，格式与K线文件一致: time(秒),rate，表头可选
+// 下载的 funding 市场数据文件以 fundingRate 为列名，同样可以读取
+func NewFundingRatesFromCSV(file string) ([]model.FundingRate, error) {
+	csvFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	csvLines, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	headerMap := map[string]int{"time": 0, "rate": 1}
+	if len(csvLines) > 0 {
+		if _, err := strconv.Atoi(csvLines[0][0]); err != nil {
+			for index, h := range csvLines[0] {
+				headerMap[h] = index
+			}
+			if index, ok := headerMap["fundingRate"]; ok {
+				headerMap["rate"] = index
+			}
+			csvLines = csvLines[1:]
+		}
+	}
+
+	rates := make([]model.FundingRate, 0, len(csvLines))
+	for _, line := range csvLines {
+		timestamp, err := strconv.Atoi(line[headerMap["time"]])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := strconv.ParseFloat(line[headerMap["rate"]], 64)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, model.FundingRate{
+			Time: time.Unix(int64(timestamp), 0).UTC(),
+			Rate: rate,
+		})
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Time.Before(rates[j].Time)
+	})
+	return rates, nil
+}
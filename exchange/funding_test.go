@@ -0,0 +1,90 @@
+package exchange
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"floolishman/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFundingRatesFromCSV(t *testing.T) {
+	want := []model.FundingRate{
+		{Time: paperStart, Rate: 0.0001},
+		{Time: paperStart.Add(FundingInterval), Rate: -0.0002},
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "without header", content: "1704067200,0.0001\n1704096000,-0.0002\n"},
+		{name: "rate header", content: "time,rate\n1704067200,0.0001\n1704096000,-0.0002\n"},
+		// WriteMarketDataCSV 写入的 funding 数据集
+		{name: "fundingRate header", content: "time,fundingRate\n1704067200,0.0001\n1704096000,-0.0002\n"},
+		{name: "unsorted", content: "1704096000,-0.0002\n1704067200,0.0001\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "BTCUSDT-funding.csv")
+			require.NoError(t, os.WriteFile(file, []byte(tt.content), 0644))
+			rates, err := NewFundingRatesFromCSV(file)
+			require.NoError(t, err)
+			require.Equal(t, want, rates)
+		})
+	}
+}
+
+func TestPaperWallet_SettleFunding(t *testing.T) {
+	rates := []model.FundingRate{
+		{Time: paperStart, Rate: 0.0001},
+		{Time: paperStart.Add(8 * time.Hour), Rate: 0.0002},
+		{Time: paperStart.Add(16 * time.Hour), Rate: -0.0001},
+	}
+	// 08:00 按开盘价 110 结算 0.0002，16:00 按开盘价 120 结算 -0.0001
+	tests := []struct {
+		name         string
+		side         model.SideType
+		positionSide model.PositionSideType
+		funding      float64
+	}{
+		{name: "long pays positive rate", side: model.SideTypeBuy, positionSide: model.PositionSideTypeLong,
+			funding: -110*0.0002 + 120*0.0001},
+		{name: "short receives positive rate", side: model.SideTypeSell, positionSide: model.PositionSideTypeShort,
+			funding: 110*0.0002 - 120*0.0001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet, candleClock := newTestPaperWallet(t, WithPaperFundingRates("BTCUSDT", rates))
+			var payments []model.FundingPayment
+			wallet.SubscribeFunding(func(payment model.FundingPayment) {
+				payments = append(payments, payment)
+			})
+			onPaperCandle(wallet, candleClock, paperCandle(0, 100, 100, 100, 100, 100))
+			_, err := wallet.CreateOrderMarket(tt.side, tt.positionSide, "BTCUSDT", 1, model.OrderExtra{})
+			require.NoError(t, err)
+			free := wallet.assets["USDT"].Free
+
+			for _, index := range []int{1, 479, 480, 481, 959, 960, 961} {
+				open := 100.0
+				switch {
+				case index >= 960:
+					open = 120
+				case index >= 480:
+					open = 110
+				}
+				onPaperCandle(wallet, candleClock, paperCandle(index, open, open, open, open, 100))
+			}
+
+			require.Len(t, payments, 2)
+			require.Equal(t, paperStart.Add(8*time.Hour), payments[0].Time)
+			require.Equal(t, 0.0002, payments[0].Rate)
+			require.Equal(t, paperStart.Add(16*time.Hour), payments[1].Time)
+			require.Equal(t, -0.0001, payments[1].Rate)
+			require.InDelta(t, tt.funding, wallet.Funding("BTCUSDT"), 1e-9)
+			require.InDelta(t, free+tt.funding, wallet.assets["USDT"].Free, 1e-9)
+		})
+	}
+}
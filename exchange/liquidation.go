@@ -0,0 +1,52 @@
+package exchange
+
+import (
+	"encoding/json"
+	"floolishman/model"
+	"os"
+	"sort"
+)
+
+// DefaultMaintMarginRatio 交易对未配置杠杆分层时使用的维持保证金率
+const DefaultMaintMarginRatio = 0.004
+
+type symbolBrackets struct {
+	Symbol   string                  `json:"symbol"`
+	Brackets []model.LeverageBracket `json:"brackets"`
+}
+
+// NewLeverageBracketsFromFile 读取币安杠杆分层文件 (GET /fapi/v1/leverageBracket 的返回内容)
+func NewLeverageBracketsFromFile(file string) (map[string][]model.LeverageBracket, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []symbolBrackets
+	if err := json.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+
+	brackets := make(map[string][]model.LeverageBracket)
+	for _, item := range items {
+		sort.Slice(item.Brackets, func(i, j int) bool {
+			return item.Brackets[i].NotionalFloor < item.Brackets[j].NotionalFloor
+		})
+		brackets[item.Symbol] = item.Brackets
+	}
+	return brackets, nil
+}
+
+// maintMargin 根据名义价值查找维持保证金率及速算数
+func maintMargin(brackets []model.LeverageBracket, notional float64) (float64, float64) {
+	for _, bracket := range brackets {
+		if notional >= bracket.NotionalFloor && notional < bracket.NotionalCap {
+			return bracket.MaintMarginRatio, bracket.Cum
+		}
+	}
+	if len(brackets) > 0 {
+		last := brackets[len(brackets)-1]
+		return last.MaintMarginRatio, last.Cum
+	}
+	return DefaultMaintMarginRatio, 0
+}
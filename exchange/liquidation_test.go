@@ -0,0 +1,163 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"floolishman/model"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/stretchr/testify/require"
+)
+
+// testBrackets 币安 BTCUSDT 前两档杠杆分层
+var testBrackets = map[string][]model.LeverageBracket{
+	"BTCUSDT": {
+		{Bracket: 1, InitialLeverage: 125, NotionalFloor: 0, NotionalCap: 50000, MaintMarginRatio: 0.004, Cum: 0},
+		{Bracket: 2, InitialLeverage: 100, NotionalFloor: 50000, NotionalCap: 250000, MaintMarginRatio: 0.005, Cum: 50},
+	},
+}
+
+func TestMaintMargin(t *testing.T) {
+	tests := []struct {
+		name     string
+		brackets []model.LeverageBracket
+		notional float64
+		mmr      float64
+		cum      float64
+	}{
+		{name: "first bracket", brackets: testBrackets["BTCUSDT"], notional: 10000, mmr: 0.004},
+		{name: "bracket floor", brackets: testBrackets["BTCUSDT"], notional: 50000, mmr: 0.005, cum: 50},
+		{name: "above last cap", brackets: testBrackets["BTCUSDT"], notional: 1e7, mmr: 0.005, cum: 50},
+		{name: "no brackets", notional: 10000, mmr: DefaultMaintMarginRatio},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mmr, cum := maintMargin(tt.brackets, tt.notional)
+			require.Equal(t, tt.mmr, mmr)
+			require.Equal(t, tt.cum, cum)
+		})
+	}
+}
+
+func newLiquidationWallet(t *testing.T, marginType futures.MarginType, pairs ...string) (*PaperWallet, func(pair string, candle model.Candle)) {
+	wallet, candleClock := newTestPaperWallet(t, WithPaperAsset("USDT", 30000), WithPaperLeverageBrackets(testBrackets))
+	for _, pair := range pairs {
+		require.NoError(t, wallet.SetPairOption(context.Background(), model.PairOption{Pair: pair, Leverage: 10, MarginType: marginType}))
+	}
+	return wallet, func(pair string, candle model.Candle) {
+		candle.Pair = pair
+		onPaperCandle(wallet, candleClock, candle)
+	}
+}
+
+func TestPaperWallet_IsolatedLiquidation(t *testing.T) {
+	// 币安逐仓强平价格: LP = (WB + cum - side*Q*EP) / (Q*MMR - side*Q)
+	// 1 BTC @100000，10倍杠杆，WB = 10000，名义价值 100000 位于第二档 (MMR 0.005, cum 50)
+	tests := []struct {
+		name             string
+		side             model.SideType
+		positionSide     model.PositionSideType
+		liquidationPrice float64
+		safe             model.Candle
+		trigger          model.Candle
+	}{
+		{
+			name:             "long",
+			side:             model.SideTypeBuy,
+			positionSide:     model.PositionSideTypeLong,
+			liquidationPrice: (10000 + 50 - 100000) / (0.005 - 1),
+			safe:             paperCandle(1, 95000, 95000, 90500, 91000, 100),
+			trigger:          paperCandle(2, 91000, 91000, 90000, 90500, 100),
+		},
+		{
+			name:             "short",
+			side:             model.SideTypeSell,
+			positionSide:     model.PositionSideTypeShort,
+			liquidationPrice: (10000 + 50 + 100000) / (0.005 + 1),
+			safe:             paperCandle(1, 105000, 109400, 105000, 109000, 100),
+			trigger:          paperCandle(2, 109000, 110000, 109000, 109500, 100),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet, onCandle := newLiquidationWallet(t, futures.MarginTypeIsolated, "BTCUSDT")
+			onCandle("BTCUSDT", paperCandle(0, 100000, 100000, 100000, 100000, 100))
+			_, err := wallet.CreateOrderMarket(tt.side, tt.positionSide, "BTCUSDT", 1, model.OrderExtra{})
+			require.NoError(t, err)
+			free := wallet.assets["USDT"].Free
+
+			onCandle("BTCUSDT", tt.safe)
+			require.Equal(t, 0, wallet.Liquidations("BTCUSDT"))
+
+			onCandle("BTCUSDT", tt.trigger)
+			require.Equal(t, 1, wallet.Liquidations("BTCUSDT"))
+			orders, err := wallet.Orders("BTCUSDT")
+			require.NoError(t, err)
+			liquidation := orders[len(orders)-1]
+			require.Equal(t, model.OrderTypeLiquidation, liquidation.Type)
+			require.InDelta(t, tt.liquidationPrice, liquidation.Price, 1e-3)
+			// 强平价格处剩余保证金恰好等于维持保证金，全部作为清算费扣除
+			require.InDelta(t, free, wallet.assets["USDT"].Free, 1e-3)
+			require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-6)
+		})
+	}
+}
+
+func TestPaperWallet_IsolatedLiquidationGap(t *testing.T) {
+	wallet, onCandle := newLiquidationWallet(t, futures.MarginTypeIsolated, "BTCUSDT")
+	onCandle("BTCUSDT", paperCandle(0, 100000, 100000, 100000, 100000, 100))
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 1, model.OrderExtra{})
+	require.NoError(t, err)
+	free := wallet.assets["USDT"].Free
+
+	// 跳空开盘低于强平价格，按开盘价强平，逐仓最多损失仓位保证金
+	onCandle("BTCUSDT", paperCandle(1, 85000, 86000, 84000, 85000, 100))
+	orders, err := wallet.Orders("BTCUSDT")
+	require.NoError(t, err)
+	require.InDelta(t, 85000, orders[len(orders)-1].Price, 1e-6)
+	require.InDelta(t, free, wallet.assets["USDT"].Free, 1e-3)
+	require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-6)
+}
+
+func TestPaperWallet_CrossLiquidation(t *testing.T) {
+	// 全仓: BTC 1 @100000 与 ETH 10 @2000 共用余额，ETH 无杠杆分层时维持保证金率为 DefaultMaintMarginRatio
+	// 余额 = 30000 - 手续费 (50 + 10)
+	// LP = (Q*EP - (余额 + 其他仓位未实现盈亏 - 其他仓位维持保证金) - cum) / (Q*(1-MMR))
+	tests := []struct {
+		name       string
+		ethClose   float64
+		liquidated bool
+		price      float64
+	}{
+		{name: "other pair flat", ethClose: 2000},
+		{name: "other pair loss moves trigger", ethClose: 1000, liquidated: true,
+			price: (100000 - (29940 - 10000 - 1000*10*DefaultMaintMarginRatio) - 50) / (1 - 0.005)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet, onCandle := newLiquidationWallet(t, futures.MarginTypeCrossed, "BTCUSDT", "ETHUSDT")
+			onCandle("BTCUSDT", paperCandle(0, 100000, 100000, 100000, 100000, 100))
+			onCandle("ETHUSDT", paperCandle(0, 2000, 2000, 2000, 2000, 100))
+			_, err := wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 1, model.OrderExtra{})
+			require.NoError(t, err)
+			_, err = wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "ETHUSDT", 10, model.OrderExtra{})
+			require.NoError(t, err)
+			require.InDelta(t, 29940, wallet.assets["USDT"].Free+wallet.assets["USDT"].Lock, 1e-6)
+
+			onCandle("ETHUSDT", paperCandle(1, 2000, 2000, tt.ethClose, tt.ethClose, 100))
+			require.Equal(t, 0, wallet.Liquidations("ETHUSDT"))
+			// 不考虑其他交易对时强平价格约为 70442，考虑 ETH 亏损后约为 80452
+			onCandle("BTCUSDT", paperCandle(1, 100000, 100000, 75000, 90000, 100))
+
+			if !tt.liquidated {
+				require.Equal(t, 0, wallet.Liquidations("BTCUSDT"))
+				return
+			}
+			require.Equal(t, 1, wallet.Liquidations("BTCUSDT"))
+			orders, err := wallet.Orders("BTCUSDT")
+			require.NoError(t, err)
+			require.InDelta(t, tt.price, orders[len(orders)-1].Price, 1e-3)
+		})
+	}
+}
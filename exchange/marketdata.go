@@ -0,0 +1,138 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"floolishman/model"
+)
+
+// 合约市场数据集，下载后保存为 {pair}-{dataset}.csv
+const (
+	MarketDataFunding      = "funding"
+	MarketDataOpenInterest = "openInterest"
+	MarketDataLongShort    = "longShort"
+	MarketDataTakerVolume  = "takerVolume"
+	MarketDataMarkPrice    = "markPrice"
+)
+
+// MarketDataColumns 各数据集写入 Candle.Metadata 的列名
+var MarketDataColumns = map[string][]string{
+	MarketDataFunding:      {"fundingRate"},
+	MarketDataOpenInterest: {"openInterest", "openInterestValue"},
+	MarketDataLongShort:    {"topLongShortRatio", "topLongAccount", "topShortAccount"},
+	MarketDataTakerVolume:  {"takerBuySellRatio", "takerBuyVolume", "takerSellVolume"},
+	MarketDataMarkPrice:    {"markOpen", "markHigh", "markLow", "markClose"},
+}
+
+// marketDataTime 统计周期数据的接口时间为周期开始时间，按周期结束时间记录，合并到K线时只能取到已结束周期的数据
+// 资金费率为结算时间点，interval 为0
+func marketDataTime(timestamp int64, interval time.Duration) time.Time {
+	return time.UnixMilli(timestamp).Add(interval).UTC()
+}
+
+// NewMarketDataFromCSV 读取市场数据文件，格式为 time(秒) 及各数据列，须包含表头
+func NewMarketDataFromCSV(file string) ([]model.MarketData, error) {
+	csvFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	csvLines, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(csvLines) == 0 {
+		return nil, nil
+	}
+
+	headers := csvLines[0]
+	if len(headers) == 0 || headers[0] != "time" {
+		return nil, fmt.Errorf("%s: missing time header", file)
+	}
+	data := make([]model.MarketData, 0, len(csvLines)-1)
+	for _, line := range csvLines[1:] {
+		timestamp, err := strconv.Atoi(line[0])
+		if err != nil {
+			return nil, err
+		}
+		item := model.MarketData{
+			Time:   time.Unix(int64(timestamp), 0).UTC(),
+			Values: make(map[string]float64, len(headers)-1),
+		}
+		for i := 1; i < len(headers); i++ {
+			item.Values[headers[i]], err = strconv.ParseFloat(line[i], 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		data = append(data, item)
+	}
+
+	sort.SliceStable(data, func(i, j int) bool {
+		return data[i].Time.Before(data[j].Time)
+	})
+	return data, nil
+}
+
+// WriteMarketDataCSV 写入市场数据文件
+func WriteMarketDataCSV(file string, columns []string, data []model.MarketData) error {
+	csvFile, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	if err := writer.Write(append([]string{"time"}, columns...)); err != nil {
+		return err
+	}
+	for _, item := range data {
+		record := []string{strconv.FormatInt(item.Time.Unix(), 10)}
+		for _, column := range columns {
+			record = append(record, strconv.FormatFloat(item.Values[column], 'f', -1, 64))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return csvFile.Close()
+}
+
+// MergeMarketData 将市场数据按时间合并到K线 Metadata，每根K线取开盘时间及之前最近一条数据
+// 早于第一条数据的K线取值为0，保证各列在所有K线上都存在
+func MergeMarketData(candles []model.Candle, data []model.MarketData) {
+	if len(data) == 0 {
+		return
+	}
+	columns := make([]string, 0, len(data[0].Values))
+	for column := range data[0].Values {
+		columns = append(columns, column)
+	}
+
+	index := -1
+	for i := range candles {
+		for index+1 < len(data) && !data[index+1].Time.After(candles[i].Time) {
+			index++
+		}
+		if candles[i].Metadata == nil {
+			candles[i].Metadata = make(map[string]float64)
+		}
+		for _, column := range columns {
+			if index < 0 {
+				candles[i].Metadata[column] = 0
+				continue
+			}
+			candles[i].Metadata[column] = data[index].Values[column]
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"floolishman/model"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMarketData_NoLookAhead(t *testing.T) {
+	// 1h 标记价格K线，接口时间为开盘时间，收盘价为所在小时序号
+	var data []model.MarketData
+	for hour := 0; hour < 3; hour++ {
+		openTime := paperStart.Add(time.Duration(hour) * time.Hour)
+		data = append(data, model.MarketData{
+			Time:   marketDataTime(openTime.UnixMilli(), time.Hour),
+			Values: map[string]float64{"markClose": float64(hour + 1)},
+		})
+	}
+	require.True(t, data[0].Time.Equal(paperStart.Add(time.Hour)))
+
+	// 3小时的 1m K线
+	candles := make([]model.Candle, 0, 180)
+	for i := 0; i < 180; i++ {
+		candles = append(candles, paperCandle(i, 100, 101, 99, 100, 10))
+	}
+	MergeMarketData(candles, data)
+
+	for _, candle := range candles {
+		// K线只能看到开盘前已结束的小时
+		closedHours := int(candle.Time.Sub(paperStart) / time.Hour)
+		require.Equal(t, float64(closedHours), candle.Metadata["markClose"], candle.Time.String())
+	}
+}
+
+func TestMarketDataTime_Funding(t *testing.T) {
+	settle := paperStart.Add(8 * time.Hour)
+	require.True(t, marketDataTime(settle.UnixMilli(), 0).Equal(settle))
+}
@@ -6,9 +6,14 @@ import (
 	"floolishman/reference"
 	"floolishman/utils"
 	"floolishman/utils/calc"
+	"floolishman/utils/clock"
+	"floolishman/utils/metrics"
 	"floolishman/utils/strutil"
 	"fmt"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/samber/lo"
 	"math"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -22,8 +27,8 @@ type assetInfo struct {
 }
 
 type AssetValue struct {
-	Time  time.Time
-	Value float64
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
 }
 
 type PaperWallet struct {
@@ -33,6 +38,8 @@ type PaperWallet struct {
 	counter       int64
 	takerFee      float64
 	makerFee      float64
+	feeDiscount   float64
+	fees          map[string]float64
 	initialValue  float64
 	feeder        reference.Feeder
 	orders        []model.Order
@@ -45,14 +52,60 @@ type PaperWallet struct {
 	assetValues   map[string][]AssetValue
 	equityValues  []AssetValue
 	PairOptions   map[string]model.PairOption
+
+	fundingRates     map[string][]model.FundingRate
+	fundingRate      float64
+	lastFunding      map[string]time.Time
+	funding          map[string]float64
+	fundingConsumers []func(model.FundingPayment)
+
+	leverageBrackets     map[string][]model.LeverageBracket
+	liquidations         map[string]int
+	liquidationConsumers []func(model.Order)
+
+	fillModels []FillModel
+	latency    time.Duration
+	filled     map[int64]float64
+	pathModel  PathModel
+	excursions map[string]*excursion
+	clock      reference.Clock
+
+	closes     map[string][]AssetValue
+	benchmarks map[string][]AssetValue
+}
+
+// Benchmark 基准的区间收益及策略相对基准的表现
+type Benchmark struct {
+	Name   string
+	Return float64
+	metrics.Comparison
 }
 
+// excursion 持仓期间的最高/最低价
+type excursion struct {
+	High float64
+	Low  float64
+}
+
+// ListenOrders 使用各交易对最新K线撮合挂单，实时模拟盘中K线推送间隙新增的挂单可及时成交
 func (p *PaperWallet) ListenOrders() {
-	//TODO implement me
-	panic("implement me")
+	p.Lock()
+	candles := make([]model.Candle, 0, len(p.lastCandle))
+	for _, candle := range p.lastCandle {
+		candles = append(candles, candle)
+	}
+	p.Unlock()
+
+	for _, candle := range candles {
+		p.OnCandle(candle)
+	}
 }
 
 func (p *PaperWallet) AssetsInfo(pair string) model.AssetInfo {
+	// 实时模拟盘使用交易所的交易对精度
+	if p.feeder != nil {
+		return p.feeder.AssetsInfo(pair)
+	}
 	asset, quote := SplitAssetQuote(pair)
 	return model.AssetInfo{
 		BaseAsset:          asset,
@@ -67,6 +120,9 @@ func (p *PaperWallet) AssetsInfo(pair string) model.AssetInfo {
 }
 
 func (c *PaperWallet) AssetsInfos() map[string]model.AssetInfo {
+	if c.feeder != nil {
+		return c.feeder.AssetsInfos()
+	}
 	return make(map[string]model.AssetInfo)
 }
 
@@ -88,6 +144,82 @@ func WithPaperFee(maker, taker float64) PaperWalletOption {
 	}
 }
 
+// WithPaperFeeTier 按币安合约 VIP 等级设置手续费，超出范围时使用最高等级
+func WithPaperFeeTier(tier int) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		tier = max(0, min(tier, len(FeeTiers)-1))
+		wallet.makerFee = FeeTiers[tier].Maker
+		wallet.takerFee = FeeTiers[tier].Taker
+	}
+}
+
+// WithPaperBNBDiscount 使用BNB抵扣手续费
+func WithPaperBNBDiscount() PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.feeDiscount = BNBDiscount
+	}
+}
+
+// WithPaperFundingRates 设置交易对的资金费率序列
+func WithPaperFundingRates(pair string, rates []model.FundingRate) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.fundingRates[pair] = rates
+	}
+}
+
+// WithPaperFundingRate 设置默认资金费率，交易对无费率序列时使用
+func WithPaperFundingRate(rate float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.fundingRate = rate
+	}
+}
+
+// WithPaperLeverageBrackets 设置杠杆分层，用于计算维持保证金及强平价格
+func WithPaperLeverageBrackets(brackets map[string][]model.LeverageBracket) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.leverageBrackets = brackets
+	}
+}
+
+// WithPaperFillModel 设置撮合模型 (滑点、排队、部分成交)，按顺序依次应用
+func WithPaperFillModel(models ...FillModel) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.fillModels = append(wallet.fillModels, models...)
+	}
+}
+
+// WithPaperPathModel 设置K线内价格路径模型，决定同一根K线内挂单与止损的撮合顺序
+func WithPaperPathModel(pathModel PathModel) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.pathModel = pathModel
+	}
+}
+
+// WithPaperLatency 设置下单延迟，挂单在延迟之后的K线才参与撮合
+func WithPaperLatency(latency time.Duration) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.latency = latency
+	}
+}
+
+// WithPaperClock 设置时钟，回测时由K线时间驱动，下单时间以此为准
+func WithPaperClock(clock reference.Clock) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.clock = clock
+	}
+}
+
+// WithPaperBenchmark 设置外部基准(如 BTCUSDT)的K线，汇总时仅使用回测区间内的部分
+func WithPaperBenchmark(name string, candles []model.Candle) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		values := make([]AssetValue, 0, len(candles))
+		for _, candle := range candles {
+			values = append(values, AssetValue{Time: candle.Time, Value: candle.Close})
+		}
+		wallet.benchmarks[name] = values
+	}
+}
+
 func WithDataFeed(feeder reference.Feeder) PaperWalletOption {
 	return func(wallet *PaperWallet) {
 		wallet.feeder = feeder
@@ -108,6 +240,18 @@ func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWallet
 		assetValues:   make(map[string][]AssetValue),
 		equityValues:  make([]AssetValue, 0),
 		PairOptions:   make(map[string]model.PairOption),
+		fundingRates:  make(map[string][]model.FundingRate),
+		lastFunding:   make(map[string]time.Time),
+		funding:       make(map[string]float64),
+		fees:          make(map[string]float64),
+
+		leverageBrackets: make(map[string][]model.LeverageBracket),
+		liquidations:     make(map[string]int),
+		filled:           make(map[int64]float64),
+		excursions:       make(map[string]*excursion),
+		clock:            clock.Wall{},
+		closes:           make(map[string][]AssetValue),
+		benchmarks:       make(map[string][]AssetValue),
 	}
 
 	for _, option := range options {
@@ -143,6 +287,354 @@ func (p *PaperWallet) LastQuote(ctx context.Context, pair string) (float64, erro
 	return p.feeder.LastQuote(ctx, pair)
 }
 
+// SubscribeFunding 注册资金费结算回调
+func (p *PaperWallet) SubscribeFunding(consumer func(model.FundingPayment)) {
+	p.fundingConsumers = append(p.fundingConsumers, consumer)
+}
+
+// Funding 返回交易对累计资金费
+func (p *PaperWallet) Funding(pair string) float64 {
+	return p.funding[pair]
+}
+
+// Fees 返回交易对累计手续费
+func (p *PaperWallet) Fees(pair string) float64 {
+	return p.fees[pair]
+}
+
+// chargeFee 按成交金额扣除手续费，限价单为挂单费率，市价单及止损单为吃单费率，累计到订单及交易对
+func (p *PaperWallet) chargeFee(order *model.Order, price, quantity float64) {
+	rate := p.takerFee
+	if isMaker(*order) {
+		rate = p.makerFee
+	}
+	fee := price * quantity * rate * (1 - p.feeDiscount)
+	if fee == 0 {
+		return
+	}
+	_, quote := SplitAssetQuote(order.Pair)
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+	p.assets[quote].Free -= fee
+	p.fees[order.Pair] += fee
+	order.Fee += fee
+}
+
+func (p *PaperWallet) currentFundingRate(pair string, t time.Time) float64 {
+	rates, ok := p.fundingRates[pair]
+	if !ok || len(rates) == 0 {
+		return p.fundingRate
+	}
+	index := sort.Search(len(rates), func(i int) bool {
+		return rates[i].Time.After(t)
+	})
+	if index == 0 {
+		return p.fundingRate
+	}
+	return rates[index-1].Rate
+}
+
+// settleFunding 跨越结算时间点时按当前净持仓结算资金费，多头费率为正时支付，空头收取
+func (p *PaperWallet) settleFunding(candle model.Candle) *model.FundingPayment {
+	settleTime := candle.Time.Truncate(FundingInterval)
+	lastTime, ok := p.lastFunding[candle.Pair]
+	if ok && !settleTime.After(lastTime) {
+		return nil
+	}
+	p.lastFunding[candle.Pair] = settleTime
+	// 首根K线只记录结算时间
+	if !ok {
+		return nil
+	}
+
+	asset, quote := SplitAssetQuote(candle.Pair)
+	if _, ok := p.assets[asset]; !ok {
+		return nil
+	}
+	quantity := p.assets[asset].Lock
+	rate := p.currentFundingRate(candle.Pair, settleTime)
+	if quantity == 0 || rate == 0 {
+		return nil
+	}
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+
+	value := -quantity * candle.Open * rate
+	p.assets[quote].Free += value
+	p.funding[candle.Pair] += value
+
+	return &model.FundingPayment{
+		Pair:     candle.Pair,
+		Time:     settleTime,
+		Rate:     rate,
+		Price:    candle.Open,
+		Quantity: quantity,
+		Value:    value,
+	}
+}
+
+// SubscribeLiquidation 注册强平订单回调
+func (p *PaperWallet) SubscribeLiquidation(consumer func(model.Order)) {
+	p.liquidationConsumers = append(p.liquidationConsumers, consumer)
+}
+
+// Liquidations 返回交易对强平次数
+func (p *PaperWallet) Liquidations(pair string) int {
+	return p.liquidations[pair]
+}
+
+func (p *PaperWallet) pairLeverage(pair string) float64 {
+	leverage := float64(p.PairOptions[pair].Leverage)
+	if leverage <= 0 {
+		return 1
+	}
+	return leverage
+}
+
+func (p *PaperWallet) isIsolated(pair string) bool {
+	return p.PairOptions[pair].MarginType == futures.MarginTypeIsolated
+}
+
+// openPositionOrders 查询未平仓的开仓订单，pair 为空时返回全部
+func (p *PaperWallet) openPositionOrders(pair string) []model.Order {
+	closed := make(map[string]bool)
+	for _, order := range p.orders {
+		if order.Status != model.OrderStatusTypeFilled {
+			continue
+		}
+		if (order.Side == model.SideTypeSell && order.PositionSide == model.PositionSideTypeLong) || (order.Side == model.SideTypeBuy && order.PositionSide == model.PositionSideTypeShort) {
+			closed[order.Pair+order.OrderFlag] = true
+		}
+	}
+
+	positionOrders := make([]model.Order, 0)
+	for _, order := range p.orders {
+		if !p.isHeld(order) {
+			continue
+		}
+		if pair != "" && order.Pair != pair {
+			continue
+		}
+		if closed[order.Pair+order.OrderFlag] {
+			continue
+		}
+		order.Quantity = p.positionQuantity(order)
+		positionOrders = append(positionOrders, order)
+	}
+	return positionOrders
+}
+
+// isHeld 已全部或部分成交的开仓单(限价或市价)
+func (p *PaperWallet) isHeld(order model.Order) bool {
+	if !isPositionOrder(order) || (order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeMarket) {
+		return false
+	}
+	return order.Status == model.OrderStatusTypeFilled || order.Status == model.OrderStatusTypePartiallyFilled
+}
+
+// positionQuantity 开仓单当前持有的数量，部分成交时为已成交数量
+func (p *PaperWallet) positionQuantity(order model.Order) float64 {
+	if order.Status == model.OrderStatusTypePartiallyFilled {
+		return p.filled[order.ExchangeID]
+	}
+	return order.Quantity
+}
+
+// finishPartial 部分成交的订单不再继续成交，已成交部分作为成交订单保留
+func (p *PaperWallet) finishPartial(i int) {
+	p.orders[i].Quantity = p.filled[p.orders[i].ExchangeID]
+	p.orders[i].Status = model.OrderStatusTypeFilled
+	delete(p.filled, p.orders[i].ExchangeID)
+}
+
+// finishPosition 仓位平仓或强平后，该仓位部分成交的开仓单不再继续成交
+func (p *PaperWallet) finishPosition(pair, orderFlag string) {
+	for i, order := range p.orders {
+		if order.Pair == pair && order.OrderFlag == orderFlag && order.Status == model.OrderStatusTypePartiallyFilled && isPositionOrder(order) {
+			p.finishPartial(i)
+		}
+	}
+}
+
+// checkLiquidation 检查K线最高/最低价是否触及强平价格，逐仓按单个仓位计算，全仓按钱包余额计算
+func (p *PaperWallet) checkLiquidation(candle model.Candle) []model.Order {
+	positionOrders := p.openPositionOrders(candle.Pair)
+	if len(positionOrders) == 0 {
+		return nil
+	}
+	_, quote := SplitAssetQuote(candle.Pair)
+	if _, ok := p.assets[quote]; !ok {
+		return nil
+	}
+
+	liquidated := make([]model.Order, 0)
+	if p.isIsolated(candle.Pair) {
+		for _, position := range positionOrders {
+			quantity := position.Quantity
+			margin := position.Price * quantity / p.pairLeverage(candle.Pair)
+			mmr, cum := maintMargin(p.leverageBrackets[candle.Pair], position.Price*quantity)
+			if position.PositionSide == model.PositionSideTypeLong {
+				liquidationPrice := (position.Price*quantity - margin - cum) / (quantity * (1 - mmr))
+				if candle.Low <= liquidationPrice {
+					liquidated = append(liquidated, p.liquidate(position, math.Min(liquidationPrice, candle.Open), candle))
+				}
+			} else {
+				liquidationPrice := (position.Price*quantity + margin + cum) / (quantity * (1 + mmr))
+				if candle.High >= liquidationPrice {
+					liquidated = append(liquidated, p.liquidate(position, math.Max(liquidationPrice, candle.Open), candle))
+				}
+			}
+		}
+		return liquidated
+	}
+
+	// 全仓: 权益 = 余额 + 未实现盈亏，维持保证金 = 名义价值 * 维持保证金率 - 速算数
+	// 其他交易对按最新收盘价计算，当前交易对价格 P 为变量: A + B*P <= C*P - D 时强平
+	var a, b, c, d float64
+	a = p.assets[quote].Free + p.assets[quote].Lock
+	for _, position := range p.openPositionOrders("") {
+		if position.Pair == candle.Pair {
+			continue
+		}
+		if p.isIsolated(position.Pair) {
+			a -= position.Price * position.Quantity / p.pairLeverage(position.Pair)
+			continue
+		}
+		closePrice := p.lastCandle[position.Pair].Close
+		mmr, cum := maintMargin(p.leverageBrackets[position.Pair], position.Price*position.Quantity)
+		if position.PositionSide == model.PositionSideTypeLong {
+			a += (closePrice - position.Price) * position.Quantity
+		} else {
+			a += (position.Price - closePrice) * position.Quantity
+		}
+		a -= closePrice*position.Quantity*mmr - cum
+	}
+	for _, position := range positionOrders {
+		mmr, cum := maintMargin(p.leverageBrackets[candle.Pair], position.Price*position.Quantity)
+		if position.PositionSide == model.PositionSideTypeLong {
+			a -= position.Price * position.Quantity
+			b += position.Quantity
+		} else {
+			a += position.Price * position.Quantity
+			b -= position.Quantity
+		}
+		c += position.Quantity * mmr
+		d += cum
+	}
+	if b == c {
+		return nil
+	}
+	liquidationPrice := -(a + d) / (b - c)
+	if b > c && candle.Low <= liquidationPrice {
+		for _, position := range positionOrders {
+			liquidated = append(liquidated, p.liquidate(position, math.Min(liquidationPrice, candle.Open), candle))
+		}
+	}
+	if b < c && candle.High >= liquidationPrice {
+		for _, position := range positionOrders {
+			liquidated = append(liquidated, p.liquidate(position, math.Max(liquidationPrice, candle.Open), candle))
+		}
+	}
+	return liquidated
+}
+
+// liquidate 按强平价格平掉仓位，剩余维持保证金作为清算费扣除，逐仓最多损失仓位保证金
+func (p *PaperWallet) liquidate(position model.Order, price float64, candle model.Candle) model.Order {
+	asset, quote := SplitAssetQuote(position.Pair)
+	quantity := position.Quantity
+	lockQuote := position.Price * quantity / p.pairLeverage(position.Pair)
+	mmr, cum := maintMargin(p.leverageBrackets[position.Pair], position.Price*quantity)
+
+	var side model.SideType
+	var profit float64
+	if position.PositionSide == model.PositionSideTypeLong {
+		side = model.SideTypeSell
+		profit = (price - position.Price) * quantity
+		p.assets[asset].Lock -= quantity
+	} else {
+		side = model.SideTypeBuy
+		profit = (position.Price - price) * quantity
+		p.assets[asset].Lock += quantity
+	}
+	p.assets[asset].Free = 0
+
+	remain := lockQuote + profit - (price*quantity*mmr - cum)
+	if p.isIsolated(position.Pair) && remain < 0 {
+		remain = 0
+	}
+	p.assets[quote].Lock -= lockQuote
+	p.assets[quote].Free += remain
+	p.volume[position.Pair] += price * quantity
+
+	// 撤销该仓位剩余的挂单
+	p.finishPosition(position.Pair, position.OrderFlag)
+	for i, order := range p.orders {
+		if order.Pair == position.Pair && order.OrderFlag == position.OrderFlag && order.Status == model.OrderStatusTypeNew {
+			p.orders[i].Status = model.OrderStatusTypeCanceled
+			p.orders[i].UpdatedAt = candle.Time
+		}
+	}
+
+	order := model.Order{
+		ExchangeID:    p.ID(),
+		ClientOrderId: "autoclose-" + strutil.RandomString(12),
+		OrderFlag:     position.OrderFlag,
+		OpenType:      "paperwallet",
+		CreatedAt:     candle.Time,
+		UpdatedAt:     candle.Time,
+		Pair:          position.Pair,
+		Side:          side,
+		PositionSide:  position.PositionSide,
+		Type:          model.OrderTypeLiquidation,
+		Status:        model.OrderStatusTypeFilled,
+		Price:         p.FormatPriceFloat(position.Pair, price),
+		Quantity:      quantity,
+		Leverage:      position.Leverage,
+	}
+	p.orders = append(p.orders, order)
+	p.liquidations[position.Pair]++
+
+	utils.Log.Warnf("[LIQUIDATION] %s", order)
+
+	p.CalculateEquityValue(candle.Time, position.PositionSide, position.Pair, quantity)
+	return order
+}
+
+// takerPrice 经撮合模型调整后的吃单成交价格
+func (p *PaperWallet) takerPrice(side model.SideType, pair string, price, quantity float64, candle model.Candle) float64 {
+	for _, fillModel := range p.fillModels {
+		price = fillModel.TakerPrice(side, price, quantity, candle)
+	}
+	return p.FormatPriceFloat(pair, price)
+}
+
+// limitQuantity 经撮合模型调整后限价单在当前K线的成交数量
+func (p *PaperWallet) limitQuantity(order model.Order, candle model.Candle) float64 {
+	quantity := order.Quantity - p.filled[order.ExchangeID]
+	for _, fillModel := range p.fillModels {
+		quantity = fillModel.LimitQuantity(order, quantity, candle)
+	}
+	return p.FormatQuantityFloat(order.Pair, quantity, true)
+}
+
+// fillOrder 记录开仓单成交数量，全部成交后修改为已成交，市价单价格为成交均价
+func (p *PaperWallet) fillOrder(i int, price, quantity float64, updatedAt time.Time) {
+	if p.orders[i].Type == model.OrderTypeMarket {
+		filled := p.filled[p.orders[i].ExchangeID]
+		p.orders[i].Price = p.FormatPriceFloat(p.orders[i].Pair, (p.orders[i].Price*filled+price*quantity)/(filled+quantity))
+	}
+	p.filled[p.orders[i].ExchangeID] += quantity
+	p.orders[i].UpdatedAt = updatedAt
+	if p.filled[p.orders[i].ExchangeID] >= p.orders[i].Quantity {
+		p.orders[i].Status = model.OrderStatusTypeFilled
+		delete(p.filled, p.orders[i].ExchangeID)
+	} else {
+		p.orders[i].Status = model.OrderStatusTypePartiallyFilled
+	}
+}
+
 func (p *PaperWallet) AssetValues(pair string) []AssetValue {
 	return p.assetValues[pair]
 }
@@ -151,6 +643,18 @@ func (p *PaperWallet) EquityValues() []AssetValue {
 	return p.equityValues
 }
 
+// InitialValue 初始资金
+func (p *PaperWallet) InitialValue() float64 {
+	return p.initialValue
+}
+
+// FinalValue 当前基础币资金 (可用 + 锁定)
+func (p *PaperWallet) FinalValue() float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.assets[p.baseCoin].Free + p.assets[p.baseCoin].Lock
+}
+
 func (p *PaperWallet) MaxDrawdown() (float64, time.Time, time.Time) {
 	if len(p.equityValues) < 2 {
 		return 0, time.Time{}, time.Time{}
@@ -222,6 +726,167 @@ func (p *PaperWallet) MaxDrawdownBack() (float64, time.Time, time.Time) {
 	return globalMin / globalMinBase, globalMinStart, globalMinEnd
 }
 
+// Performance 根据权益曲线及已平仓位计算风险调整后的绩效指标
+func (p *PaperWallet) Performance() metrics.Performance {
+	positions, _ := p.GetPositionsForClosed(time.Time{})
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].UpdatedAt.Before(positions[j].UpdatedAt)
+	})
+
+	p.Lock()
+	defer p.Unlock()
+
+	var performance metrics.Performance
+	start, end, times, values := p.equityCurve()
+	returns := metrics.DailyReturns(times, values)
+	performance.Sharpe = metrics.Sharpe(returns, metrics.DaysPerYear)
+	performance.Sortino = metrics.Sortino(returns, metrics.DaysPerYear)
+	performance.MaxDrawdown = metrics.MaxDrawdown(values)
+	performance.MaxDrawdownDuration = metrics.MaxDrawdownDuration(times, values)
+	performance.Ulcer = metrics.Ulcer(values)
+	if len(values) > 0 {
+		annualReturn := metrics.AnnualReturn(p.initialValue, values[len(values)-1], end.Sub(start))
+		performance.Calmar = metrics.Calmar(annualReturn, performance.MaxDrawdown)
+	}
+
+	profits := make([]float64, 0, len(positions))
+	intervals := make([]metrics.Interval, 0, len(positions))
+	for _, position := range positions {
+		profits = append(profits, position.ProfitValue)
+		intervals = append(intervals, metrics.Interval{Start: position.CreatedAt, End: position.UpdatedAt})
+		entry, exit, total := metrics.TradeEfficiency(
+			position.PositionSide == string(model.PositionSideTypeLong),
+			position.AvgPrice,
+			position.ClosePrice,
+			position.HighPrice,
+			position.LowPrice,
+		)
+		performance.EntryEfficiency += entry / float64(len(positions))
+		performance.ExitEfficiency += exit / float64(len(positions))
+		performance.TotalEfficiency += total / float64(len(positions))
+	}
+	performance.Expectancy = metrics.Expectancy(profits)
+	performance.AverageHolding = metrics.AverageHolding(intervals)
+	performance.Exposure = metrics.Exposure(intervals, start, end)
+	performance.WinStreak, performance.LoseStreak = metrics.Streaks(profits)
+	return performance
+}
+
+// equityCurve 回测区间及以初始资金为起点的权益曲线，调用方需持有钱包锁
+func (p *PaperWallet) equityCurve() (time.Time, time.Time, []time.Time, []float64) {
+	var (
+		start  time.Time
+		end    time.Time
+		times  = []time.Time{}
+		values = []float64{}
+	)
+	for _, candle := range p.fistCandle {
+		if start.IsZero() || candle.Time.Before(start) {
+			start = candle.Time
+		}
+	}
+	for _, candle := range p.lastCandle {
+		if candle.Time.After(end) {
+			end = candle.Time
+		}
+	}
+	if !start.IsZero() {
+		times = append(times, start)
+		values = append(values, p.initialValue)
+	}
+	for _, item := range p.equityValues {
+		times = append(times, item.Time)
+		values = append(values, item.Value)
+	}
+	return start, end, times, values
+}
+
+// dailyClose 按日记录收盘价，首个价格保留为区间起点，同一天内只保留最新价格
+func dailyClose(closes []AssetValue, t time.Time, value float64) []AssetValue {
+	day := t.UTC().Truncate(24 * time.Hour)
+	if len(closes) > 1 && closes[len(closes)-1].Time.UTC().Truncate(24*time.Hour).Equal(day) {
+		closes[len(closes)-1] = AssetValue{Time: t, Value: value}
+		return closes
+	}
+	return append(closes, AssetValue{Time: t, Value: value})
+}
+
+// benchmarkReturns 价格序列的区间收益及日收益率
+func benchmarkReturns(closes []AssetValue) (float64, []float64) {
+	if len(closes) == 0 || closes[0].Value == 0 {
+		return 0, nil
+	}
+	times := make([]time.Time, 0, len(closes))
+	values := make([]float64, 0, len(closes))
+	for _, item := range closes {
+		times = append(times, item.Time)
+		values = append(values, item.Value)
+	}
+	return values[len(values)-1]/values[0] - 1, metrics.DailyReturns(times, values)
+}
+
+// Benchmarks 各交易对买入持有、等权组合及外部基准的收益，以及策略相对其的 alpha/beta/相关系数/信息比率
+func (p *PaperWallet) Benchmarks() []Benchmark {
+	p.Lock()
+	defer p.Unlock()
+
+	start, end, times, values := p.equityCurve()
+	returns := metrics.DailyReturns(times, values)
+
+	pairs := make([]string, 0, len(p.closes))
+	for pair := range p.closes {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	benchmarks := make([]Benchmark, 0, len(pairs)+len(p.benchmarks)+1)
+	basket := make([][]float64, 0, len(pairs))
+	for _, pair := range pairs {
+		change, pairReturns := benchmarkReturns(p.closes[pair])
+		basket = append(basket, pairReturns)
+		benchmarks = append(benchmarks, Benchmark{
+			Name:       pair,
+			Return:     change,
+			Comparison: metrics.Compare(returns, pairReturns, metrics.DaysPerYear),
+		})
+	}
+	if len(basket) > 1 {
+		basketReturns := metrics.EqualWeight(basket...)
+		growth := metrics.Growth(basketReturns)
+		benchmarks = append(benchmarks, Benchmark{
+			Name:       "EQUAL WEIGHT",
+			Return:     growth[len(growth)-1] - 1,
+			Comparison: metrics.Compare(returns, basketReturns, metrics.DaysPerYear),
+		})
+	}
+
+	names := make([]string, 0, len(p.benchmarks))
+	for name := range p.benchmarks {
+		// 已参与回测的交易对直接使用其买入持有基准
+		if _, ok := p.closes[name]; ok {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		closes := make([]AssetValue, 0)
+		for _, item := range p.benchmarks[name] {
+			if item.Time.Before(start) || item.Time.After(end) {
+				continue
+			}
+			closes = dailyClose(closes, item.Time, item.Value)
+		}
+		change, indexReturns := benchmarkReturns(closes)
+		benchmarks = append(benchmarks, Benchmark{
+			Name:       name,
+			Return:     change,
+			Comparison: metrics.Compare(returns, indexReturns, metrics.DaysPerYear),
+		})
+	}
+	return benchmarks
+}
+
 func (p *PaperWallet) Summary() {
 	var (
 		total        float64
@@ -254,18 +919,53 @@ func (p *PaperWallet) Summary() {
 	}
 
 	avgMarketChange := marketChange / float64(len(p.lastCandle))
+	funding := 0.0
+	for _, value := range p.funding {
+		funding += value
+	}
+	liquidations := 0
+	for _, count := range p.liquidations {
+		liquidations += count
+	}
+	fees := 0.0
+	for _, value := range p.fees {
+		fees += value
+	}
 	profit := baseCoinValue - p.initialValue
 
 	fmt.Println()
 	maxDrawDown, _, _ := p.MaxDrawdown()
+	performance := p.Performance()
 	fmt.Println("----- RETURNS -----")
 	fmt.Printf("START PORTFOLIO     = %.2f %s\n", p.initialValue, p.baseCoin)
 	fmt.Printf("FINAL PORTFOLIO     = %.2f %s\n", baseCoinValue, p.baseCoin)
 	fmt.Printf("GROSS PROFIT        =  %f %s (%.2f%%)\n", profit, p.baseCoin, profit/p.initialValue*100)
+	fmt.Printf("FUNDING             =  %f %s\n", funding, p.baseCoin)
+	fmt.Printf("FEES                =  %f %s\n", fees, p.baseCoin)
 	fmt.Printf("MARKET CHANGE (B&H) =  %.2f%%\n", avgMarketChange*100)
 	fmt.Println()
+	fmt.Println("---- BENCHMARK ----")
+	for _, benchmark := range p.Benchmarks() {
+		fmt.Printf("%-14s = %.2f%% (ALPHA: %.2f, BETA: %.2f, CORR: %.2f, IR: %.2f)\n", benchmark.Name,
+			benchmark.Return*100, benchmark.Alpha, benchmark.Beta, benchmark.Correlation, benchmark.InformationRatio)
+	}
+	fmt.Println()
 	fmt.Println("------ RISK -------")
 	fmt.Printf("MAX DRAWDOWN = %.2f %%\n", maxDrawDown*100)
+	fmt.Printf("DD DURATION  = %s\n", performance.MaxDrawdownDuration)
+	fmt.Printf("ULCER INDEX  = %.2f\n", performance.Ulcer)
+	fmt.Printf("SHARPE       = %.2f\n", performance.Sharpe)
+	fmt.Printf("SORTINO      = %.2f\n", performance.Sortino)
+	fmt.Printf("CALMAR       = %.2f\n", performance.Calmar)
+	fmt.Printf("LIQUIDATIONS = %d\n", liquidations)
+	fmt.Println()
+	fmt.Println("------ TRADES -----")
+	fmt.Printf("EXPOSURE        = %.2f %%\n", performance.Exposure*100)
+	fmt.Printf("EXPECTANCY      = %.4f %s\n", performance.Expectancy, p.baseCoin)
+	fmt.Printf("AVG HOLDING     = %s\n", performance.AverageHolding)
+	fmt.Printf("EFFICIENCY      = entry %.2f %% / exit %.2f %% / total %.2f %%\n",
+		performance.EntryEfficiency*100, performance.ExitEfficiency*100, performance.TotalEfficiency*100)
+	fmt.Printf("STREAK WIN/LOSE = %d / %d\n", performance.WinStreak, performance.LoseStreak)
 	fmt.Println()
 	fmt.Println("------ VOLUME -----")
 	for pair, vol := range p.volume {
@@ -273,6 +973,12 @@ func (p *PaperWallet) Summary() {
 		fmt.Printf("%s         = %.2f %s\n", pair, vol, p.baseCoin)
 	}
 	fmt.Printf("TOTAL           = %.2f %s\n", volume, p.baseCoin)
+	fmt.Println()
+	fmt.Println("------- FEES ------")
+	for pair, fee := range p.fees {
+		fmt.Printf("%s         = %.4f %s\n", pair, fee, p.baseCoin)
+	}
+	fmt.Printf("TOTAL           = %.4f %s\n", fees, p.baseCoin)
 	fmt.Println("-------------------")
 }
 
@@ -392,10 +1098,8 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 		if _, ok := p.assets[quote]; !ok {
 			p.assets[quote] = &assetInfo{}
 		}
-		var orderPrice float64
-		if order.Type == model.OrderTypeLimit {
-			orderPrice = order.Price
-		}
+		// 限价单为挂单价格，市价单为吃单成交价格
+		orderPrice := order.Price
 		volume := orderPrice * order.Quantity
 		// 锁定的资产
 		lockQuote := volume / leverage
@@ -411,6 +1115,7 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 
 		p.assets[quote].Lock += lockQuote
 		p.assets[quote].Free -= lockQuote
+		p.chargeFee(order, orderPrice, order.Quantity)
 	}
 	// 平多单
 	if order.Side == model.SideTypeSell && order.PositionSide == model.PositionSideTypeLong {
@@ -418,13 +1123,15 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 			return nil
 		}
 		// 查询对应的仓位平多单平平
-		positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag, model.OrderTypeLimit)
+		positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag)
 		if err != nil {
 			utils.Log.Error(err)
 		}
 		if positonOrder.ExchangeID == 0 {
 			return nil
 		}
+		// 平仓数量不超过实际持有数量
+		order.Quantity = math.Min(order.Quantity, positonOrder.Quantity)
 		if p.assets[asset].Lock < order.Quantity {
 			return &OrderError{
 				Err:      ErrInvalidAsset,
@@ -433,6 +1140,7 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 			}
 		}
 
+		p.volume[order.Pair] += order.Price * order.Quantity
 		p.updateAveragePrice(order.Side, order.Pair, order.Quantity, order.Price)
 
 		// 开多单资产
@@ -443,6 +1151,8 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 		// 修改基本资产
 		p.assets[quote].Lock -= lockQuote
 		p.assets[quote].Free += lockQuote + (order.Price-positonOrder.Price)*order.Quantity
+		p.chargeFee(order, order.Price, order.Quantity)
+		p.finishPosition(order.Pair, order.OrderFlag)
 
 		utils.Log.Debugf("%s -> LOCK = %f / FREE %f", asset, p.assets[asset].Lock, p.assets[asset].Free)
 
@@ -456,10 +1166,8 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 		if _, ok := p.assets[quote]; !ok {
 			p.assets[quote] = &assetInfo{}
 		}
-		var orderPrice float64
-		if order.Type == model.OrderTypeLimit {
-			orderPrice = order.Price
-		}
+		// 限价单为挂单价格，市价单为吃单成交价格
+		orderPrice := order.Price
 		volume := orderPrice * order.Quantity
 
 		// 锁定的资产
@@ -477,19 +1185,22 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 
 		p.assets[quote].Lock += lockQuote
 		p.assets[quote].Free -= lockQuote
+		p.chargeFee(order, orderPrice, order.Quantity)
 	}
 	// 平空单
 	if order.Side == model.SideTypeBuy && order.PositionSide == model.PositionSideTypeShort {
 		if order.Status != model.OrderStatusTypeFilled {
 			return nil
 		}
-		positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag, model.OrderTypeLimit)
+		positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag)
 		if err != nil {
 			utils.Log.Error(err)
 		}
 		if positonOrder.ExchangeID == 0 {
 			return nil
 		}
+		// 平仓数量不超过实际持有数量
+		order.Quantity = math.Min(order.Quantity, positonOrder.Quantity)
 		if calc.Abs(p.assets[asset].Lock) < order.Quantity {
 			return &OrderError{
 				Err:      ErrInvalidAsset,
@@ -498,6 +1209,7 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 			}
 		}
 
+		p.volume[order.Pair] += order.Price * order.Quantity
 		p.updateAveragePrice(order.Side, order.Pair, order.Quantity, order.Price)
 		// 查询对应的仓位
 
@@ -509,6 +1221,8 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 		// 修改基本资产
 		p.assets[quote].Lock -= lockQuote
 		p.assets[quote].Free += lockQuote + (positonOrder.Price-order.Price)*order.Quantity
+		p.chargeFee(order, order.Price, order.Quantity)
+		p.finishPosition(order.Pair, order.OrderFlag)
 
 		utils.Log.Debugf("%s -> LOCK = %f / FREE %f", asset, p.assets[asset].Lock, p.assets[asset].Free)
 
@@ -519,6 +1233,24 @@ func (p *PaperWallet) updateFunds(order *model.Order) error {
 }
 
 func (p *PaperWallet) OnCandle(candle model.Candle) {
+	var (
+		payment    *model.FundingPayment
+		liquidated []model.Order
+	)
+	// 资金费及强平回调在释放钱包锁之后执行
+	defer func() {
+		if payment != nil {
+			for _, consumer := range p.fundingConsumers {
+				consumer(*payment)
+			}
+		}
+		for _, order := range liquidated {
+			for _, consumer := range p.liquidationConsumers {
+				consumer(order)
+			}
+		}
+	}()
+
 	p.Lock()
 	defer p.Unlock()
 
@@ -526,7 +1258,38 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 	if _, ok := p.fistCandle[candle.Pair]; !ok {
 		p.fistCandle[candle.Pair] = candle
 	}
+	p.closes[candle.Pair] = dailyClose(p.closes[candle.Pair], candle.Time, candle.Close)
+	payment = p.settleFunding(candle)
+
+	path := []model.Candle{candle}
+	if p.pathModel != nil {
+		path = p.pathModel.Path(candle)
+	}
+	// 按K线内价格路径顺序撮合
+	for _, segment := range path {
+		p.matchOrders(segment)
+		// 挂单成交后检查剩余仓位是否触发强平
+		liquidated = append(liquidated, p.checkLiquidation(segment)...)
+		p.trackExcursion(segment)
+	}
+}
 
+// trackExcursion 记录持仓期间的最高/最低价
+func (p *PaperWallet) trackExcursion(candle model.Candle) {
+	for _, order := range p.openPositionOrders(candle.Pair) {
+		key := order.Pair + order.OrderFlag
+		item, ok := p.excursions[key]
+		if !ok {
+			item = &excursion{High: order.Price, Low: order.Price}
+			p.excursions[key] = item
+		}
+		item.High = math.Max(item.High, candle.High)
+		item.Low = math.Min(item.Low, candle.Low)
+	}
+}
+
+// matchOrders 使用K线(或K线内路径片段)撮合挂单
+func (p *PaperWallet) matchOrders(candle model.Candle) {
 	leverage := float64(p.PairOptions[candle.Pair].Leverage) // 获取合约杠杆倍数
 
 	// 存储限价挂单
@@ -538,7 +1301,11 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 		limitOrders[order.OrderFlag] = order
 	}
 	for i, order := range p.orders {
-		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew {
+		if order.Pair != candle.Pair || (order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled) {
+			continue
+		}
+		// 下单延迟内不参与撮合
+		if order.CreatedAt.Add(p.latency).After(candle.Time) {
 			continue
 		}
 
@@ -550,17 +1317,23 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 
 		if order.Side == model.SideTypeBuy {
 			// 开多单
-			if order.PositionSide == model.PositionSideTypeLong && order.Price >= candle.Low {
+			if order.PositionSide == model.PositionSideTypeLong && (order.Type == model.OrderTypeMarket || order.Price >= candle.Low) {
 				if _, ok := p.assets[quote]; !ok {
 					p.assets[quote] = &assetInfo{}
 				}
-				var orderPrice float64
-				if order.Type == model.OrderTypeLimit {
-					orderPrice = order.Price
-				} else {
+				if order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeMarket {
 					continue
 				}
-				volume := orderPrice * order.Quantity
+				quantity := p.limitQuantity(order, candle)
+				if quantity <= 0 {
+					continue
+				}
+				// 市价单在下单延迟后的首根K线按开盘价吃单成交
+				orderPrice := order.Price
+				if order.Type == model.OrderTypeMarket {
+					orderPrice = p.takerPrice(order.Side, order.Pair, candle.Open, quantity, candle)
+				}
+				volume := orderPrice * quantity
 				// 锁定的资产
 				lockQuote := volume / leverage
 				if p.assets[quote].Free < lockQuote {
@@ -569,14 +1342,14 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 				}
 
 				p.volume[candle.Pair] += volume
-				p.orders[i].UpdatedAt = candle.Time
-				p.orders[i].Status = model.OrderStatusTypeFilled
+				p.fillOrder(i, orderPrice, quantity, candle.Time)
+				p.chargeFee(&p.orders[i], orderPrice, quantity)
 
 				limitOrders[p.orders[i].OrderFlag] = p.orders[i]
 				// update assets size
-				p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
+				p.updateAveragePrice(order.Side, order.Pair, quantity, orderPrice)
 				p.assets[asset].Free = 0
-				p.assets[asset].Lock += order.Quantity
+				p.assets[asset].Lock += quantity
 
 				p.assets[quote].Lock += lockQuote
 				p.assets[quote].Free -= lockQuote
@@ -593,35 +1366,40 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 				if _, ok := p.assets[asset]; !ok {
 					p.assets[asset] = &assetInfo{}
 				}
+				// 查询对应的仓位,当前无仓位时不需要平仓，平仓数量不超过实际持有数量
+				positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag)
+				if err != nil {
+					continue
+				}
+				quantity := math.Min(order.Quantity, positonOrder.Quantity)
 				var orderPrice float64
 				if (order.Type == model.OrderTypeStop || order.Type == model.OrderTypeStopMarket) && order.Price <= candle.High {
-					orderPrice = order.Price
+					orderPrice = p.takerPrice(order.Side, order.Pair, order.Price, quantity, candle)
 				} else if order.Type == model.OrderTypeMarket {
-					orderPrice = order.Price
+					orderPrice = p.takerPrice(order.Side, order.Pair, candle.Open, quantity, candle)
 				} else {
 					continue
 				}
-				// 查询对应的仓位,当前无仓位时不需要平仓
-				positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag, model.OrderTypeLimit)
-				if err != nil {
-					continue
-				}
 
-				p.volume[candle.Pair] += orderPrice * order.Quantity
+				p.volume[candle.Pair] += orderPrice * quantity
 				p.orders[i].UpdatedAt = candle.Time
 				p.orders[i].Status = model.OrderStatusTypeFilled
+				p.orders[i].Price = orderPrice
+				p.orders[i].Quantity = quantity
+				p.chargeFee(&p.orders[i], orderPrice, quantity)
+				p.finishPosition(order.Pair, order.OrderFlag)
 
 				// update assets size
-				p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
+				p.updateAveragePrice(order.Side, order.Pair, quantity, orderPrice)
 				p.assets[asset].Free = 0
-				p.assets[asset].Lock += order.Quantity
+				p.assets[asset].Lock += quantity
 
 				// 释放锁定的基本资产
-				lockQuote := positonOrder.Price * order.Quantity / leverage
+				lockQuote := positonOrder.Price * quantity / leverage
 				p.assets[quote].Lock -= lockQuote
-				p.assets[quote].Free += lockQuote + (positonOrder.Price-orderPrice)*order.Quantity
+				p.assets[quote].Free += lockQuote + (positonOrder.Price-orderPrice)*quantity
 
-				p.CalculateEquityValue(order.UpdatedAt, order.PositionSide, order.Pair, order.Quantity)
+				p.CalculateEquityValue(candle.Time, order.PositionSide, order.Pair, quantity)
 			}
 		}
 
@@ -638,47 +1416,57 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 				if _, ok := p.assets[asset]; !ok {
 					p.assets[asset] = &assetInfo{}
 				}
+				// 查询对应的仓位 当前无仓位时不需要平仓，平仓数量不超过实际持有数量
+				positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag)
+				if err != nil {
+					continue
+				}
+				quantity := math.Min(order.Quantity, positonOrder.Quantity)
 				var orderPrice float64
 				if (order.Type == model.OrderTypeStop || order.Type == model.OrderTypeStopMarket) && order.Price >= candle.Low {
-					orderPrice = order.Price
+					orderPrice = p.takerPrice(order.Side, order.Pair, order.Price, quantity, candle)
 				} else if order.Type == model.OrderTypeMarket {
-					orderPrice = order.Price
+					orderPrice = p.takerPrice(order.Side, order.Pair, candle.Open, quantity, candle)
 				} else {
 					continue
 				}
-				// 查询对应的仓位 当前无仓位时不需要平仓
-				positonOrder, err := p.findPositonOrder(order.Pair, order.OrderFlag, model.OrderTypeLimit)
-				if err != nil {
-					continue
-				}
-				p.volume[candle.Pair] += orderPrice * order.Quantity
+				p.volume[candle.Pair] += orderPrice * quantity
 				p.orders[i].UpdatedAt = candle.Time
 				p.orders[i].Status = model.OrderStatusTypeFilled
+				p.orders[i].Price = orderPrice
+				p.orders[i].Quantity = quantity
+				p.chargeFee(&p.orders[i], orderPrice, quantity)
+				p.finishPosition(order.Pair, order.OrderFlag)
 
 				// update assets size
-				p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
+				p.updateAveragePrice(order.Side, order.Pair, quantity, orderPrice)
 				p.assets[asset].Free = 0
-				p.assets[asset].Lock -= order.Quantity
+				p.assets[asset].Lock -= quantity
 
 				// 释放锁定的基本资产
-				lockQuote := positonOrder.Price * order.Quantity / leverage
+				lockQuote := positonOrder.Price * quantity / leverage
 				p.assets[quote].Lock -= lockQuote
-				p.assets[quote].Free += lockQuote + (orderPrice-positonOrder.Price)*order.Quantity
+				p.assets[quote].Free += lockQuote + (orderPrice-positonOrder.Price)*quantity
 
-				p.CalculateEquityValue(order.UpdatedAt, order.PositionSide, order.Pair, order.Quantity)
+				p.CalculateEquityValue(candle.Time, order.PositionSide, order.Pair, quantity)
 			}
 			// 开空单
-			if order.PositionSide == model.PositionSideTypeShort && order.Price <= candle.High {
+			if order.PositionSide == model.PositionSideTypeShort && (order.Type == model.OrderTypeMarket || order.Price <= candle.High) {
 				if _, ok := p.assets[quote]; !ok {
 					p.assets[quote] = &assetInfo{}
 				}
-				var orderPrice float64
-				if order.Type == model.OrderTypeLimit {
-					orderPrice = order.Price
-				} else {
+				if order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeMarket {
+					continue
+				}
+				quantity := p.limitQuantity(order, candle)
+				if quantity <= 0 {
 					continue
 				}
-				volume := orderPrice * order.Quantity
+				orderPrice := order.Price
+				if order.Type == model.OrderTypeMarket {
+					orderPrice = p.takerPrice(order.Side, order.Pair, candle.Open, quantity, candle)
+				}
+				volume := orderPrice * quantity
 
 				// 锁定的资产
 				lockQuote := volume / leverage
@@ -688,15 +1476,15 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 				}
 
 				p.volume[candle.Pair] += volume
-				p.orders[i].UpdatedAt = candle.Time
-				p.orders[i].Status = model.OrderStatusTypeFilled
+				p.fillOrder(i, orderPrice, quantity, candle.Time)
+				p.chargeFee(&p.orders[i], orderPrice, quantity)
 
 				limitOrders[p.orders[i].OrderFlag] = p.orders[i]
 
 				// update assets size
-				p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
+				p.updateAveragePrice(order.Side, order.Pair, quantity, orderPrice)
 				p.assets[asset].Free = 0
-				p.assets[asset].Lock -= order.Quantity
+				p.assets[asset].Lock -= quantity
 
 				p.assets[quote].Lock += lockQuote
 				p.assets[quote].Free -= lockQuote
@@ -718,6 +1506,10 @@ func (p *PaperWallet) CalculateEquityValue(updatedAt time.Time, positionSide mod
 		Time:  updatedAt,
 		Value: quantity * p.lastCandle[pair].Close,
 	})
+	p.assetValues[pair] = append(p.assetValues[pair], AssetValue{
+		Time:  updatedAt,
+		Value: quantity * p.lastCandle[pair].Close,
+	})
 
 	baseCoinInfo := p.assets[p.baseCoin]
 	p.equityValues = append(p.equityValues, AssetValue{
@@ -756,8 +1548,37 @@ func (p *PaperWallet) PairAsset(pair string) (asset, quote float64, err error) {
 	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
 }
 
-func (b *PaperWallet) PairPosition() (map[string]map[string]*model.Position, error) {
-	panic("not implemented")
+// PairPosition 按交易对及持仓方向汇总当前持仓，空单数量为负数，与币安返回一致
+func (p *PaperWallet) PairPosition() (map[string]map[string]*model.Position, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	positions := map[string]map[string]*model.Position{}
+	for _, order := range p.openPositionOrders("") {
+		if _, ok := positions[order.Pair]; !ok {
+			positions[order.Pair] = make(map[string]*model.Position)
+		}
+		quantity := order.Quantity
+		if order.PositionSide == model.PositionSideTypeShort {
+			quantity = -quantity
+		}
+		position, ok := positions[order.Pair][string(order.PositionSide)]
+		if !ok {
+			positions[order.Pair][string(order.PositionSide)] = &model.Position{
+				Pair:         order.Pair,
+				Side:         string(order.Side),
+				PositionSide: string(order.PositionSide),
+				AvgPrice:     order.Price,
+				Quantity:     quantity,
+				Leverage:     p.PairOptions[order.Pair].Leverage,
+				MarginType:   string(p.PairOptions[order.Pair].MarginType),
+			}
+			continue
+		}
+		position.AvgPrice = (position.AvgPrice*calc.Abs(position.Quantity) + order.Price*order.Quantity) / (calc.Abs(position.Quantity) + order.Quantity)
+		position.Quantity += quantity
+	}
+	return positions, nil
 }
 
 func (p *PaperWallet) CreateOrderLimit(side model.SideType, positionSide model.PositionSideType, pair string,
@@ -785,8 +1606,8 @@ func (p *PaperWallet) CreateOrderLimit(side model.SideType, positionSide model.P
 		ClientOrderId:        clientOrderId,
 		OrderFlag:            orderFlag,
 		OpenType:             "paperwallet",
-		CreatedAt:            p.lastCandle[pair].Time,
-		UpdatedAt:            p.lastCandle[pair].Time,
+		CreatedAt:            p.clock.Now(),
+		UpdatedAt:            p.clock.Now(),
 		Pair:                 pair,
 		Side:                 side,
 		PositionSide:         positionSide,
@@ -801,13 +1622,21 @@ func (p *PaperWallet) CreateOrderLimit(side model.SideType, positionSide model.P
 		MatcherStrategy:      extra.MatcherStrategy,
 		StopLossPrice:        extra.StopLossPrice,
 	}
-	if positionSide == model.PositionSideTypeShort {
-		if p.lastCandle[pair].High >= order.Price {
-			order.Status = model.OrderStatusTypeFilled
-		}
-	} else {
-		if p.lastCandle[pair].Low <= order.Price {
-			order.Status = model.OrderStatusTypeFilled
+	// 无下单延迟且撮合模型允许全部成交时立即成交，否则等待后续K线撮合
+	// 使用价格路径模型时，K线内已走过的高低点不再参与撮合，仅按当前收盘价判断
+	high, low := p.lastCandle[pair].High, p.lastCandle[pair].Low
+	if p.pathModel != nil {
+		high, low = p.lastCandle[pair].Close, p.lastCandle[pair].Close
+	}
+	if p.latency == 0 && p.limitQuantity(order, p.lastCandle[pair]) >= order.Quantity {
+		if positionSide == model.PositionSideTypeShort {
+			if high >= order.Price {
+				order.Status = model.OrderStatusTypeFilled
+			}
+		} else {
+			if low <= order.Price {
+				order.Status = model.OrderStatusTypeFilled
+			}
 		}
 	}
 	err = p.updateFunds(&order)
@@ -832,18 +1661,12 @@ func (p *PaperWallet) CreateOrderMarket(side model.SideType, positionSide model.
 	}
 
 	currentQuantity := p.FormatQuantityFloat(pair, quantity, true)
-	currentPrice := p.FormatPriceFloat(pair, p.lastCandle[pair].Close)
+	currentPrice := p.takerPrice(side, pair, p.lastCandle[pair].Close, currentQuantity, p.lastCandle[pair])
 	err := p.validateFunds(side, positionSide, pair, currentQuantity, currentPrice)
 	if err != nil {
 		return model.Order{}, err
 	}
 
-	if _, ok := p.volume[pair]; !ok {
-		p.volume[pair] = 0
-	}
-
-	p.volume[pair] += currentPrice * currentQuantity
-
 	clientOrderId := strutil.RandomString(12)
 
 	order := model.Order{
@@ -851,13 +1674,13 @@ func (p *PaperWallet) CreateOrderMarket(side model.SideType, positionSide model.
 		ClientOrderId:        clientOrderId,
 		OrderFlag:            orderFlag,
 		OpenType:             "paperwallet",
-		CreatedAt:            p.lastCandle[pair].Time,
-		UpdatedAt:            p.lastCandle[pair].Time,
+		CreatedAt:            p.clock.Now(),
+		UpdatedAt:            p.clock.Now(),
 		Pair:                 pair,
 		Side:                 side,
 		PositionSide:         positionSide,
 		Type:                 model.OrderTypeMarket,
-		Status:               model.OrderStatusTypeFilled,
+		Status:               model.OrderStatusTypeNew,
 		Price:                currentPrice,
 		Quantity:             currentQuantity,
 		Leverage:             extra.Leverage,
@@ -866,6 +1689,11 @@ func (p *PaperWallet) CreateOrderMarket(side model.SideType, positionSide model.
 		MatcherStrategyCount: extra.MatcherStrategyCount,
 		MatcherStrategy:      extra.MatcherStrategy,
 	}
+	// 与限价单一致，无下单延迟且撮合模型允许全部成交时按最新收盘价立即成交
+	// 否则等待下单延迟后的首根K线按开盘价撮合，开仓单受撮合模型的成交量限制
+	if p.latency == 0 && (isLossLimitOrder(order) || p.limitQuantity(order, p.lastCandle[pair]) >= order.Quantity) {
+		order.Status = model.OrderStatusTypeFilled
+	}
 	err = p.updateFunds(&order)
 	if err != nil {
 		return model.Order{}, err
@@ -899,8 +1727,8 @@ func (p *PaperWallet) CreateOrderStopLimit(side model.SideType, positionSide mod
 		ClientOrderId:        clientOrderId,
 		OrderFlag:            extra.OrderFlag,
 		OpenType:             "paperwallet",
-		CreatedAt:            p.lastCandle[pair].Time,
-		UpdatedAt:            p.lastCandle[pair].Time,
+		CreatedAt:            p.clock.Now(),
+		UpdatedAt:            p.clock.Now(),
 		Pair:                 pair,
 		Side:                 side,
 		PositionSide:         positionSide,
@@ -923,6 +1751,9 @@ func (p *PaperWallet) CreateOrderStopLimit(side model.SideType, positionSide mod
 			order.Status = model.OrderStatusTypeFilled
 		}
 	}
+	if order.Status == model.OrderStatusTypeFilled {
+		order.Price = p.takerPrice(side, pair, order.Price, order.Quantity, p.lastCandle[pair])
+	}
 	err = p.updateFunds(&order)
 	if err != nil {
 		return model.Order{}, err
@@ -964,8 +1795,8 @@ func (p *PaperWallet) CreateOrderStopMarket(side model.SideType, positionSide mo
 		ClientOrderId:        clientOrderId,
 		OrderFlag:            extra.OrderFlag,
 		OpenType:             "paperwallet",
-		CreatedAt:            p.lastCandle[pair].Time,
-		UpdatedAt:            p.lastCandle[pair].Time,
+		CreatedAt:            p.clock.Now(),
+		UpdatedAt:            p.clock.Now(),
 		Pair:                 pair,
 		Side:                 side,
 		PositionSide:         positionSide,
@@ -989,14 +1820,23 @@ func (p *PaperWallet) Cancel(order model.Order) error {
 	defer p.Unlock()
 
 	for i, o := range p.orders {
-		if o.ExchangeID == order.ExchangeID {
-			p.orders[i].Status = model.OrderStatusTypeCanceled
+		if o.ExchangeID != order.ExchangeID {
+			continue
 		}
+		// 部分成交的挂单撤销后，已成交部分作为成交订单保留
+		if o.Status == model.OrderStatusTypePartiallyFilled {
+			p.finishPartial(i)
+			continue
+		}
+		p.orders[i].Status = model.OrderStatusTypeCanceled
 	}
 	return nil
 }
 
 func (p *PaperWallet) Orders(pair string) ([]model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
 	orders := make([]model.Order, 0)
 	for _, order := range p.orders {
 		if order.Pair == pair {
@@ -1007,6 +1847,9 @@ func (p *PaperWallet) Orders(pair string) ([]model.Order, error) {
 }
 
 func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
 	for _, order := range p.orders {
 		if order.ExchangeID == id {
 			return order, nil
@@ -1015,53 +1858,251 @@ func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
 	return model.Order{}, errors.New("current order not found")
 }
 
-func (p *PaperWallet) findPositonOrder(pair string, orderFlag string, orderType model.OrderType) (model.Order, error) {
+// findPositonOrder 查询仓位的开仓单，同一仓位多次开仓时价格为持仓均价，数量为实际持有数量(含部分成交)
+func (p *PaperWallet) findPositonOrder(pair string, orderFlag string) (model.Order, error) {
+	var position model.Order
 	for _, order := range p.orders {
-		if order.Pair == pair && order.Status == model.OrderStatusTypeFilled && order.OrderFlag == orderFlag && order.Type == orderType {
-			return order, nil
+		if order.Pair != pair || order.OrderFlag != orderFlag {
+			continue
+		}
+		// 已有成交的平仓单时仓位已平
+		if order.Status == model.OrderStatusTypeFilled && isLossLimitOrder(order) {
+			return model.Order{}, errors.New("position closed")
 		}
+		if !p.isHeld(order) {
+			continue
+		}
+		quantity := p.positionQuantity(order)
+		if position.ExchangeID == 0 {
+			position = order
+			position.Quantity = quantity
+			continue
+		}
+		position.Price = (position.Price*position.Quantity + order.Price*quantity) / (position.Quantity + quantity)
+		position.Quantity += quantity
+	}
+	if position.ExchangeID == 0 {
+		return model.Order{}, errors.New("order not found")
 	}
-	return model.Order{}, errors.New("order not found")
+	return position, nil
 }
 
 func (p *PaperWallet) BatchCreateOrderLimit(params []*model.OrderParam) ([]model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+	orders := make([]model.Order, 0, len(params))
+	for _, param := range params {
+		order, err := p.CreateOrderLimit(param.Side, param.PositionSide, param.Pair, param.Quantity, param.Limit, param.Extra)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
 }
 
 func (p *PaperWallet) BatchCreateOrderMarket(params []*model.OrderParam) ([]model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+	orders := make([]model.Order, 0, len(params))
+	for _, param := range params {
+		order, err := p.CreateOrderMarket(param.Side, param.PositionSide, param.Pair, param.Quantity, param.Extra)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+func isPositionOrder(order model.Order) bool {
+	return (order.Side == model.SideTypeBuy && order.PositionSide == model.PositionSideTypeLong) || (order.Side == model.SideTypeSell && order.PositionSide == model.PositionSideTypeShort)
+}
+
+func isLossLimitOrder(order model.Order) bool {
+	return (order.Side == model.SideTypeBuy && order.PositionSide == model.PositionSideTypeShort) || (order.Side == model.SideTypeSell && order.PositionSide == model.PositionSideTypeLong)
+}
+
+func (p *PaperWallet) GetOrdersForPostionLossUnfilled(orderFlag string) ([]*model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	orders := []*model.Order{}
+	for _, order := range p.orders {
+		if order.OrderFlag != orderFlag || order.Status != model.OrderStatusTypeNew || !isLossLimitOrder(order) {
+			continue
+		}
+		current := order
+		orders = append(orders, &current)
+	}
+	return orders, nil
+}
+
+// unfilledOrders 按仓位标识分组未成交订单，position 为开仓单，lossLimit 为平仓单
+func (p *PaperWallet) unfilledOrders(pair string, statuses ...model.OrderStatusType) map[string]map[string][]*model.Order {
+	unfilledOrders := map[string]map[string][]*model.Order{}
+	for _, order := range p.orders {
+		if pair != "" && order.Pair != pair {
+			continue
+		}
+		if !lo.Contains(statuses, order.Status) {
+			continue
+		}
+		if _, ok := unfilledOrders[order.OrderFlag]; !ok {
+			unfilledOrders[order.OrderFlag] = make(map[string][]*model.Order)
+		}
+		current := order
+		if isPositionOrder(order) {
+			unfilledOrders[order.OrderFlag]["position"] = append(unfilledOrders[order.OrderFlag]["position"], &current)
+		}
+		if isLossLimitOrder(order) {
+			unfilledOrders[order.OrderFlag]["lossLimit"] = append(unfilledOrders[order.OrderFlag]["lossLimit"], &current)
+		}
+	}
+	return unfilledOrders
 }
 
-func (p *PaperWallet) GetOrdersForPostionLossUnfilled(_ string) ([]*model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+func (p *PaperWallet) GetOrdersForUnfilled() (map[string]map[string][]*model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.unfilledOrders("", model.OrderStatusTypeNew), nil
 }
-func (b *PaperWallet) GetOrdersForUnfilled() (map[string]map[string][]*model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (p *PaperWallet) GetOrdersForPairUnfilled(pair string) (map[string]map[string][]*model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.unfilledOrders(pair, model.OrderStatusTypeNew, model.OrderStatusTypePartiallyFilled), nil
 }
-func (b *PaperWallet) GetOrdersForPairUnfilled(pair string) (map[string]map[string][]*model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (p *PaperWallet) GetPositionOrdersForPairUnfilled(pair string) (map[string]map[model.PositionSideType]*model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	unfilledOrders := map[string]map[model.PositionSideType]*model.Order{}
+	for _, order := range p.orders {
+		if order.Pair != pair || (order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled) {
+			continue
+		}
+		current := order
+		if isLossLimitOrder(order) {
+			if _, ok := unfilledOrders["lossLimit"]; !ok {
+				unfilledOrders["lossLimit"] = make(map[model.PositionSideType]*model.Order)
+			}
+			unfilledOrders["lossLimit"][order.PositionSide] = &current
+		}
+		if isPositionOrder(order) {
+			if _, ok := unfilledOrders["position"]; !ok {
+				unfilledOrders["position"] = make(map[model.PositionSideType]*model.Order)
+			}
+			unfilledOrders["position"][order.PositionSide] = &current
+		}
+	}
+	return unfilledOrders, nil
 }
-func (b *PaperWallet) GetPositionOrdersForPairUnfilled(pair string) (map[string]map[model.PositionSideType]*model.Order, error) {
-	//TODO implement me
-	panic("implement me")
+
+// buildPosition 根据开仓单及平仓单生成仓位，closeOrder 为空时为持仓中
+func (p *PaperWallet) buildPosition(order model.Order, closeOrder *model.Order) *model.Position {
+	position := &model.Position{
+		Pair:                 order.Pair,
+		OrderFlag:            order.OrderFlag,
+		Side:                 string(order.Side),
+		PositionSide:         string(order.PositionSide),
+		AvgPrice:             order.Price,
+		Quantity:             order.Quantity,
+		TotalQuantity:        order.Quantity,
+		UnitQuantity:         order.Quantity,
+		MoreCount:            1,
+		MarginType:           string(p.PairOptions[order.Pair].MarginType),
+		Leverage:             order.Leverage,
+		StopLossPrice:        order.StopLossPrice,
+		LongShortRatio:       order.LongShortRatio,
+		GuiderPositionRate:   order.GuiderPositionRate,
+		GuiderOrigin:         order.GuiderOrigin,
+		ChaseMode:            order.ChaseMode,
+		MatcherStrategyCount: order.MatcherStrategyCount,
+		Fee:                  order.Fee,
+		CreatedAt:            order.UpdatedAt,
+		UpdatedAt:            order.UpdatedAt,
+	}
+	if position.Leverage == 0 {
+		position.Leverage = p.PairOptions[order.Pair].Leverage
+	}
+	if closeOrder == nil {
+		return position
+	}
+
+	position.Status = 10
+	position.Quantity = 0
+	position.ClosePrice = closeOrder.Price
+	position.UpdatedAt = closeOrder.UpdatedAt
+	position.HighPrice = math.Max(order.Price, closeOrder.Price)
+	position.LowPrice = math.Min(order.Price, closeOrder.Price)
+	if item, ok := p.excursions[order.Pair+order.OrderFlag]; ok {
+		position.HighPrice = math.Max(position.HighPrice, item.High)
+		position.LowPrice = math.Min(position.LowPrice, item.Low)
+	}
+	if order.PositionSide == model.PositionSideTypeLong {
+		position.Profit = calc.AccurateSub(closeOrder.Price, order.Price) / order.Price
+		position.ProfitValue = calc.AccurateSub(closeOrder.Price, order.Price) * order.Quantity
+	} else {
+		position.Profit = calc.AccurateSub(order.Price, closeOrder.Price) / order.Price
+		position.ProfitValue = calc.AccurateSub(order.Price, closeOrder.Price) * order.Quantity
+	}
+	// 盈亏扣除开平仓手续费
+	position.Fee = order.Fee + closeOrder.Fee
+	position.ProfitValue -= position.Fee
+	position.Profit -= position.Fee / (order.Price * order.Quantity)
+	return position
 }
-func (b *PaperWallet) GetPositionsForPair(pair string) ([]*model.Position, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (p *PaperWallet) GetPositionsForPair(pair string) ([]*model.Position, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	positions := []*model.Position{}
+	for _, order := range p.openPositionOrders(pair) {
+		positions = append(positions, p.buildPosition(order, nil))
+	}
+	return positions, nil
 }
-func (b *PaperWallet) GetPositionsForOpened() ([]*model.Position, error) {
-	//TODO implement me
-	panic("implement me")
+
+func (p *PaperWallet) GetPositionsForOpened() ([]*model.Position, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	positions := []*model.Position{}
+	for _, order := range p.openPositionOrders("") {
+		positions = append(positions, p.buildPosition(order, nil))
+	}
+	return positions, nil
 }
 
-func (b *PaperWallet) GetPositionsForClosed(_ time.Time) ([]*model.Position, error) {
-	//TODO implement me
-	panic("implement me")
+func (p *PaperWallet) GetPositionsForClosed(start time.Time) ([]*model.Position, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	closeOrders := make(map[string]model.Order)
+	quantities := make(map[string]float64)
+	for _, order := range p.orders {
+		if order.Status == model.OrderStatusTypeFilled && isLossLimitOrder(order) {
+			closeOrders[order.Pair+order.OrderFlag] = order
+		}
+		if p.isHeld(order) {
+			quantities[order.Pair+order.OrderFlag] += order.Quantity
+		}
+	}
+	positions := []*model.Position{}
+	for _, order := range p.orders {
+		if !p.isHeld(order) {
+			continue
+		}
+		closeOrder, ok := closeOrders[order.Pair+order.OrderFlag]
+		if !ok || closeOrder.UpdatedAt.Before(start) {
+			continue
+		}
+		// 同一仓位有多笔开仓单时按开仓数量分摊平仓手续费
+		closeOrder.Fee *= order.Quantity / quantities[order.Pair+order.OrderFlag]
+		positions = append(positions, p.buildPosition(order, &closeOrder))
+	}
+	return positions, nil
 }
 
 func (p *PaperWallet) FormatPriceFloat(pair string, value float64) float64 {
@@ -0,0 +1,177 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils/clock"
+
+	"github.com/stretchr/testify/require"
+)
+
+var paperStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// paperCandle 第 index 根1分钟K线
+func paperCandle(index int, open, high, low, close, volume float64) model.Candle {
+	return model.Candle{
+		Pair:      "BTCUSDT",
+		Time:      paperStart.Add(time.Duration(index) * time.Minute),
+		UpdatedAt: paperStart.Add(time.Duration(index+1) * time.Minute),
+		Open:      open,
+		High:      high,
+		Low:       low,
+		Close:     close,
+		Volume:    volume,
+		Complete:  true,
+	}
+}
+
+func newTestPaperWallet(t *testing.T, options ...PaperWalletOption) (*PaperWallet, *clock.Candle) {
+	candleClock := clock.NewCandle()
+	options = append([]PaperWalletOption{
+		WithPaperAsset("USDT", 10000),
+		WithPaperFee(0.0002, 0.0005),
+		WithPaperClock(candleClock),
+	}, options...)
+	wallet := NewPaperWallet(context.Background(), "USDT", options...)
+	require.NoError(t, wallet.SetPairOption(context.Background(), model.PairOption{Pair: "BTCUSDT", Leverage: 1}))
+	return wallet, candleClock
+}
+
+// onPaperCandle 推进时钟至K线收盘后交由钱包撮合
+func onPaperCandle(wallet *PaperWallet, candleClock *clock.Candle, candle model.Candle) {
+	candleClock.Advance(candle.UpdatedAt)
+	wallet.OnCandle(candle)
+}
+
+func TestPaperWallet_MarketRoundTripFees(t *testing.T) {
+	wallet, candleClock := newTestPaperWallet(t)
+	onPaperCandle(wallet, candleClock, paperCandle(0, 100, 101, 99, 100, 100))
+
+	entry, err := wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 10, model.OrderExtra{})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, entry.Status)
+	// 吃单费率: 100 * 10 * 0.0005
+	require.InDelta(t, 0.5, entry.Fee, 1e-9)
+	require.InDelta(t, 10000-1000-0.5, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 1000, wallet.assets["USDT"].Lock, 1e-9)
+
+	onPaperCandle(wallet, candleClock, paperCandle(1, 100, 111, 100, 110, 100))
+	exit, err := wallet.CreateOrderMarket(model.SideTypeSell, model.PositionSideTypeLong, "BTCUSDT", 10, model.OrderExtra{OrderFlag: entry.OrderFlag})
+	require.NoError(t, err)
+	require.InDelta(t, 0.55, exit.Fee, 1e-9)
+
+	require.InDelta(t, 1.05, wallet.Fees("BTCUSDT"), 1e-9)
+	require.InDelta(t, 10000+100-1.05, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+
+	positions, err := wallet.GetPositionsForClosed(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.InDelta(t, 100-1.05, positions[0].ProfitValue, 1e-9)
+}
+
+func TestPaperWallet_ScaleInCloseFee(t *testing.T) {
+	wallet, candleClock := newTestPaperWallet(t)
+	onPaperCandle(wallet, candleClock, paperCandle(0, 100, 101, 99, 100, 100))
+	entry, err := wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 10, model.OrderExtra{})
+	require.NoError(t, err)
+
+	// 加仓
+	onPaperCandle(wallet, candleClock, paperCandle(1, 100, 111, 100, 110, 100))
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 10, model.OrderExtra{OrderFlag: entry.OrderFlag})
+	require.NoError(t, err)
+
+	onPaperCandle(wallet, candleClock, paperCandle(2, 110, 121, 110, 120, 100))
+	exit, err := wallet.CreateOrderMarket(model.SideTypeSell, model.PositionSideTypeLong, "BTCUSDT", 20, model.OrderExtra{OrderFlag: entry.OrderFlag})
+	require.NoError(t, err)
+	require.InDelta(t, 1.2, exit.Fee, 1e-9)
+
+	positions, err := wallet.GetPositionsForClosed(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, positions, 2)
+	// 平仓手续费按开仓数量各分摊 0.6
+	require.InDelta(t, 0.5+0.6, positions[0].Fee, 1e-9)
+	require.InDelta(t, 0.55+0.6, positions[1].Fee, 1e-9)
+	require.InDelta(t, 200-1.1, positions[0].ProfitValue, 1e-9)
+	require.InDelta(t, 100-1.15, positions[1].ProfitValue, 1e-9)
+	require.InDelta(t, wallet.Fees("BTCUSDT"), positions[0].Fee+positions[1].Fee, 1e-9)
+}
+
+func TestPaperWallet_LimitStopRoundTripFees(t *testing.T) {
+	wallet, candleClock := newTestPaperWallet(t)
+	onPaperCandle(wallet, candleClock, paperCandle(0, 100, 101, 99, 100, 100))
+
+	entry, err := wallet.CreateOrderLimit(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 10, 99, model.OrderExtra{})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, entry.Status)
+	// 挂单费率: 99 * 10 * 0.0002
+	require.InDelta(t, 0.198, entry.Fee, 1e-9)
+
+	_, err = wallet.CreateOrderStopMarket(model.SideTypeSell, model.PositionSideTypeLong, "BTCUSDT", 10, 95, model.OrderExtra{OrderFlag: entry.OrderFlag})
+	require.NoError(t, err)
+	onPaperCandle(wallet, candleClock, paperCandle(1, 99, 99, 94, 95, 100))
+
+	orders, err := wallet.Orders("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, model.OrderStatusTypeFilled, orders[1].Status)
+	// 止损按触发价吃单成交: 95 * 10 * 0.0005
+	require.InDelta(t, 0.475, orders[1].Fee, 1e-9)
+	require.InDelta(t, 0.673, wallet.Fees("BTCUSDT"), 1e-9)
+	require.InDelta(t, 10000-40-0.673, wallet.assets["USDT"].Free, 1e-9)
+}
+
+func TestPaperWallet_PartialEntryPosition(t *testing.T) {
+	wallet, candleClock := newTestPaperWallet(t, WithPaperFillModel(PartialFill{MaxParticipation: 0.5}))
+	onPaperCandle(wallet, candleClock, paperCandle(0, 100, 101, 99, 100, 100))
+
+	entry, err := wallet.CreateOrderLimit(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 10, 98.5, model.OrderExtra{})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, entry.Status)
+
+	// K线成交量 8，最多成交 4
+	onPaperCandle(wallet, candleClock, paperCandle(1, 100, 100, 98, 99, 8))
+	positions, err := wallet.GetPositionsForPair("BTCUSDT")
+	require.NoError(t, err)
+	require.Len(t, positions, 1)
+	require.InDelta(t, 4, positions[0].Quantity, 1e-9)
+
+	// 止损仅平掉实际持有的数量，剩余开仓挂单不再成交 (K线无成交量，开仓单无法继续成交)
+	_, err = wallet.CreateOrderStopMarket(model.SideTypeSell, model.PositionSideTypeLong, "BTCUSDT", 10, 95, model.OrderExtra{OrderFlag: entry.OrderFlag})
+	require.NoError(t, err)
+	onPaperCandle(wallet, candleClock, paperCandle(2, 99, 99, 94, 95, 0))
+	onPaperCandle(wallet, candleClock, paperCandle(3, 95, 99, 94, 98, 100))
+
+	orders, err := wallet.Orders("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, orders[0].Status)
+	require.InDelta(t, 4, orders[0].Quantity, 1e-9)
+	require.InDelta(t, 4, orders[1].Quantity, 1e-9)
+	require.InDelta(t, 0, wallet.assets["BTC"].Lock, 1e-9)
+	require.InDelta(t, 0, wallet.assets["USDT"].Lock, 1e-9)
+}
+
+func TestPaperWallet_MarketLatency(t *testing.T) {
+	wallet, candleClock := newTestPaperWallet(t, WithPaperLatency(time.Second))
+	onPaperCandle(wallet, candleClock, paperCandle(0, 100, 101, 99, 100, 100))
+
+	market, err := wallet.CreateOrderMarket(model.SideTypeBuy, model.PositionSideTypeLong, "BTCUSDT", 2, model.OrderExtra{})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, market.Status)
+
+	// 下单延迟内的K线不参与撮合，之后的首根K线按开盘价成交
+	onPaperCandle(wallet, candleClock, paperCandle(1, 100, 101, 99, 100, 100))
+	market, err = wallet.Order("BTCUSDT", market.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, market.Status)
+
+	onPaperCandle(wallet, candleClock, paperCandle(2, 97, 98, 96, 97, 100))
+	market, err = wallet.Order("BTCUSDT", market.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+	require.InDelta(t, 97, market.Price, 1e-9)
+	require.InDelta(t, 97*2*0.0005, market.Fee, 1e-9)
+}
@@ -0,0 +1,87 @@
+package exchange
+
+import (
+	"floolishman/model"
+	"math"
+	"time"
+)
+
+// PathModel K线内价格路径模型，将一根K线拆分为按时间顺序撮合的若干段
+type PathModel interface {
+	Path(candle model.Candle) []model.Candle
+}
+
+// OriginCandleSource 提供原始周期K线，用于K线内路径下钻
+type OriginCandleSource interface {
+	OriginCandles(pair string, start, end time.Time) []model.Candle
+}
+
+func pathLeg(candle model.Candle, from, to, volume float64) model.Candle {
+	leg := candle
+	leg.Open = from
+	leg.Close = to
+	leg.High = math.Max(from, to)
+	leg.Low = math.Min(from, to)
+	leg.Volume = volume
+	return leg
+}
+
+// OHLCPath 按K线方向推断路径: 阳线 O→L→H→C，阴线 O→H→L→C，成交量平均分配
+type OHLCPath struct{}
+
+func (o OHLCPath) Path(candle model.Candle) []model.Candle {
+	volume := candle.Volume / 3
+	if candle.Close >= candle.Open {
+		return []model.Candle{
+			pathLeg(candle, candle.Open, candle.Low, volume),
+			pathLeg(candle, candle.Low, candle.High, volume),
+			pathLeg(candle, candle.High, candle.Close, volume),
+		}
+	}
+	return []model.Candle{
+		pathLeg(candle, candle.Open, candle.High, volume),
+		pathLeg(candle, candle.High, candle.Low, volume),
+		pathLeg(candle, candle.Low, candle.Close, volume),
+	}
+}
+
+// DrillDownPath 下钻到原始周期K线 (如 CSVFeed 的 1m 数据) 逐根撮合，已撮合过的原始K线不再重复撮合
+// Fallback 用于拆分每根原始K线，以及没有原始K线时的整根K线
+type DrillDownPath struct {
+	Source   OriginCandleSource
+	Fallback PathModel
+	last     map[string]time.Time
+}
+
+func NewDrillDownPath(source OriginCandleSource, fallback PathModel) *DrillDownPath {
+	return &DrillDownPath{
+		Source:   source,
+		Fallback: fallback,
+		last:     make(map[string]time.Time),
+	}
+}
+
+func (d *DrillDownPath) split(candle model.Candle) []model.Candle {
+	if d.Fallback == nil {
+		return []model.Candle{candle}
+	}
+	return d.Fallback.Path(candle)
+}
+
+func (d *DrillDownPath) Path(candle model.Candle) []model.Candle {
+	origins := d.Source.OriginCandles(candle.Pair, candle.Time, candle.UpdatedAt)
+	if len(origins) == 0 {
+		return d.split(candle)
+	}
+
+	path := make([]model.Candle, 0, len(origins))
+	last, ok := d.last[candle.Pair]
+	for _, origin := range origins {
+		if ok && !origin.Time.After(last) {
+			continue
+		}
+		path = append(path, d.split(origin)...)
+		d.last[candle.Pair] = origin.Time
+	}
+	return path
+}
@@ -0,0 +1,342 @@
+package exchange
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"floolishman/utils"
+)
+
+// RequestPriority REST 请求优先级，数值越小越优先
+type RequestPriority int
+
+const (
+	// PriorityOrder 下单、改单及撤单
+	PriorityOrder RequestPriority = iota
+	// PriorityAccount 账户、仓位及订单查询等私有接口
+	PriorityAccount
+	// PriorityData 行情及交易规则等公开数据
+	PriorityData
+)
+
+func (p RequestPriority) String() string {
+	switch p {
+	case PriorityOrder:
+		return "order"
+	case PriorityAccount:
+		return "account"
+	default:
+		return "data"
+	}
+}
+
+// RateLimitShares 各优先级可使用的权重比例，剩余额度留给更高优先级的请求
+var RateLimitShares = map[RequestPriority]float64{
+	PriorityOrder:   1,
+	PriorityAccount: 0.9,
+	PriorityData:    0.7,
+}
+
+// RateLimitBanDuration 返回 418 且未指定 Retry-After 时的封禁等待时长
+var RateLimitBanDuration = 2 * time.Minute
+
+// 同一 IP 共用权重，所有同类交易所实例共用同一个限速器
+var (
+	FuturesRateLimiter = NewRateLimiter(2400, 1200, futuresRequestWeight)
+	SpotRateLimiter    = NewRateLimiter(6000, 0, spotRequestWeight)
+)
+
+// RateUsage 限速器当前分钟的用量
+type RateUsage struct {
+	Weight      int            `json:"weight"`
+	WeightLimit int            `json:"weightLimit"`
+	Orders      int            `json:"orders"`
+	OrderLimit  int            `json:"orderLimit"`
+	Waiting     map[string]int `json:"waiting"`
+	BannedUntil time.Time      `json:"bannedUntil"`
+}
+
+// RateLimiter 币安 REST 请求权重及下单数限速器
+// 按自然分钟统计用量，取本地预估与响应头 X-MBX-USED-WEIGHT-1M / X-MBX-ORDER-COUNT-1M 中的较大值
+// 额度不足时请求等待至下一分钟，收到 429/418 时所有请求等待至 Retry-After 之后
+type RateLimiter struct {
+	mu          sync.Mutex
+	weightLimit int
+	orderLimit  int
+	weights     func(*http.Request) int
+	window      time.Time
+	weight      int
+	orders      int
+	waiting     map[RequestPriority]int
+	bannedUntil time.Time
+}
+
+// NewRateLimiter orderLimit 为0时不限制下单数，weights 为单个请求的预估权重
+func NewRateLimiter(weightLimit, orderLimit int, weights func(*http.Request) int) *RateLimiter {
+	return &RateLimiter{
+		weightLimit: weightLimit,
+		orderLimit:  orderLimit,
+		weights:     weights,
+		waiting:     make(map[RequestPriority]int),
+	}
+}
+
+// SetLimits 按交易规则更新每分钟的权重及下单数上限，0 表示保持不变
+func (l *RateLimiter) SetLimits(weightLimit, orderLimit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if weightLimit > 0 {
+		l.weightLimit = weightLimit
+	}
+	if orderLimit > 0 {
+		l.orderLimit = orderLimit
+	}
+}
+
+// Usage 当前分钟的用量及各优先级等待中的请求数
+func (l *RateLimiter) Usage() RateUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.roll(time.Now())
+	waiting := make(map[string]int, len(l.waiting))
+	for priority, count := range l.waiting {
+		waiting[priority.String()] = count
+	}
+	return RateUsage{
+		Weight:      l.weight,
+		WeightLimit: l.weightLimit,
+		Orders:      l.orders,
+		OrderLimit:  l.orderLimit,
+		Waiting:     waiting,
+		BannedUntil: l.bannedUntil,
+	}
+}
+
+// roll 进入新的一分钟时重置用量
+func (l *RateLimiter) roll(now time.Time) {
+	if window := now.Truncate(time.Minute); window.After(l.window) {
+		l.window, l.weight, l.orders = window, 0, 0
+	}
+}
+
+// Wait 等待额度后占用 weight，order 为 true 时同时占用一次下单数，ctx 结束时返回错误
+func (l *RateLimiter) Wait(ctx context.Context, priority RequestPriority, weight int, order bool) error {
+	waiting := false
+	defer func() {
+		if waiting {
+			l.mu.Lock()
+			if l.waiting[priority]--; l.waiting[priority] <= 0 {
+				delete(l.waiting, priority)
+			}
+			l.mu.Unlock()
+		}
+	}()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.roll(now)
+		var wait time.Duration
+		switch {
+		case now.Before(l.bannedUntil):
+			wait = l.bannedUntil.Sub(now)
+		case float64(l.weight+weight) > float64(l.weightLimit)*RateLimitShares[priority],
+			order && l.orderLimit > 0 && l.orders >= l.orderLimit:
+			wait = l.window.Add(time.Minute).Sub(now)
+		default:
+			l.weight += weight
+			if order {
+				l.orders++
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		if !waiting {
+			waiting = true
+			l.waiting[priority]++
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Update 按响应头校正用量，429/418 时按 Retry-After 暂停全部请求
+func (l *RateLimiter) Update(response *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.roll(now)
+	if used, err := strconv.Atoi(response.Header.Get("X-Mbx-Used-Weight-1m")); err == nil {
+		l.weight = max(l.weight, used)
+	}
+	if orders, err := strconv.Atoi(response.Header.Get("X-Mbx-Order-Count-1m")); err == nil {
+		l.orders = max(l.orders, orders)
+	}
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusTeapot {
+		return
+	}
+	until := l.window.Add(time.Minute)
+	if response.StatusCode == http.StatusTeapot {
+		until = now.Add(RateLimitBanDuration)
+	}
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		until = now.Add(time.Duration(seconds) * time.Second)
+	}
+	if until.After(l.bannedUntil) {
+		l.bannedUntil = until
+	}
+	utils.Log.Warnf("[RATE LIMIT] %d %s, waiting until %s", response.StatusCode, response.Request.URL.Path, until.Format(time.RFC3339))
+}
+
+// Transport 包装 base，请求前等待额度，响应后校正用量，base 为空时使用 http.DefaultTransport
+func (l *RateLimiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{limiter: l, base: base}
+}
+
+// Client 返回使用限速器的 http.Client，保留 client 的代理等配置且不修改 client 本身
+func (l *RateLimiter) Client(client *http.Client) *http.Client {
+	limited := &http.Client{}
+	if client != nil {
+		*limited = *client
+	}
+	limited.Transport = l.Transport(limited.Transport)
+	return limited
+}
+
+type rateLimitTransport struct {
+	limiter *RateLimiter
+	base    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	priority := requestPriority(request)
+	order := priority == PriorityOrder && request.Method == http.MethodPost
+	if err := t.limiter.Wait(request.Context(), priority, t.limiter.weights(request), order); err != nil {
+		return nil, err
+	}
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	t.limiter.Update(response)
+	return response, nil
+}
+
+// requestPriority 按接口路径及方法判断优先级
+func requestPriority(request *http.Request) RequestPriority {
+	path := request.URL.Path
+	endpoint := path[strings.LastIndex(path, "/")+1:]
+	switch endpoint {
+	case "order", "batchOrders", "allOpenOrders":
+		if request.Method != http.MethodGet {
+			return PriorityOrder
+		}
+		return PriorityAccount
+	case "account", "balance", "positionRisk", "openOrders", "openOrder", "allOrders", "userTrades", "income",
+		"leverage", "marginType", "positionSide", "leverageBracket", "listenKey", "userDataStream":
+		return PriorityAccount
+	}
+	return PriorityData
+}
+
+// klineWeight K线接口按 limit 计算权重，未指定时为默认的500根
+func klineWeight(request *http.Request, weights ...int) int {
+	limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 500
+	}
+	switch {
+	case limit < 100:
+		return weights[0]
+	case limit < 500:
+		return weights[1]
+	case limit <= 1000:
+		return weights[2]
+	default:
+		return weights[3]
+	}
+}
+
+// futuresRequestWeight U本位合约接口的预估权重，未列出的接口按1计算
+func futuresRequestWeight(request *http.Request) int {
+	path := request.URL.Path
+	hasSymbol := request.URL.Query().Get("symbol") != ""
+	switch {
+	case strings.HasSuffix(path, "Klines"), strings.HasSuffix(path, "/klines"):
+		return klineWeight(request, 1, 2, 5, 10)
+	case strings.HasSuffix(path, "/depth"):
+		return klineWeight(request, 2, 5, 10, 20)
+	case strings.HasSuffix(path, "/account"), strings.HasSuffix(path, "/positionRisk"), strings.HasSuffix(path, "/balance"),
+		strings.HasSuffix(path, "/allOrders"), strings.HasSuffix(path, "/userTrades"):
+		return 5
+	case strings.HasSuffix(path, "/openOrders"), strings.HasSuffix(path, "/ticker/24hr"):
+		if hasSymbol {
+			return 1
+		}
+		return 40
+	case strings.HasSuffix(path, "/income"):
+		return 30
+	}
+	return 1
+}
+
+// spotRequestWeight 现货接口的预估权重，未列出的接口按1计算
+func spotRequestWeight(request *http.Request) int {
+	path := request.URL.Path
+	hasSymbol := request.URL.Query().Get("symbol") != ""
+	switch {
+	case strings.HasSuffix(path, "/klines"):
+		return 2
+	case strings.HasSuffix(path, "/depth"):
+		return klineWeight(request, 5, 25, 50, 250)
+	case strings.HasSuffix(path, "/account"), strings.HasSuffix(path, "/allOrders"), strings.HasSuffix(path, "/myTrades"),
+		strings.HasSuffix(path, "/exchangeInfo"):
+		return 20
+	case strings.HasSuffix(path, "/openOrders"):
+		if hasSymbol {
+			return 6
+		}
+		return 80
+	case strings.HasSuffix(path, "/ticker/24hr"):
+		if hasSymbol {
+			return 2
+		}
+		return 80
+	}
+	return 1
+}
+
+// rateLimit 交易规则中的限速项，现货与合约字段一致
+type rateLimit struct {
+	RateLimitType string
+	Interval      string
+	IntervalNum   int64
+	Limit         int64
+}
+
+// rateLimits 从交易规则中取每分钟的权重及下单数上限
+func rateLimits(items []rateLimit) (weightLimit, orderLimit int) {
+	for _, item := range items {
+		if item.Interval != "MINUTE" || item.IntervalNum != 1 {
+			continue
+		}
+		switch item.RateLimitType {
+		case "REQUEST_WEIGHT":
+			weightLimit = int(item.Limit)
+		case "ORDERS":
+			orderLimit = int(item.Limit)
+		}
+	}
+	return weightLimit, orderLimit
+}
@@ -0,0 +1,128 @@
+package exchange
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func rateLimitResponse(status int, headers map[string]string) *http.Response {
+	response := &http.Response{
+		StatusCode: status,
+		Header:     make(http.Header),
+		Request:    &http.Request{URL: &url.URL{Path: "/fapi/v1/order"}},
+	}
+	for name, value := range headers {
+		response.Header.Set(name, value)
+	}
+	return response
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name     string
+		used     int
+		priority RequestPriority
+		weight   int
+		order    bool
+		orders   int
+		allowed  bool
+	}{
+		{name: "data within share", used: 60, priority: PriorityData, weight: 10, allowed: true},
+		{name: "data over share", used: 65, priority: PriorityData, weight: 10},
+		{name: "account within share", used: 65, priority: PriorityAccount, weight: 10, allowed: true},
+		{name: "account over share", used: 85, priority: PriorityAccount, weight: 10},
+		{name: "order uses full limit", used: 90, priority: PriorityOrder, weight: 10, order: true, allowed: true},
+		{name: "order over limit", used: 95, priority: PriorityOrder, weight: 10, order: true},
+		{name: "order count exhausted", priority: PriorityOrder, weight: 1, order: true, orders: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(100, 5, futuresRequestWeight)
+			limiter.Update(rateLimitResponse(http.StatusOK, map[string]string{
+				"X-Mbx-Used-Weight-1m": strconv.Itoa(tt.used),
+				"X-Mbx-Order-Count-1m": strconv.Itoa(tt.orders),
+			}))
+			// 分钟切换时额度重置，等待中的请求会在下一分钟放行，避免边界上的偶发失败
+			if time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)) < time.Second {
+				t.Skip("too close to the next minute")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := limiter.Wait(ctx, tt.priority, tt.weight, tt.order)
+			usage := limiter.Usage()
+			if tt.allowed {
+				require.NoError(t, err)
+				require.Equal(t, tt.used+tt.weight, usage.Weight)
+			} else {
+				require.ErrorIs(t, err, context.DeadlineExceeded)
+				require.Equal(t, tt.used, usage.Weight)
+			}
+			require.Empty(t, usage.Waiting)
+		})
+	}
+}
+
+func TestRateLimiter_Update(t *testing.T) {
+	banDuration := RateLimitBanDuration
+	RateLimitBanDuration = 10 * time.Minute
+	defer func() { RateLimitBanDuration = banDuration }()
+
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		weight  int
+		orders  int
+		banned  time.Duration
+	}{
+		{name: "header raises usage", status: http.StatusOK,
+			headers: map[string]string{"X-Mbx-Used-Weight-1m": "40", "X-Mbx-Order-Count-1m": "3"}, weight: 40, orders: 3},
+		{name: "header below local estimate", status: http.StatusOK,
+			headers: map[string]string{"X-Mbx-Used-Weight-1m": "5"}, weight: 20, orders: 1},
+		{name: "429 retry after", status: http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "30"}, weight: 20, orders: 1, banned: 30 * time.Second},
+		{name: "418 retry after", status: http.StatusTeapot,
+			headers: map[string]string{"Retry-After": "300"}, weight: 20, orders: 1, banned: 300 * time.Second},
+		{name: "418 default ban", status: http.StatusTeapot, weight: 20, orders: 1, banned: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewRateLimiter(100, 5, futuresRequestWeight)
+			require.NoError(t, limiter.Wait(context.Background(), PriorityOrder, 20, true))
+
+			now := time.Now()
+			limiter.Update(rateLimitResponse(tt.status, tt.headers))
+			usage := limiter.Usage()
+			if usage.Weight == 0 {
+				t.Skip("minute rolled over during the test")
+			}
+			require.Equal(t, tt.weight, usage.Weight)
+			require.Equal(t, tt.orders, usage.Orders)
+			if tt.banned == 0 {
+				require.True(t, usage.BannedUntil.IsZero())
+				return
+			}
+			require.WithinDuration(t, now.Add(tt.banned), usage.BannedUntil, time.Second)
+
+			// 封禁期间所有优先级的请求都需等待
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			require.ErrorIs(t, limiter.Wait(ctx, PriorityOrder, 1, false), context.DeadlineExceeded)
+		})
+	}
+}
+
+func TestRateLimiter_429WithoutRetryAfter(t *testing.T) {
+	limiter := NewRateLimiter(100, 0, futuresRequestWeight)
+	limiter.Update(rateLimitResponse(http.StatusTooManyRequests, nil))
+	// 未指定 Retry-After 时等待至下一分钟
+	next := time.Now().Truncate(time.Minute).Add(time.Minute)
+	require.WithinDuration(t, next, limiter.Usage().BannedUntil, time.Second)
+}
@@ -0,0 +1,453 @@
+package exchange
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/jpillora/backoff"
+)
+
+// 录制的数据流，文件名为 {pair}-{stream}-{yyyy-mm-dd}.csv.gz，K线为 {pair}-candles-{timeframe}-{yyyy-mm-dd}.csv.gz
+const (
+	RecordAggTrades  = "aggTrades"
+	RecordBookTicker = "bookTicker"
+	RecordCandles    = "candles"
+)
+
+// RecordIndexExt 录制文件的索引后缀，每行为 时间(毫秒),偏移量，对应一个 gzip 分段的起始位置
+const RecordIndexExt = ".idx"
+
+// RecordSegment 每个 gzip 分段覆盖的时长，分段结束时数据落盘并写入索引
+var RecordSegment = time.Minute
+
+var recordHeaders = map[string][]string{
+	RecordAggTrades:  {"agg_trade_id", "price", "quantity", "first_trade_id", "last_trade_id", "transact_time", "is_buyer_maker"},
+	RecordBookTicker: {"update_id", "best_bid_price", "best_bid_qty", "best_ask_price", "best_ask_qty", "transaction_time", "event_time"},
+	RecordCandles:    {"time", "updated_at", "open", "close", "low", "high", "volume", "complete"},
+}
+
+type RecorderOption func(*Recorder)
+
+// WithRecorderProxy 录制逐笔数据流时使用的代理
+func WithRecorderProxy(url string) RecorderOption {
+	return func(recorder *Recorder) {
+		recorder.proxyUrl = url
+	}
+}
+
+// Recorder 录制实盘行情，按交易对及自然日(UTC)轮转为 gzip 压缩的 CSV 文件
+// 作为 bot.CandleSubscriber 记录每次K线推送(含未收线K线)，另可录制 aggTrades 及 bookTicker 数据流
+// 逐笔数据与币安公开数据格式一致，可直接由 TickFeed 回放
+type Recorder struct {
+	mu       sync.Mutex
+	dir      string
+	proxyUrl string
+	writers  map[string]*recordWriter
+	// 各交易对周期最后记录的K线更新时间，多个策略订阅同一周期时避免重复记录
+	candles map[string]time.Time
+}
+
+func NewRecorder(dir string, options ...RecorderOption) (*Recorder, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	recorder := &Recorder{
+		dir:     dir,
+		writers: make(map[string]*recordWriter),
+		candles: make(map[string]time.Time),
+	}
+	for _, option := range options {
+		option(recorder)
+	}
+	return recorder, nil
+}
+
+// OnCandle 记录K线推送，K线时间及更新时间为毫秒
+func (r *Recorder) OnCandle(timeframe string, candle model.Candle) {
+	key := fmt.Sprintf("%s--%s", candle.Pair, timeframe)
+	r.mu.Lock()
+	last, ok := r.candles[key]
+	if ok && !candle.UpdatedAt.After(last) {
+		r.mu.Unlock()
+		return
+	}
+	r.candles[key] = candle.UpdatedAt
+	r.mu.Unlock()
+
+	r.write(candle.Pair, fmt.Sprintf("%s-%s", RecordCandles, timeframe), RecordCandles, candle.UpdatedAt, []string{
+		strconv.FormatInt(candle.Time.UnixMilli(), 10),
+		strconv.FormatInt(candle.UpdatedAt.UnixMilli(), 10),
+		strconv.FormatFloat(candle.Open, 'f', -1, 64),
+		strconv.FormatFloat(candle.Close, 'f', -1, 64),
+		strconv.FormatFloat(candle.Low, 'f', -1, 64),
+		strconv.FormatFloat(candle.High, 'f', -1, 64),
+		strconv.FormatFloat(candle.Volume, 'f', -1, 64),
+		strconv.FormatBool(candle.Complete),
+	})
+}
+
+// Record 订阅交易对的 aggTrades 或 bookTicker 数据流并录制，断开后自动重连，直到 ctx 结束
+func (r *Recorder) Record(ctx context.Context, pair, stream string) error {
+	if stream != RecordAggTrades && stream != RecordBookTicker {
+		return fmt.Errorf("invalid record stream: %s", stream)
+	}
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+		errHandler := func(err error) {
+			utils.Log.Errorf("[RECORDER] %s %s: %s", pair, stream, err.Error())
+		}
+		// backoff 非并发安全，回调中仅标记收到过数据，由本协程重置
+		var received atomic.Bool
+		for {
+			if r.proxyUrl != "" {
+				futures.SetWsProxyUrl(r.proxyUrl)
+			}
+			var (
+				done, stop chan struct{}
+				err        error
+			)
+			if stream == RecordAggTrades {
+				done, stop, err = futures.WsAggTradeServe(pair, func(event *futures.WsAggTradeEvent) {
+					received.Store(true)
+					r.write(pair, stream, stream, time.UnixMilli(event.TradeTime), []string{
+						strconv.FormatInt(event.AggregateTradeID, 10),
+						event.Price,
+						event.Quantity,
+						strconv.FormatInt(event.FirstTradeID, 10),
+						strconv.FormatInt(event.LastTradeID, 10),
+						strconv.FormatInt(event.TradeTime, 10),
+						strconv.FormatBool(event.Maker),
+					})
+				}, errHandler)
+			} else {
+				done, stop, err = futures.WsBookTickerServe(pair, func(event *futures.WsBookTickerEvent) {
+					received.Store(true)
+					r.write(pair, stream, stream, time.UnixMilli(event.TransactionTime), []string{
+						strconv.FormatInt(event.UpdateID, 10),
+						event.BestBidPrice,
+						event.BestBidQty,
+						event.BestAskPrice,
+						event.BestAskQty,
+						strconv.FormatInt(event.TransactionTime, 10),
+						strconv.FormatInt(event.Time, 10),
+					})
+				}, errHandler)
+			}
+			if err != nil {
+				errHandler(err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(ba.Duration()):
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				return
+			case <-done:
+				if received.Swap(false) {
+					ba.Reset()
+				}
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+	return nil
+}
+
+// Close 结束全部分段并关闭文件
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for key, writer := range r.writers {
+		errs = append(errs, writer.Close())
+		delete(r.writers, key)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) write(pair, name, kind string, t time.Time, record []string) {
+	key := fmt.Sprintf("%s--%s", pair, name)
+	r.mu.Lock()
+	writer, ok := r.writers[key]
+	if !ok {
+		writer = &recordWriter{prefix: filepath.Join(r.dir, fmt.Sprintf("%s-%s", pair, name)), header: recordHeaders[kind]}
+		r.writers[key] = writer
+	}
+	r.mu.Unlock()
+
+	if err := writer.Write(t.UTC(), record); err != nil {
+		utils.Log.Errorf("[RECORDER] %s %s: %s", pair, name, err.Error())
+	}
+}
+
+// recordWriter 单个数据流的录制文件，跨自然日时轮转，每 RecordSegment 开始新的 gzip 分段
+type recordWriter struct {
+	mu      sync.Mutex
+	prefix  string
+	header  []string
+	day     string
+	file    *os.File
+	index   *os.File
+	offset  int64
+	segment time.Time
+	gzip    *gzip.Writer
+	csv     *csv.Writer
+}
+
+func (w *recordWriter) Write(t time.Time, record []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if day := t.Format(time.DateOnly); day != w.day {
+		if err := w.close(); err != nil {
+			return err
+		}
+		if err := w.open(day); err != nil {
+			return err
+		}
+	}
+	if w.gzip != nil && !t.Before(w.segment.Add(RecordSegment)) {
+		if err := w.closeSegment(); err != nil {
+			return err
+		}
+	}
+	if w.gzip == nil {
+		if err := w.openSegment(t); err != nil {
+			return err
+		}
+	}
+	return w.csv.Write(record)
+}
+
+// open 打开当日文件，文件已存在时先截掉未写完的分段再追加 (重启后继续录制)
+func (w *recordWriter) open(day string) error {
+	name := fmt.Sprintf("%s-%s.csv.gz", w.prefix, day)
+	size, err := repairRecord(name)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	index, err := os.OpenFile(name+RecordIndexExt, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.day, w.file, w.index, w.offset = day, file, index, size
+	return nil
+}
+
+func (w *recordWriter) openSegment(t time.Time) error {
+	if _, err := fmt.Fprintf(w.index, "%d,%d\n", t.UnixMilli(), w.offset); err != nil {
+		return err
+	}
+	w.segment = t
+	w.gzip = gzip.NewWriter(w.file)
+	w.csv = csv.NewWriter(w.gzip)
+	// 每个分段都带表头，从任意分段开始读取时格式一致
+	return w.csv.Write(w.header)
+}
+
+func (w *recordWriter) closeSegment() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	if err := w.gzip.Close(); err != nil {
+		return err
+	}
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	w.offset = info.Size()
+	w.gzip, w.csv = nil, nil
+	return nil
+}
+
+func (w *recordWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	var errs []error
+	if w.gzip != nil {
+		errs = append(errs, w.closeSegment())
+	}
+	errs = append(errs, w.index.Close(), w.file.Close())
+	w.day, w.file, w.index = "", nil, nil
+	return errors.Join(errs...)
+}
+
+func (w *recordWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.close()
+}
+
+// OpenRecord 打开录制文件，按索引定位到 start 所在分段开始读取，start 为零值或索引不存在时从头读取
+func OpenRecord(file string, start time.Time) (io.ReadCloser, error) {
+	offset, err := recordOffset(file, start)
+	if err != nil {
+		return nil, err
+	}
+	recordFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := recordFile.Seek(offset, io.SeekStart); err != nil {
+		recordFile.Close()
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bufio.NewReader(recordFile))
+	if err != nil {
+		recordFile.Close()
+		return nil, err
+	}
+	return &recordReader{Reader: reader, file: recordFile}, nil
+}
+
+// recordIndex 索引中的一个 gzip 分段
+type recordIndex struct {
+	time   int64
+	offset int64
+}
+
+// readRecordIndex 读取录制文件的索引，索引不存在时返回空
+func readRecordIndex(file string) ([]recordIndex, error) {
+	content, err := os.ReadFile(file + RecordIndexExt)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]recordIndex, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file+RecordIndexExt, err)
+		}
+		offset, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file+RecordIndexExt, err)
+		}
+		entries = append(entries, recordIndex{time: timestamp, offset: offset})
+	}
+	return entries, nil
+}
+
+// recordOffset 索引中 start 所在分段的起始偏移量
+func recordOffset(file string, start time.Time) (int64, error) {
+	if start.IsZero() {
+		return 0, nil
+	}
+	entries, err := readRecordIndex(file)
+	if err != nil {
+		return 0, err
+	}
+	// 分段按写入顺序排列，取最后一个不晚于 start 的分段
+	index := sort.Search(len(entries), func(i int) bool {
+		return entries[i].time > start.UnixMilli()
+	})
+	if index == 0 {
+		return 0, nil
+	}
+	return entries[index-1].offset, nil
+}
+
+// repairRecord 进程异常退出时最后一个分段可能未写完，截断至该分段起始位置并移除其索引，返回修复后的文件大小
+func repairRecord(file string) (int64, error) {
+	info, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	entries, err := readRecordIndex(file)
+	if err != nil {
+		return 0, err
+	}
+	size, count := info.Size(), len(entries)
+	// 未写入任何数据的分段
+	for len(entries) > 0 && entries[len(entries)-1].offset >= size {
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1].offset
+		if err := checkRecordSegment(file, last); err != nil {
+			utils.Log.Warnf("[RECORDER] %s: truncating incomplete segment at %d: %s", file, last, err.Error())
+			if err := os.Truncate(file, last); err != nil {
+				return 0, err
+			}
+			size, entries = last, entries[:len(entries)-1]
+		}
+	}
+	if len(entries) == count {
+		return size, nil
+	}
+	var content strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&content, "%d,%d\n", entry.time, entry.offset)
+	}
+	return size, os.WriteFile(file+RecordIndexExt, []byte(content.String()), 0644)
+}
+
+// checkRecordSegment 完整读取 offset 处开始的 gzip 分段，分段被截断时返回错误
+func checkRecordSegment(file string, offset int64) error {
+	recordFile, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+	if _, err := recordFile.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader, err := gzip.NewReader(bufio.NewReader(recordFile))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+type recordReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *recordReader) Close() error {
+	return errors.Join(r.Reader.Close(), r.file.Close())
+}
@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordWriter_RepairIncompleteSegment(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "BTCUSDT-bookTicker")
+	header := recordHeaders[RecordBookTicker]
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(value string) []string {
+		row := make([]string, len(header))
+		for i := range row {
+			row[i] = value
+		}
+		return row
+	}
+
+	// 正常结束的分段
+	writer := &recordWriter{prefix: prefix, header: header}
+	require.NoError(t, writer.Write(start, record("1")))
+	require.NoError(t, writer.Close())
+
+	// 未关闭的分段，仅部分数据落盘
+	crashed := &recordWriter{prefix: prefix, header: header}
+	require.NoError(t, crashed.Write(start.Add(time.Minute), record("2")))
+	crashed.csv.Flush()
+	require.NoError(t, crashed.gzip.Flush())
+	require.NoError(t, crashed.file.Close())
+	require.NoError(t, crashed.index.Close())
+
+	// 重启后继续录制
+	writer = &recordWriter{prefix: prefix, header: header}
+	require.NoError(t, writer.Write(start.Add(2*time.Minute), record("3")))
+	require.NoError(t, writer.Close())
+
+	file := prefix + "-2024-01-01.csv.gz"
+	entries, err := readRecordIndex(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, start.Add(2*time.Minute).UnixMilli(), entries[1].time)
+
+	reader, err := OpenRecord(file, time.Time{})
+	require.NoError(t, err)
+	defer reader.Close()
+	rows, err := csv.NewReader(reader).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{header, record("1"), header, record("3")}, rows)
+
+	// 从重启后的分段开始读取
+	offset, err := recordOffset(file, start.Add(2*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, entries[1].offset, offset)
+}
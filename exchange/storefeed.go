@@ -0,0 +1,200 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"floolishman/model"
+	"floolishman/utils"
+)
+
+// storeFeedBatch 流式推送时每次从文件读取的K线数量
+const storeFeedBatch = 4096
+
+// StoreFeed 基于列式K线文件的数据源
+// 与 CSVFeed 不同，K线不会一次性载入内存，按时间定位后分批读取推送，适合单周期的大数据量回放
+type StoreFeed struct {
+	stores     map[string]*CandleStore
+	timeframes map[string]string
+	from       map[string]int
+	to         map[string]int
+}
+
+// NewStoreFeed 打开各交易对的列式K线文件，文件周期须与 PairFeed.Timeframe 一致
+func NewStoreFeed(feeds ...PairFeed) (*StoreFeed, error) {
+	storeFeed := &StoreFeed{
+		stores:     make(map[string]*CandleStore),
+		timeframes: make(map[string]string),
+		from:       make(map[string]int),
+		to:         make(map[string]int),
+	}
+	for _, feed := range feeds {
+		store, err := OpenCandleStore(feed.File)
+		if err != nil {
+			storeFeed.Close()
+			return nil, err
+		}
+		if store.Timeframe() != feed.Timeframe {
+			store.Close()
+			storeFeed.Close()
+			return nil, fmt.Errorf("%s: timeframe %s, expected %s", feed.File, store.Timeframe(), feed.Timeframe)
+		}
+		key := storeFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)
+		storeFeed.stores[key] = store
+		storeFeed.to[key] = store.Len()
+		if _, ok := storeFeed.timeframes[feed.Pair]; !ok {
+			storeFeed.timeframes[feed.Pair] = feed.Timeframe
+		}
+	}
+	return storeFeed, nil
+}
+
+func (s *StoreFeed) feedTimeframeKey(pair, timeframe string) string {
+	return fmt.Sprintf("%s--%s", pair, timeframe)
+}
+
+// Close 关闭全部文件
+func (s *StoreFeed) Close() error {
+	var errs []error
+	for _, store := range s.stores {
+		errs = append(errs, store.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Period 仅回放 [start, end) 范围内的K线，零值表示不限制
+func (s *StoreFeed) Period(start, end time.Time) (*StoreFeed, error) {
+	for key, store := range s.stores {
+		if !start.IsZero() {
+			from, err := store.Search(start)
+			if err != nil {
+				return nil, err
+			}
+			s.from[key] = from
+		}
+		if !end.IsZero() {
+			to, err := store.Search(end)
+			if err != nil {
+				return nil, err
+			}
+			s.to[key] = to
+		}
+	}
+	return s, nil
+}
+
+// OriginCandles 返回交易对首个文件中 [start, end] 范围内的K线，供 DrillDownPath 下钻撮合
+func (s *StoreFeed) OriginCandles(pair string, start, end time.Time) []model.Candle {
+	timeframe, ok := s.timeframes[pair]
+	if !ok {
+		return nil
+	}
+	candles, err := s.stores[s.feedTimeframeKey(pair, timeframe)].Range(start, end)
+	if err != nil {
+		utils.Log.Errorf("[STORE FEED] %s %s: %s", pair, timeframe, err.Error())
+		return nil
+	}
+	return candles
+}
+
+func (s *StoreFeed) AssetsInfo(pair string) model.AssetInfo {
+	return CSVFeed{}.AssetsInfo(pair)
+}
+
+func (s *StoreFeed) AssetsInfos() map[string]model.AssetInfo {
+	return make(map[string]model.AssetInfo)
+}
+
+func (s *StoreFeed) LastQuote(_ context.Context, _ string) (float64, error) {
+	return 0, errors.New("invalid operation")
+}
+
+func (s *StoreFeed) SetPairOption(_ context.Context, _ model.PairOption) error {
+	return nil
+}
+
+func (s *StoreFeed) CandlesByPeriod(_ context.Context, pair, timeframe string, start, end time.Time) ([]model.Candle, error) {
+	store, ok := s.stores[s.feedTimeframeKey(pair, timeframe)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrInsufficientData, pair, timeframe)
+	}
+	return store.Range(start, end)
+}
+
+// CandlesByLimit 返回回放起点的前 limit 根K线用于预热，回放从其后开始
+func (s *StoreFeed) CandlesByLimit(_ context.Context, pair, timeframe string, limit int) ([]model.Candle, error) {
+	key := s.feedTimeframeKey(pair, timeframe)
+	store, ok := s.stores[key]
+	if !ok || s.to[key]-s.from[key] < limit {
+		return nil, fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+	}
+	candles, err := store.Read(s.from[key], s.from[key]+limit)
+	if err != nil {
+		return nil, err
+	}
+	s.from[key] += limit
+	return candles, nil
+}
+
+// stream 分批读取K线推送至 ccandle，读取出错时推送至 cerr
+func (s *StoreFeed) stream(ctx context.Context, key string, ccandle chan model.Candle, cerr chan error) {
+	store := s.stores[key]
+	for from := s.from[key]; from < s.to[key]; from += storeFeedBatch {
+		candles, err := store.Read(from, min(from+storeFeedBatch, s.to[key]))
+		if err != nil {
+			cerr <- err
+			return
+		}
+		for _, candle := range candles {
+			select {
+			case ccandle <- candle:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (s *StoreFeed) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error, 1)
+	key := s.feedTimeframeKey(pair, timeframe)
+	go func() {
+		defer close(ccandle)
+		defer close(cerr)
+		if _, ok := s.stores[key]; !ok {
+			return
+		}
+		s.stream(ctx, key, ccandle, cerr)
+	}()
+	return ccandle, cerr
+}
+
+func (s *StoreFeed) CandlesBatchSubscription(ctx context.Context, combineConfig map[string]string) (map[string]chan model.Candle, chan error) {
+	pairCcandle := make(map[string]chan model.Candle)
+	cerr := make(chan error, len(combineConfig))
+	for pair, timeframe := range combineConfig {
+		key := s.feedTimeframeKey(pair, timeframe)
+		pairCcandle[key] = make(chan model.Candle)
+	}
+	done := make(chan struct{}, len(pairCcandle))
+	for key, ccandle := range pairCcandle {
+		go func(key string, ccandle chan model.Candle) {
+			defer func() { done <- struct{}{} }()
+			defer close(ccandle)
+			if _, ok := s.stores[key]; !ok {
+				return
+			}
+			s.stream(ctx, key, ccandle, cerr)
+		}(key, ccandle)
+	}
+	go func() {
+		for range pairCcandle {
+			<-done
+		}
+		close(cerr)
+	}()
+	return pairCcandle, cerr
+}
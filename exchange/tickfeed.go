@@ -0,0 +1,472 @@
+package exchange
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"floolishman/model"
+	"floolishman/reference"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// TickInterval 实盘K线推送间隔，回放时按此间隔合成未收线K线
+const TickInterval = 250 * time.Millisecond
+
+// Tick 逐笔成交或盘口报价，报价以买一卖一中间价计入价格，不计成交量
+type Tick struct {
+	Time     time.Time
+	Price    float64
+	Quantity float64
+}
+
+// TickPairFeed 交易对的逐笔数据文件，支持币安公开数据的 aggTrades 及 bookTicker (CSV 或 zip) 及 Recorder 录制的文件
+// 文件名包含 bookTicker 时按盘口报价读取，其余按归集成交读取
+type TickPairFeed struct {
+	Pair  string
+	Files []string
+}
+
+// TickFeed 按时间顺序回放逐笔数据，实时合成各周期K线
+// 与实盘K线推送一致，每个推送间隔内有更新时推送一次未收线K线 (Complete=false)，周期结束时推送收线K线
+// 预热及历史查询使用 history 中逐笔数据开始前的K线
+type TickFeed struct {
+	history  reference.Feeder
+	feeds    map[string]TickPairFeed
+	interval time.Duration
+	start    map[string]time.Time
+	end      time.Time
+}
+
+// NewTickFeed 读取各交易对首笔数据时间作为回放起点，interval 为0时使用 TickInterval
+func NewTickFeed(history reference.Feeder, interval time.Duration, feeds ...TickPairFeed) (*TickFeed, error) {
+	if interval <= 0 {
+		interval = TickInterval
+	}
+	tickFeed := &TickFeed{
+		history:  history,
+		feeds:    make(map[string]TickPairFeed),
+		interval: interval,
+		start:    make(map[string]time.Time),
+	}
+	for _, feed := range feeds {
+		reader, err := newTickMerger(feed.Files, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		tick, ok, err := reader.next()
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s ticks", ErrInsufficientData, feed.Pair)
+		}
+		tickFeed.feeds[feed.Pair] = feed
+		tickFeed.start[feed.Pair] = tick.Time
+	}
+	return tickFeed, nil
+}
+
+// TickFiles 查找目录下交易对的逐笔数据文件，文件名以 {pair}-aggTrades 或 {pair}-bookTicker 开头
+func TickFiles(dir, pair string) ([]string, error) {
+	files := make([]string, 0)
+	for _, kind := range []string{"aggTrades", "bookTicker"} {
+		for _, ext := range []string{".csv", ".zip", ".csv.gz"} {
+			matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s-%s*%s", pair, kind, ext)))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+	}
+	return files, nil
+}
+
+// Period 仅回放 [start, end) 范围内的逐笔数据，零值表示不限制，预热K线取 start 之前的数据
+func (t *TickFeed) Period(start, end time.Time) *TickFeed {
+	if !start.IsZero() {
+		for pair, first := range t.start {
+			if first.Before(start) {
+				t.start[pair] = start
+			}
+		}
+	}
+	t.end = end
+	return t
+}
+
+func (t *TickFeed) AssetsInfo(pair string) model.AssetInfo {
+	return t.history.AssetsInfo(pair)
+}
+
+func (t *TickFeed) AssetsInfos() map[string]model.AssetInfo {
+	return t.history.AssetsInfos()
+}
+
+func (t *TickFeed) LastQuote(ctx context.Context, pair string) (float64, error) {
+	return t.history.LastQuote(ctx, pair)
+}
+
+func (t *TickFeed) SetPairOption(ctx context.Context, option model.PairOption) error {
+	return t.history.SetPairOption(ctx, option)
+}
+
+func (t *TickFeed) CandlesByPeriod(ctx context.Context, pair, timeframe string, start, end time.Time) ([]model.Candle, error) {
+	return t.history.CandlesByPeriod(ctx, pair, timeframe, start, end)
+}
+
+// CandlesByLimit 返回回放起点所在周期之前的 limit 根收线K线用于预热
+func (t *TickFeed) CandlesByLimit(ctx context.Context, pair, timeframe string, limit int) ([]model.Candle, error) {
+	start, ok := t.start[pair]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+	}
+	period, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	start = start.Truncate(period)
+	candles, err := t.history.CandlesByPeriod(ctx, pair, timeframe, time.Time{}, start)
+	if err != nil {
+		return nil, err
+	}
+	limitCandles := make([]model.Candle, 0, limit)
+	for _, candle := range candles {
+		if candle.Complete && candle.Time.Before(start) {
+			limitCandles = append(limitCandles, candle)
+		}
+	}
+	if len(limitCandles) < limit {
+		return nil, fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+	}
+	return limitCandles[len(limitCandles)-limit:], nil
+}
+
+// stream 逐笔回放交易对数据，合成 timeframe 周期K线推送至 ccandle
+func (t *TickFeed) stream(ctx context.Context, pair, timeframe string, ccandle chan model.Candle, cerr chan error) {
+	feed, ok := t.feeds[pair]
+	if !ok {
+		return
+	}
+	period, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		cerr <- err
+		return
+	}
+	reader, err := newTickMerger(feed.Files, t.start[pair])
+	if err != nil {
+		cerr <- err
+		return
+	}
+	defer reader.Close()
+
+	builder := &tickCandle{pair: pair, period: period, interval: t.interval}
+	emit := func(candle model.Candle) bool {
+		select {
+		case ccandle <- candle:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		tick, ok, err := reader.next()
+		if err != nil {
+			cerr <- err
+			return
+		}
+		if !ok || (!t.end.IsZero() && !tick.Time.Before(t.end)) {
+			break
+		}
+		if tick.Time.Before(t.start[pair]) {
+			continue
+		}
+		if !builder.advance(tick.Time, emit) {
+			return
+		}
+		builder.update(tick)
+	}
+	// 推送最后一个时间片，未结束的周期不收线
+	builder.flush(emit)
+}
+
+func (t *TickFeed) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error, 1)
+	go func() {
+		defer close(ccandle)
+		defer close(cerr)
+		t.stream(ctx, pair, timeframe, ccandle, cerr)
+	}()
+	return ccandle, cerr
+}
+
+func (t *TickFeed) CandlesBatchSubscription(ctx context.Context, combineConfig map[string]string) (map[string]chan model.Candle, chan error) {
+	pairCcandle := make(map[string]chan model.Candle)
+	cerr := make(chan error, len(combineConfig))
+	done := make(chan struct{}, len(combineConfig))
+	for pair, timeframe := range combineConfig {
+		ccandle := make(chan model.Candle)
+		pairCcandle[fmt.Sprintf("%s--%s", pair, timeframe)] = ccandle
+		go func(pair, timeframe string, ccandle chan model.Candle) {
+			defer func() { done <- struct{}{} }()
+			defer close(ccandle)
+			t.stream(ctx, pair, timeframe, ccandle, cerr)
+		}(pair, timeframe, ccandle)
+	}
+	go func() {
+		for range pairCcandle {
+			<-done
+		}
+		close(cerr)
+	}()
+	return pairCcandle, cerr
+}
+
+// tickCandle 由逐笔数据合成单个周期的K线
+type tickCandle struct {
+	pair     string
+	period   time.Duration
+	interval time.Duration
+	candle   model.Candle
+	// 当前周期尚无成交，开盘价沿用上一周期收盘价
+	empty bool
+	// 未推送更新所在时间片的结束时间，零值表示没有未推送的更新
+	pending time.Time
+}
+
+// advance 推进到 t，推送 t 之前结束的时间片及周期，无数据的周期以上一周期收盘价补齐
+func (b *tickCandle) advance(t time.Time, emit func(model.Candle) bool) bool {
+	if b.candle.Time.IsZero() {
+		return true
+	}
+	for {
+		end := b.candle.Time.Add(b.period)
+		if !b.pending.IsZero() && b.pending.Before(end) && !t.Before(b.pending) {
+			if !emit(b.snapshot(b.pending, false)) {
+				return false
+			}
+			b.pending = time.Time{}
+		}
+		if t.Before(end) {
+			return true
+		}
+		// 周期最后一个时间片以收线K线推送
+		if !emit(b.snapshot(end, true)) {
+			return false
+		}
+		last := b.candle.Close
+		b.candle = model.Candle{Pair: b.pair, Time: end, Open: last, High: last, Low: last, Close: last}
+		b.empty = true
+		b.pending = time.Time{}
+	}
+}
+
+// update 计入一笔数据，须先调用 advance
+func (b *tickCandle) update(tick Tick) {
+	if b.candle.Time.IsZero() {
+		b.candle = model.Candle{Pair: b.pair, Time: tick.Time.Truncate(b.period)}
+		b.empty = true
+	}
+	if b.empty {
+		b.candle.Open, b.candle.High, b.candle.Low = tick.Price, tick.Price, tick.Price
+		b.empty = false
+	}
+	b.candle.High = max(b.candle.High, tick.Price)
+	b.candle.Low = min(b.candle.Low, tick.Price)
+	b.candle.Close = tick.Price
+	b.candle.Volume += tick.Quantity
+	if b.pending.IsZero() {
+		b.pending = tick.Time.Truncate(b.interval).Add(b.interval)
+	}
+}
+
+// flush 推送未推送的更新
+func (b *tickCandle) flush(emit func(model.Candle) bool) {
+	if b.pending.IsZero() {
+		return
+	}
+	end := b.candle.Time.Add(b.period)
+	if b.pending.Before(end) {
+		emit(b.snapshot(b.pending, false))
+		return
+	}
+	emit(b.snapshot(end, true))
+}
+
+func (b *tickCandle) snapshot(updatedAt time.Time, complete bool) model.Candle {
+	candle := b.candle
+	candle.UpdatedAt = updatedAt
+	candle.Complete = complete
+	candle.Metadata = make(map[string]float64)
+	return candle
+}
+
+// tickReader 顺序读取单个逐笔数据文件
+type tickReader struct {
+	closers  []io.Closer
+	reader   *csv.Reader
+	book     bool
+	head     Tick
+	hasHead  bool
+	finished bool
+}
+
+// newTickReader 打开逐笔数据文件，录制的 gzip 文件按索引定位到 start 附近开始读取
+func newTickReader(file string, start time.Time) (*tickReader, error) {
+	reader := &tickReader{book: strings.Contains(filepath.Base(file), "bookTicker")}
+	var content io.ReadCloser
+	switch {
+	case strings.EqualFold(filepath.Ext(file), ".gz"):
+		record, err := OpenRecord(file, start)
+		if err != nil {
+			return nil, err
+		}
+		content = record
+	case strings.EqualFold(filepath.Ext(file), ".zip"):
+		archive, err := zip.OpenReader(file)
+		if err != nil {
+			return nil, err
+		}
+		reader.closers = append(reader.closers, archive)
+		for _, item := range archive.File {
+			if !strings.EqualFold(filepath.Ext(item.Name), ".csv") {
+				continue
+			}
+			if content, err = item.Open(); err != nil {
+				reader.Close()
+				return nil, err
+			}
+			break
+		}
+		if content == nil {
+			reader.Close()
+			return nil, fmt.Errorf("%s: csv not found", file)
+		}
+	default:
+		csvFile, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		content = csvFile
+	}
+	reader.closers = append(reader.closers, content)
+	reader.reader = csv.NewReader(content)
+	reader.reader.FieldsPerRecord = -1
+	reader.reader.ReuseRecord = true
+	return reader, nil
+}
+
+func (r *tickReader) Close() error {
+	var errs []error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		errs = append(errs, r.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// peek 返回下一条数据但不消费
+// aggTrades 列依次为 agg_trade_id, price, quantity, first_trade_id, last_trade_id, transact_time, is_buyer_maker
+// bookTicker 列依次为 update_id, best_bid_price, best_bid_qty, best_ask_price, best_ask_qty, transaction_time, ...
+// 时间为毫秒，2025年起现货数据为微秒
+func (r *tickReader) peek() (Tick, bool, error) {
+	for !r.hasHead && !r.finished {
+		line, err := r.reader.Read()
+		if err == io.EOF {
+			r.finished = true
+			break
+		}
+		if err != nil {
+			return Tick{}, false, err
+		}
+		if len(line) < 6 {
+			continue
+		}
+		timestamp, err := strconv.ParseInt(line[5], 10, 64)
+		if err != nil {
+			// 表头
+			continue
+		}
+		tick := Tick{Time: time.UnixMilli(timestamp).UTC()}
+		if timestamp > 1e14 {
+			tick.Time = time.UnixMicro(timestamp).UTC()
+		}
+		if r.book {
+			bid, err := strconv.ParseFloat(line[1], 64)
+			if err != nil {
+				return Tick{}, false, err
+			}
+			ask, err := strconv.ParseFloat(line[3], 64)
+			if err != nil {
+				return Tick{}, false, err
+			}
+			tick.Price = (bid + ask) / 2
+		} else {
+			if tick.Price, err = strconv.ParseFloat(line[1], 64); err != nil {
+				return Tick{}, false, err
+			}
+			if tick.Quantity, err = strconv.ParseFloat(line[2], 64); err != nil {
+				return Tick{}, false, err
+			}
+		}
+		r.head, r.hasHead = tick, true
+	}
+	return r.head, r.hasHead, nil
+}
+
+// tickMerger 按时间合并多个逐笔数据文件，时间相同时按文件顺序
+type tickMerger struct {
+	readers []*tickReader
+}
+
+func newTickMerger(files []string, start time.Time) (*tickMerger, error) {
+	merger := &tickMerger{}
+	for _, file := range files {
+		reader, err := newTickReader(file, start)
+		if err != nil {
+			merger.Close()
+			return nil, err
+		}
+		merger.readers = append(merger.readers, reader)
+	}
+	return merger, nil
+}
+
+func (m *tickMerger) Close() error {
+	var errs []error
+	for _, reader := range m.readers {
+		errs = append(errs, reader.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (m *tickMerger) next() (Tick, bool, error) {
+	var (
+		selected *tickReader
+		head     Tick
+	)
+	for _, reader := range m.readers {
+		tick, ok, err := reader.peek()
+		if err != nil {
+			return Tick{}, false, err
+		}
+		if ok && (selected == nil || tick.Time.Before(head.Time)) {
+			selected, head = reader, tick
+		}
+	}
+	if selected == nil {
+		return Tick{}, false, nil
+	}
+	selected.hasHead = false
+	return head, true, nil
+}
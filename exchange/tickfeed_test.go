@@ -0,0 +1,76 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTickFeed_PartialCandles(t *testing.T) {
+	// aggTrades: agg_trade_id, price, quantity, first_trade_id, last_trade_id, transact_time, is_buyer_maker
+	trades := []struct {
+		offset   time.Duration
+		price    float64
+		quantity float64
+	}{
+		{100 * time.Millisecond, 100, 1},
+		{200 * time.Millisecond, 101, 2},
+		{600 * time.Millisecond, 99, 1},
+		{61 * time.Second, 102, 1},
+		// 第3分钟没有成交
+		{185 * time.Second, 103, 1},
+	}
+	lines := []string{"agg_trade_id,price,quantity,first_trade_id,last_trade_id,transact_time,is_buyer_maker"}
+	for i, trade := range trades {
+		lines = append(lines, fmt.Sprintf("%d,%v,%v,%d,%d,%d,false",
+			i, trade.price, trade.quantity, i, i, paperStart.Add(trade.offset).UnixMilli()))
+	}
+	file := filepath.Join(t.TempDir(), "BTCUSDT-aggTrades-2024-01-01.csv")
+	require.NoError(t, os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+
+	feed, err := NewTickFeed(nil, 250*time.Millisecond, TickPairFeed{Pair: "BTCUSDT", Files: []string{file}})
+	require.NoError(t, err)
+	ccandle, cerr := feed.CandlesSubscription(context.Background(), "BTCUSDT", "1m")
+
+	type expected struct {
+		time                   time.Duration
+		updatedAt              time.Duration
+		open, high, low, close float64
+		volume                 float64
+		complete               bool
+	}
+	want := []expected{
+		// 每个推送间隔内有更新时推送一次未收线K线
+		{0, 250 * time.Millisecond, 100, 101, 100, 101, 3, false},
+		{0, 750 * time.Millisecond, 100, 101, 99, 99, 4, false},
+		{0, time.Minute, 100, 101, 99, 99, 4, true},
+		{time.Minute, 61250 * time.Millisecond, 102, 102, 102, 102, 1, false},
+		{time.Minute, 2 * time.Minute, 102, 102, 102, 102, 1, true},
+		// 无成交的周期以上一周期收盘价补齐
+		{2 * time.Minute, 3 * time.Minute, 102, 102, 102, 102, 0, true},
+		// 数据结束时未结束的周期不收线
+		{3 * time.Minute, 185250 * time.Millisecond, 103, 103, 103, 103, 1, false},
+	}
+	var got []expected
+	for candle := range ccandle {
+		require.Equal(t, "BTCUSDT", candle.Pair)
+		got = append(got, expected{
+			time:      candle.Time.Sub(paperStart),
+			updatedAt: candle.UpdatedAt.Sub(paperStart),
+			open:      candle.Open,
+			high:      candle.High,
+			low:       candle.Low,
+			close:     candle.Close,
+			volume:    candle.Volume,
+			complete:  candle.Complete,
+		})
+	}
+	require.NoError(t, <-cerr)
+	require.Equal(t, want, got)
+}
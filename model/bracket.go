@@ -0,0 +1,11 @@
+package model
+
+// LeverageBracket 杠杆分层及维持保证金率，与币安 /fapi/v1/leverageBracket 返回结构一致
+type LeverageBracket struct {
+	Bracket          int     `json:"bracket"`
+	InitialLeverage  int     `json:"initialLeverage"`
+	NotionalCap      float64 `json:"notionalCap"`
+	NotionalFloor    float64 `json:"notionalFloor"`
+	MaintMarginRatio float64 `json:"maintMarginRatio"`
+	Cum              float64 `json:"cum"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// FundingRate 资金费率，Time 为结算时间
+type FundingRate struct {
+	Time time.Time
+	Rate float64
+}
+
+// FundingPayment 一次资金费结算记录，Value 为正表示收取，为负表示支付
+type FundingPayment struct {
+	Pair     string
+	Time     time.Time
+	Rate     float64
+	Price    float64
+	Quantity float64
+	Value    float64
+}
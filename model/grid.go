@@ -35,3 +35,13 @@ func (pg *PositionGrid) SortGridItemsByPrice(asc bool) {
 		}
 	})
 }
+
+// GridStats 网格运行统计
+type GridStats struct {
+	// 各网格成交次数，负数为多单网格，正数为空单网格，绝对值为距基准线的格数
+	Fills map[int]int
+	// 已有网格被重新生成的次数
+	Rebuilds int
+	// 价格处于网格布林带边界外的累计时长
+	Outside time.Duration
+}
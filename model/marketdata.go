@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// MarketData 合约市场数据，Time 为数据时间，Values 为各数据列的取值
+type MarketData struct {
+	Time   time.Time
+	Values map[string]float64
+}
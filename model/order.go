@@ -25,6 +25,7 @@ var (
 	OrderTypeStopLossLimit   OrderType        = "STOP_LOSS_LIMIT"
 	OrderTypeTakeProfit      OrderType        = "TAKE_PROFIT"
 	OrderTypeTakeProfitLimit OrderType        = "TAKE_PROFIT_LIMIT"
+	OrderTypeLiquidation     OrderType        = "LIQUIDATION"
 
 	OrderStatusTypeNew             OrderStatusType = "NEW"
 	OrderStatusTypePartiallyFilled OrderStatusType = "PARTIALLY_FILLED"
@@ -68,6 +69,7 @@ type Order struct {
 	GuiderPositionRate float64          `db:"guider_position_rate" json:"guider_position_rate"`
 	GuiderOrigin       string           `db:"guider_origin" json:"guider_origin"`
 	ChaseMode          int              `db:"chase_mode" json:"chase_mode"`
+	Fee                float64          `db:"fee" json:"fee"`
 	CreatedAt          time.Time        `db:"created_at" json:"created_at"`
 	UpdatedAt          time.Time        `db:"updated_at" json:"updated_at"`
 
@@ -61,9 +61,13 @@ type Position struct {
 	GuiderPositionRate   float64        `db:"guider_position_rate" json:"guider_position_rate"`
 	GuiderOrigin         string         `db:"guider_origin" json:"guider_origin"`
 	Status               int            `db:"status" json:"status"`
+	Fee                  float64        `db:"fee" json:"fee"`
 	CreatedAt            time.Time      `db:"created_at" json:"created_at"`
 	UpdatedAt            time.Time      `db:"updated_at" json:"updated_at"`
 	MatcherStrategyCount map[string]int `json:"-" gorm:"-"`
+	// 持仓期间最高/最低价，仅模拟钱包记录，用于 MAE/MFE 统计
+	HighPrice float64 `json:"high_price" gorm:"-"`
+	LowPrice  float64 `json:"low_price" gorm:"-"`
 }
 
 func (p Position) String() string {
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// 用户数据流事件类型
+const (
+	UserDataOrderUpdate   = "ORDER_TRADE_UPDATE"
+	UserDataAccountUpdate = "ACCOUNT_UPDATE"
+	UserDataMarginCall    = "MARGIN_CALL"
+	// 数据流连接建立及断开，断开期间由轮询兜底
+	UserDataConnected    = "CONNECTED"
+	UserDataDisconnected = "DISCONNECTED"
+)
+
+// UserDataEvent 交易所推送的账户事件
+// 订单更新时 Order 为最新订单状态，账户更新时 Positions 为发生变化的仓位 (数量为0表示已平仓)，追加保证金通知时为风险仓位
+type UserDataEvent struct {
+	Type      string
+	Time      time.Time
+	Order     Order
+	Positions []Position
+}
@@ -0,0 +1,77 @@
+package optimize
+
+import (
+	"fmt"
+	"time"
+)
+
+// EquityPoint 权益曲线上的一个点
+type EquityPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Result 单次回测结果，对应 cmd/backtesting 输出的 backtest.resultPath 文件
+type Result struct {
+	Trades       int           `json:"trades"`
+	Win          int           `json:"win"`
+	Loss         int           `json:"loss"`
+	Profit       float64       `json:"profit"`
+	ProfitFactor float64       `json:"profitFactor"`
+	SQN          float64       `json:"sqn"`
+	Funding      float64       `json:"funding"`
+	Liquidations int           `json:"liquidations"`
+	Volume       float64       `json:"volume"`
+	InitialValue float64       `json:"initialValue"`
+	FinalValue   float64       `json:"finalValue"`
+	Return       float64       `json:"return"`
+	MaxDrawdown  float64       `json:"maxDrawdown"`
+	Sharpe       float64       `json:"sharpe"`
+	Sortino      float64       `json:"sortino"`
+	Calmar       float64       `json:"calmar"`
+	Ulcer        float64       `json:"ulcer"`
+	Equity       []EquityPoint `json:"equity,omitempty"`
+}
+
+// Objective 优化目标，分值越大越好
+type Objective func(Result) float64
+
+// Objectives 可选优化目标
+var Objectives = map[string]Objective{
+	// 净利润
+	"profit": func(result Result) float64 {
+		return result.Profit
+	},
+	// 盈亏因子
+	"pf": func(result Result) float64 {
+		return result.ProfitFactor
+	},
+	// 系统质量数
+	"sqn": func(result Result) float64 {
+		return result.SQN
+	},
+	// 年化夏普比率
+	"sharpe": func(result Result) float64 {
+		return result.Sharpe
+	},
+	// 年化索提诺比率
+	"sortino": func(result Result) float64 {
+		return result.Sortino
+	},
+	// 回撤调整收益: 收益率 / 最大回撤
+	"calmar": func(result Result) float64 {
+		if result.MaxDrawdown == 0 {
+			return result.Return
+		}
+		return result.Return / result.MaxDrawdown
+	},
+}
+
+// GetObjective 按名称获取优化目标
+func GetObjective(name string) (Objective, error) {
+	objective, ok := Objectives[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown objective: %s", name)
+	}
+	return objective, nil
+}
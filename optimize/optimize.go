@@ -0,0 +1,404 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+const (
+	MethodGrid    = "grid"
+	MethodRandom  = "random"
+	MethodGenetic = "genetic"
+)
+
+// Trial 一组参数的回测记录
+type Trial struct {
+	ID     int               `json:"id"`
+	Params map[string]string `json:"params"`
+	Score  float64           `json:"score"`
+	Result Result            `json:"result"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type Settings struct {
+	Method      string
+	Objective   string
+	Parallel    int
+	Samples     int
+	Population  int
+	Generations int
+	Mutation    float64
+	Seed        int64
+}
+
+type Option func(*Settings)
+
+// WithMethod 搜索方式 grid | random | genetic
+func WithMethod(method string) Option {
+	return func(settings *Settings) {
+		settings.Method = method
+	}
+}
+
+// WithObjective 优化目标 profit | pf | sqn | calmar | sharpe | sortino
+func WithObjective(objective string) Option {
+	return func(settings *Settings) {
+		settings.Objective = objective
+	}
+}
+
+// WithParallel 并行回测数量
+func WithParallel(parallel int) Option {
+	return func(settings *Settings) {
+		settings.Parallel = parallel
+	}
+}
+
+// WithSamples 随机搜索的采样次数
+func WithSamples(samples int) Option {
+	return func(settings *Settings) {
+		settings.Samples = samples
+	}
+}
+
+// WithGenetic 遗传搜索的种群大小、迭代代数及变异概率
+func WithGenetic(population, generations int, mutation float64) Option {
+	return func(settings *Settings) {
+		settings.Population = population
+		settings.Generations = generations
+		settings.Mutation = mutation
+	}
+}
+
+// WithSeed 随机种子，固定种子保证搜索过程可复现
+func WithSeed(seed int64) Option {
+	return func(settings *Settings) {
+		settings.Seed = seed
+	}
+}
+
+type Optimizer struct {
+	mtx       sync.Mutex
+	runner    Runner
+	space     Space
+	settings  Settings
+	objective Objective
+	random    *rand.Rand
+	trials    map[string]*Trial
+	counter   int
+	bar       *progressbar.ProgressBar
+}
+
+func NewOptimizer(runner Runner, space Space, options ...Option) (*Optimizer, error) {
+	settings := Settings{
+		Method:      MethodGrid,
+		Objective:   "profit",
+		Parallel:    1,
+		Samples:     50,
+		Population:  20,
+		Generations: 10,
+		Mutation:    0.1,
+		Seed:        1,
+	}
+	for _, option := range options {
+		option(&settings)
+	}
+	if settings.Parallel < 1 {
+		settings.Parallel = 1
+	}
+
+	objective, err := GetObjective(settings.Objective)
+	if err != nil {
+		return nil, err
+	}
+	return &Optimizer{
+		runner:    runner,
+		space:     space,
+		settings:  settings,
+		objective: objective,
+		random:    rand.New(rand.NewSource(settings.Seed)),
+		trials:    make(map[string]*Trial),
+	}, nil
+}
+
+// Run 执行搜索，返回按目标分值降序排列的排行榜，失败的回测排在最后
+func (o *Optimizer) Run(ctx context.Context) ([]Trial, error) {
+	switch o.settings.Method {
+	case MethodGrid:
+		o.bar = progressbar.Default(int64(o.space.Size()))
+		o.evaluate(ctx, o.grid())
+	case MethodRandom:
+		o.bar = progressbar.Default(int64(o.settings.Samples))
+		o.evaluate(ctx, o.sample(o.settings.Samples))
+	case MethodGenetic:
+		o.bar = progressbar.Default(int64(o.settings.Population * o.settings.Generations))
+		o.genetic(ctx)
+	default:
+		return nil, fmt.Errorf("unknown search method: %s", o.settings.Method)
+	}
+	_ = o.bar.Finish()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return o.Leaderboard(), nil
+}
+
+// Leaderboard 已完成回测的排行榜
+func (o *Optimizer) Leaderboard() []Trial {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	trials := make([]Trial, 0, len(o.trials))
+	for _, trial := range o.trials {
+		trials = append(trials, *trial)
+	}
+	sort.Slice(trials, func(i, j int) bool {
+		if (trials[i].Error == "") != (trials[j].Error == "") {
+			return trials[i].Error == ""
+		}
+		if trials[i].Score != trials[j].Score {
+			return trials[i].Score > trials[j].Score
+		}
+		return trials[i].ID < trials[j].ID
+	})
+	return trials
+}
+
+// genome 参数组合，每个元素为对应参数候选值的下标
+type genome []int
+
+func (o *Optimizer) params(g genome) map[string]string {
+	params := make(map[string]string, len(o.space))
+	for i, parameter := range o.space {
+		params[parameter.Key] = parameter.Candidates()[g[i]]
+	}
+	return params
+}
+
+func (o *Optimizer) key(g genome) string {
+	parts := make([]string, len(g))
+	for i, index := range g {
+		parts[i] = strconv.Itoa(index)
+	}
+	return strings.Join(parts, ",")
+}
+
+// grid 枚举全部参数组合
+func (o *Optimizer) grid() []genome {
+	genomes := make([]genome, 0, o.space.Size())
+	current := make(genome, len(o.space))
+	for {
+		genomes = append(genomes, append(genome{}, current...))
+		i := len(current) - 1
+		for ; i >= 0; i-- {
+			current[i]++
+			if current[i] < len(o.space[i].Candidates()) {
+				break
+			}
+			current[i] = 0
+		}
+		if i < 0 {
+			return genomes
+		}
+	}
+}
+
+// sample 随机采样参数组合
+func (o *Optimizer) sample(count int) []genome {
+	genomes := make([]genome, 0, count)
+	for i := 0; i < count; i++ {
+		g := make(genome, len(o.space))
+		for j, parameter := range o.space {
+			g[j] = o.random.Intn(len(parameter.Candidates()))
+		}
+		genomes = append(genomes, g)
+	}
+	return genomes
+}
+
+// evaluate 并行回测参数组合，已回测过的组合直接复用结果
+func (o *Optimizer) evaluate(ctx context.Context, genomes []genome) []*Trial {
+	var (
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, o.settings.Parallel)
+		trials = make([]*Trial, len(genomes))
+	)
+	for i, g := range genomes {
+		key := o.key(g)
+		o.mtx.Lock()
+		trial, ok := o.trials[key]
+		if !ok {
+			o.counter++
+			trial = &Trial{ID: o.counter, Params: o.params(g)}
+			o.trials[key] = trial
+		}
+		o.mtx.Unlock()
+		trials[i] = trial
+		if ok {
+			_ = o.bar.Add(1)
+			continue
+		}
+
+		wg.Add(1)
+		go func(trial *Trial) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := o.runner.Run(ctx, trial.ID, trial.Params)
+			o.mtx.Lock()
+			if err != nil {
+				trial.Error = err.Error()
+			} else {
+				trial.Result = result
+				trial.Score = o.objective(result)
+			}
+			o.mtx.Unlock()
+			_ = o.bar.Add(1)
+		}(trial)
+	}
+	wg.Wait()
+	return trials
+}
+
+// fitness 适应度，失败的回测视为最差
+func (o *Optimizer) fitness(trial *Trial) (float64, bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return trial.Score, trial.Error == ""
+}
+
+// better 比较两个回测结果
+func (o *Optimizer) better(a, b *Trial) bool {
+	scoreA, okA := o.fitness(a)
+	scoreB, okB := o.fitness(b)
+	if okA != okB {
+		return okA
+	}
+	return scoreA > scoreB
+}
+
+// genetic 遗传搜索: 精英保留 + 锦标赛选择 + 均匀交叉 + 随机变异
+func (o *Optimizer) genetic(ctx context.Context) {
+	population := o.sample(o.settings.Population)
+	for generation := 0; generation < o.settings.Generations; generation++ {
+		if ctx.Err() != nil {
+			return
+		}
+		trials := o.evaluate(ctx, population)
+		indexes := make([]int, len(population))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return o.better(trials[indexes[i]], trials[indexes[j]])
+		})
+
+		// 保留最优的两个个体
+		next := make([]genome, 0, len(population))
+		for i := 0; i < 2 && i < len(indexes); i++ {
+			next = append(next, population[indexes[i]])
+		}
+		for len(next) < len(population) {
+			father := population[o.tournament(trials)]
+			mother := population[o.tournament(trials)]
+			child := make(genome, len(o.space))
+			for i := range child {
+				if o.random.Intn(2) == 0 {
+					child[i] = father[i]
+				} else {
+					child[i] = mother[i]
+				}
+				if o.random.Float64() < o.settings.Mutation {
+					child[i] = o.random.Intn(len(o.space[i].Candidates()))
+				}
+			}
+			next = append(next, child)
+		}
+		population = next
+	}
+}
+
+// tournament 随机抽取三个个体，返回最优个体的下标
+func (o *Optimizer) tournament(trials []*Trial) int {
+	best := o.random.Intn(len(trials))
+	for i := 0; i < 2; i++ {
+		candidate := o.random.Intn(len(trials))
+		if o.better(trials[candidate], trials[best]) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// SaveLeaderboard 保存排行榜，按文件扩展名输出 JSON 或 CSV
+func (o *Optimizer) SaveLeaderboard(output string, trials []Trial) error {
+	if err := os.MkdirAll(filepath.Dir(output), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(output), ".json") {
+		// 排行榜不输出权益曲线
+		leaderboard := make([]Trial, len(trials))
+		for i, trial := range trials {
+			leaderboard[i] = trial
+			leaderboard[i].Result.Equity = nil
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(leaderboard)
+	}
+
+	writer := csv.NewWriter(file)
+	header := []string{"rank", "trial"}
+	for _, parameter := range o.space {
+		header = append(header, parameter.Key)
+	}
+	header = append(header, "score", "trades", "win", "loss", "profit", "profitFactor", "sqn",
+		"return", "maxDrawdown", "funding", "liquidations", "error")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i, trial := range trials {
+		record := []string{strconv.Itoa(i + 1), strconv.Itoa(trial.ID)}
+		for _, parameter := range o.space {
+			record = append(record, trial.Params[parameter.Key])
+		}
+		record = append(record,
+			strconv.FormatFloat(trial.Score, 'f', 4, 64),
+			strconv.Itoa(trial.Result.Trades),
+			strconv.Itoa(trial.Result.Win),
+			strconv.Itoa(trial.Result.Loss),
+			strconv.FormatFloat(trial.Result.Profit, 'f', 4, 64),
+			strconv.FormatFloat(trial.Result.ProfitFactor, 'f', 4, 64),
+			strconv.FormatFloat(trial.Result.SQN, 'f', 4, 64),
+			strconv.FormatFloat(trial.Result.Return, 'f', 4, 64),
+			strconv.FormatFloat(trial.Result.MaxDrawdown, 'f', 4, 64),
+			strconv.FormatFloat(trial.Result.Funding, 'f', 4, 64),
+			strconv.Itoa(trial.Result.Liquidations),
+			trial.Error,
+		)
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,71 @@
+package optimize
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type funcRunner func(params map[string]string) Result
+
+func (f funcRunner) Run(_ context.Context, _ int, params map[string]string) (Result, error) {
+	return f(params), nil
+}
+
+// 利润在 a=0.3, b=20 时最大
+func parabola(params map[string]string) Result {
+	a, _ := strconv.ParseFloat(params["a"], 64)
+	b, _ := strconv.ParseFloat(params["b"], 64)
+	return Result{Profit: -(a-0.3)*(a-0.3)*100 - (b-20)*(b-20)/100}
+}
+
+func TestParameter_Candidates(t *testing.T) {
+	parameter := Parameter{Key: "a", Min: 0.1, Max: 0.5, Step: 0.1}
+	require.Equal(t, []string{"0.1", "0.2", "0.3", "0.4", "0.5"}, parameter.Candidates())
+
+	parameter = Parameter{Key: "b", Values: []string{"10", "20"}}
+	require.Equal(t, []string{"10", "20"}, parameter.Candidates())
+}
+
+func TestSpace_Shadowed(t *testing.T) {
+	space := Space{
+		{Key: "caller.leverage", Values: []string{"10", "20"}},
+		{Key: "caller.marginType", Values: []string{"CROSSED"}},
+		{Key: "caller.profitableTrigger", Values: []string{"0.1"}},
+		{Key: "pairs.BTCUSDT.marginSize", Values: []string{"0.01"}},
+	}
+	pairs := map[string]interface{}{
+		"btcusdt": map[string]interface{}{"status": true, "leverage": 100.0, "margintype": "CROSSED", "marginsize": 0.05},
+	}
+	require.Equal(t, []string{
+		"caller.leverage (pairs.BTCUSDT.leverage)",
+		"caller.marginType (pairs.BTCUSDT.marginType)",
+	}, space.Shadowed(pairs))
+}
+
+func TestOptimizer_Run(t *testing.T) {
+	space := Space{
+		{Key: "a", Min: 0.1, Max: 0.5, Step: 0.1},
+		{Key: "b", Values: []string{"10", "20", "30"}},
+	}
+
+	t.Run("grid", func(t *testing.T) {
+		optimizer, err := NewOptimizer(funcRunner(parabola), space, WithParallel(4))
+		require.NoError(t, err)
+		trials, err := optimizer.Run(context.Background())
+		require.NoError(t, err)
+		require.Len(t, trials, 15)
+		require.Equal(t, map[string]string{"a": "0.3", "b": "20"}, trials[0].Params)
+	})
+
+	t.Run("genetic", func(t *testing.T) {
+		optimizer, err := NewOptimizer(funcRunner(parabola), space,
+			WithMethod(MethodGenetic), WithGenetic(6, 10, 0.3), WithParallel(2))
+		require.NoError(t, err)
+		trials, err := optimizer.Run(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"a": "0.3", "b": "20"}, trials[0].Params)
+	})
+}
@@ -0,0 +1,76 @@
+package optimize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Runner 执行一次回测
+type Runner interface {
+	Run(ctx context.Context, id int, params map[string]string) (Result, error)
+}
+
+// CommandRunner 以子进程方式运行回测程序，参数通过环境变量覆盖配置
+// 回测依赖全局单例，无法在同一进程内并行，因此每次回测独立进程、独立数据库
+type CommandRunner struct {
+	// Command 回测命令，如 ["./backtesting"] 或 ["go", "run", "./cmd/backtesting"]
+	Command []string
+	// WorkDir 回测进程工作目录，需包含 configs 及 testdata
+	WorkDir string
+	// Output 每次回测的数据库、日志及结果文件所在目录
+	Output string
+}
+
+func (r CommandRunner) Run(ctx context.Context, id int, params map[string]string) (Result, error) {
+	if len(r.Command) == 0 {
+		return Result{}, fmt.Errorf("backtest command is empty")
+	}
+
+	dir, err := filepath.Abs(filepath.Join(r.Output, fmt.Sprintf("trial-%d", id)))
+	if err != nil {
+		return Result{}, err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return Result{}, err
+	}
+	resultPath := filepath.Join(dir, "result.json")
+
+	logFile, err := os.Create(filepath.Join(dir, "output.log"))
+	if err != nil {
+		return Result{}, err
+	}
+	defer logFile.Close()
+
+	cmd := exec.CommandContext(ctx, r.Command[0], r.Command[1:]...)
+	cmd.Dir = r.WorkDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Env = append(
+		os.Environ(),
+		EnvKey("storage.path")+"="+filepath.Join(dir, "backtest.db"),
+		EnvKey("backtest.resultPath")+"="+resultPath,
+		// 参数搜索关闭蒙特卡洛模拟，HTML 报告写入各自目录
+		EnvKey("backtest.monteCarlo.simulations")+"=0",
+		EnvKey("backtest.report")+"="+filepath.Join(dir, "report.html"),
+	)
+	for key, value := range params {
+		cmd.Env = append(cmd.Env, EnvKey(key)+"="+value)
+	}
+	if err := cmd.Run(); err != nil {
+		return Result{}, fmt.Errorf("trial %d: %w, see %s", id, err, logFile.Name())
+	}
+
+	content, err := os.ReadFile(resultPath)
+	if err != nil {
+		return Result{}, err
+	}
+	var result Result
+	if err := json.Unmarshal(content, &result); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package optimize
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Parameter 待优化参数，Key 为配置项 (如 caller.profitableTrigger)
+// 使用 Values 列举取值，或使用 Min/Max/Step 定义区间
+type Parameter struct {
+	Key    string
+	Values []string
+	Min    float64
+	Max    float64
+	Step   float64
+}
+
+// Candidates 参数的全部候选值
+func (p Parameter) Candidates() []string {
+	if len(p.Values) > 0 {
+		return p.Values
+	}
+	count := int(math.Floor((p.Max-p.Min)/p.Step+1e-9)) + 1
+	candidates := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		// 消除浮点累加误差
+		value := math.Round((p.Min+float64(i)*p.Step)*1e10) / 1e10
+		candidates = append(candidates, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return candidates
+}
+
+func (p Parameter) validate() error {
+	if p.Key == "" {
+		return errors.New("parameter key is required")
+	}
+	if len(p.Values) > 0 {
+		return nil
+	}
+	if p.Step <= 0 {
+		return fmt.Errorf("parameter %s: step must be greater than 0", p.Key)
+	}
+	if p.Max < p.Min {
+		return fmt.Errorf("parameter %s: max must not be less than min", p.Key)
+	}
+	return nil
+}
+
+// Space 参数空间
+type Space []Parameter
+
+// Size 网格搜索的组合总数
+func (s Space) Size() int {
+	size := 1
+	for _, parameter := range s {
+		size *= len(parameter.Candidates())
+	}
+	return size
+}
+
+// LoadSpace 读取参数空间文件 (yaml/json)，格式:
+//
+//	parameters:
+//	  - key: caller.profitableTrigger
+//	    min: 0.1
+//	    max: 0.5
+//	    step: 0.1
+//	  - key: pairs.BTCUSDT.leverage
+//	    values: [10, 20, 30]
+//
+// 非选币模式回测时 configs/pair.yaml 中交易对的配置优先于 caller.* 默认值，
+// 交易对已配置的项 (如 leverage、marginSize) 须以 pairs.{PAIR}.{key} 调整，见 Space.Shadowed
+func LoadSpace(file string) (Space, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	var space Space
+	if err := v.UnmarshalKey("parameters", &space); err != nil {
+		return nil, err
+	}
+	if len(space) == 0 {
+		return nil, errors.New("parameter space is empty")
+	}
+	for _, parameter := range space {
+		if err := parameter.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return space, nil
+}
+
+// Shadowed 返回被交易对配置覆盖而不会生效的 caller.* 参数，pairs 结构同 viper.GetStringMap("pairs")
+func (s Space) Shadowed(pairs map[string]interface{}) []string {
+	var shadowed []string
+	for _, parameter := range s {
+		name, ok := strings.CutPrefix(parameter.Key, "caller.")
+		if !ok {
+			continue
+		}
+		for pair, setting := range pairs {
+			values, ok := setting.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := values[strings.ToLower(name)]; ok {
+				shadowed = append(shadowed, fmt.Sprintf("%s (pairs.%s.%s)", parameter.Key, strings.ToUpper(pair), name))
+			}
+		}
+	}
+	return shadowed
+}
+
+// EnvKey 配置项对应的环境变量名，与 utils/config 中的 viper 环境变量规则一致
+func EnvKey(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
@@ -0,0 +1,267 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Window 一个滚动窗口，先在样本内区间优化参数，再在紧随其后的样本外区间验证
+type Window struct {
+	InSampleStart  time.Time `json:"inSampleStart"`
+	InSampleEnd    time.Time `json:"inSampleEnd"`
+	OutSampleStart time.Time `json:"outSampleStart"`
+	OutSampleEnd   time.Time `json:"outSampleEnd"`
+}
+
+// Windows 按样本内/样本外时长切分 [start, end)，窗口每次向前滚动一个样本外时长
+// anchored 为 true 时样本内区间始终从 start 开始
+func Windows(start, end time.Time, inSample, outSample time.Duration, anchored bool) []Window {
+	windows := make([]Window, 0)
+	if inSample <= 0 || outSample <= 0 {
+		return windows
+	}
+	for offset := time.Duration(0); ; offset += outSample {
+		window := Window{
+			InSampleStart:  start.Add(offset),
+			InSampleEnd:    start.Add(offset + inSample),
+			OutSampleStart: start.Add(offset + inSample),
+			OutSampleEnd:   start.Add(offset + inSample + outSample),
+		}
+		if anchored {
+			window.InSampleStart = start
+		}
+		if window.OutSampleEnd.After(end) {
+			return windows
+		}
+		windows = append(windows, window)
+	}
+}
+
+// periodRunner 将回测限制在指定时间范围内
+type periodRunner struct {
+	runner Runner
+	start  time.Time
+	end    time.Time
+}
+
+func (r periodRunner) Run(ctx context.Context, id int, params map[string]string) (Result, error) {
+	periodParams := make(map[string]string, len(params)+2)
+	for key, value := range params {
+		periodParams[key] = value
+	}
+	periodParams["backtest.start"] = r.start.Format(time.RFC3339)
+	periodParams["backtest.end"] = r.end.Format(time.RFC3339)
+	return r.runner.Run(ctx, id, periodParams)
+}
+
+// efficiency 样本外与样本内按时长折算后的收益率之比
+func efficiency(inSample, outSample Result, inSampleDuration, outSampleDuration time.Duration) float64 {
+	inSampleRate := inSample.Return / inSampleDuration.Hours()
+	outSampleRate := outSample.Return / outSampleDuration.Hours()
+	if inSampleRate == 0 {
+		return 0
+	}
+	return outSampleRate / inSampleRate
+}
+
+// WindowResult 单个窗口的优化及验证结果
+type WindowResult struct {
+	Window
+	Params     map[string]string `json:"params"`
+	InSample   Result            `json:"inSample"`
+	OutSample  Result            `json:"outSample"`
+	Efficiency float64           `json:"efficiency"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// WalkForwardReport 前进分析报告，Equity 为拼接后的样本外权益曲线
+type WalkForwardReport struct {
+	Windows    []WindowResult `json:"windows"`
+	Equity     []EquityPoint  `json:"equity"`
+	Return     float64        `json:"return"`
+	Efficiency float64        `json:"efficiency"`
+}
+
+// WalkForward 前进分析: 逐个窗口在样本内搜索最优参数并在样本外验证
+type WalkForward struct {
+	space     Space
+	windows   []Window
+	newRunner func(name string) Runner
+	options   []Option
+}
+
+// NewWalkForward newRunner 按阶段名称 (如 window-1/in-sample) 创建回测执行器，options 为样本内搜索配置
+func NewWalkForward(space Space, windows []Window, newRunner func(name string) Runner, options ...Option) *WalkForward {
+	return &WalkForward{
+		space:     space,
+		windows:   windows,
+		newRunner: newRunner,
+		options:   options,
+	}
+}
+
+func (w *WalkForward) Run(ctx context.Context) (WalkForwardReport, error) {
+	report := WalkForwardReport{}
+	for i, window := range w.windows {
+		result := WindowResult{Window: window}
+
+		name := fmt.Sprintf("window-%d", i+1)
+		optimizer, err := NewOptimizer(periodRunner{
+			runner: w.newRunner(filepath.Join(name, "in-sample")),
+			start:  window.InSampleStart,
+			end:    window.InSampleEnd,
+		}, w.space, w.options...)
+		if err != nil {
+			return report, err
+		}
+		trials, err := optimizer.Run(ctx)
+		if err != nil {
+			return report, err
+		}
+		if len(trials) == 0 || trials[0].Error != "" {
+			result.Error = "no successful in-sample trial"
+			report.Windows = append(report.Windows, result)
+			continue
+		}
+		result.Params = trials[0].Params
+		result.InSample = trials[0].Result
+		result.InSample.Equity = nil
+
+		outSample, err := periodRunner{
+			runner: w.newRunner(filepath.Join(name, "out-sample")),
+			start:  window.OutSampleStart,
+			end:    window.OutSampleEnd,
+		}.Run(ctx, 1, result.Params)
+		if err != nil {
+			result.Error = err.Error()
+			report.Windows = append(report.Windows, result)
+			continue
+		}
+		result.OutSample = outSample
+		result.Efficiency = efficiency(
+			result.InSample,
+			result.OutSample,
+			window.InSampleEnd.Sub(window.InSampleStart),
+			window.OutSampleEnd.Sub(window.OutSampleStart),
+		)
+		report.Windows = append(report.Windows, result)
+	}
+	report.stitch()
+	return report, nil
+}
+
+// stitch 按复利拼接各窗口样本外权益曲线，并计算整体前进效率
+func (r *WalkForwardReport) stitch() {
+	var (
+		initial          float64
+		capital          float64
+		inSampleReturn   float64
+		inSampleDuration time.Duration
+		outSampleTotal   time.Duration
+	)
+	for i := range r.Windows {
+		window := &r.Windows[i]
+		outSample := window.OutSample
+		if window.Error != "" || outSample.InitialValue <= 0 {
+			continue
+		}
+		if initial == 0 {
+			initial = outSample.InitialValue
+			capital = initial
+		}
+
+		scale := capital / outSample.InitialValue
+		r.Equity = append(r.Equity, EquityPoint{Time: window.OutSampleStart, Value: capital})
+		for _, point := range outSample.Equity {
+			r.Equity = append(r.Equity, EquityPoint{Time: point.Time, Value: point.Value * scale})
+		}
+		capital *= outSample.FinalValue / outSample.InitialValue
+		window.OutSample.Equity = nil
+
+		inSampleReturn += window.InSample.Return
+		inSampleDuration += window.InSampleEnd.Sub(window.InSampleStart)
+		outSampleTotal += window.OutSampleEnd.Sub(window.OutSampleStart)
+	}
+	if initial == 0 {
+		return
+	}
+	r.Equity = append(r.Equity, EquityPoint{Time: r.Windows[len(r.Windows)-1].OutSampleEnd, Value: capital})
+	r.Return = capital/initial - 1
+	r.Efficiency = efficiency(
+		Result{Return: inSampleReturn},
+		Result{Return: r.Return},
+		inSampleDuration,
+		outSampleTotal,
+	)
+}
+
+func (r WalkForwardReport) String() string {
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.SetHeader([]string{"Window", "In Sample", "Out Sample", "Params", "IS Return", "OOS Return", "OOS Trades", "OOS Max DD", "WFE"})
+	table.SetFooterAlignment(tablewriter.ALIGN_RIGHT)
+	for i, window := range r.Windows {
+		params := fmt.Sprintf("%v", window.Params)
+		if window.Error != "" {
+			params = window.Error
+		}
+		table.Append([]string{
+			strconv.Itoa(i + 1),
+			fmt.Sprintf("%s ~ %s", window.InSampleStart.Format("2006-01-02"), window.InSampleEnd.Format("2006-01-02")),
+			fmt.Sprintf("%s ~ %s", window.OutSampleStart.Format("2006-01-02"), window.OutSampleEnd.Format("2006-01-02")),
+			params,
+			fmt.Sprintf("%.2f %%", window.InSample.Return*100),
+			fmt.Sprintf("%.2f %%", window.OutSample.Return*100),
+			strconv.Itoa(window.OutSample.Trades),
+			fmt.Sprintf("%.2f %%", window.OutSample.MaxDrawdown*100),
+			fmt.Sprintf("%.2f", window.Efficiency),
+		})
+	}
+	table.SetFooter([]string{"TOTAL", "", "", "", "", fmt.Sprintf("%.2f %%", r.Return*100), "", "", fmt.Sprintf("%.2f", r.Efficiency)})
+	table.Render()
+	return buffer.String()
+}
+
+// Save 输出 report.json 及拼接后的样本外权益曲线 equity.csv
+func (r WalkForwardReport) Save(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), content, 0644); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(dir, "equity.csv"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"time", "equity"}); err != nil {
+		return err
+	}
+	for _, point := range r.Equity {
+		if err := writer.Write([]string{
+			strconv.FormatInt(point.Time.Unix(), 10),
+			strconv.FormatFloat(point.Value, 'f', 4, 64),
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
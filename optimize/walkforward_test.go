@@ -0,0 +1,43 @@
+package optimize
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindows(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 100)
+	day := 24 * time.Hour
+
+	windows := Windows(start, end, 60*day, 20*day, false)
+	require.Len(t, windows, 2)
+	require.Equal(t, start.AddDate(0, 0, 20), windows[1].InSampleStart)
+	require.Equal(t, start.AddDate(0, 0, 80), windows[1].OutSampleStart)
+	require.Equal(t, start.AddDate(0, 0, 100), windows[1].OutSampleEnd)
+
+	windows = Windows(start, end, 60*day, 20*day, true)
+	require.Equal(t, start, windows[1].InSampleStart)
+}
+
+func TestWalkForwardReport_stitch(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows := Windows(start, start.AddDate(0, 0, 40), 20*24*time.Hour, 10*24*time.Hour, false)
+	report := WalkForwardReport{}
+	for _, window := range windows {
+		report.Windows = append(report.Windows, WindowResult{
+			Window:    window,
+			InSample:  Result{Return: 0.2},
+			OutSample: Result{InitialValue: 100, FinalValue: 110, Return: 0.1},
+		})
+	}
+	report.stitch()
+
+	require.InDelta(t, 0.21, report.Return, 1e-9)
+	require.InDelta(t, 121, report.Equity[len(report.Equity)-1].Value, 1e-9)
+	require.InDelta(t, 110, report.Equity[1].Value, 1e-9)
+	// 样本外 20 天收益 21%，样本内 40 天累计收益 40%
+	require.InDelta(t, 1.05, report.Efficiency, 1e-9)
+}
@@ -3,6 +3,7 @@
 package reference
 
 import (
+	"context"
 	"floolishman/model"
 	"time"
 )
@@ -30,3 +31,8 @@ type Broker interface {
 	Cancel(model.Order) error
 	ListenOrders()
 }
+
+// UserDataStreamer 支持推送订单及仓位变化的交易所，连接断开后自动重连，ctx 结束时关闭推送
+type UserDataStreamer interface {
+	UserDataSubscription(ctx context.Context) (chan model.UserDataEvent, chan error)
+}
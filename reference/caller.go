@@ -10,7 +10,7 @@ import (
 type Caller interface {
 	Start()
 	OpenTube(pair string)
-	Init(context.Context, model.CompositesStrategy, Broker, Exchange, types.CallerSetting)
+	Init(context.Context, model.CompositesStrategy, Broker, Exchange, Clock, types.CallerSetting)
 	SetPair(option model.PairOption)
 	SetSample(pair string, timeframe string, strategyName string, dataframe *model.Dataframe)
 	UpdatePairInfo(pair string, price float64, volume float64, updatedAt time.Time)
@@ -18,3 +18,13 @@ type Caller interface {
 	EventCallOpen(pair string)
 	EventCallClose(pair string)
 }
+
+// BacktestDriver 需要跨交易对决策的caller，回测时在所有交易对同一时刻的K线处理完成后调用
+type BacktestDriver interface {
+	OnBacktestTick()
+}
+
+// GridReporter 提供网格统计的caller，回测结束时输出
+type GridReporter interface {
+	GridStats() map[string]*model.GridStats
+}
@@ -0,0 +1,10 @@
+package reference
+
+import "time"
+
+// Clock 时钟，实盘使用系统时间，回测由回放的K线时间驱动
+type Clock interface {
+	Now() time.Time
+	// AfterFunc 经过指定时长后执行回调
+	AfterFunc(d time.Duration, f func())
+}
@@ -16,3 +16,8 @@ type Feeder interface {
 	CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error)
 	CandlesBatchSubscription(ctx context.Context, combineConfig map[string]string) (map[string]chan model.Candle, chan error)
 }
+
+// MarketDataFeeder 提供合约市场数据历史 (资金费率、持仓量、多空比、主动买卖量、标记价格) 的交易所
+type MarketDataFeeder interface {
+	MarketData(ctx context.Context, dataset, pair, period string, start, end time.Time) ([]model.MarketData, error)
+}
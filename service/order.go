@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"floolishman/exchange"
@@ -37,6 +38,10 @@ type summary struct {
 	LoseShortPercent  []float64
 	LoseShortStrateis map[string]int
 	Volume            float64
+	Funding           float64
+	Fees              float64
+	Liquidations      int
+	Trades            []Result
 }
 
 func (s summary) Win() []float64 {
@@ -131,6 +136,9 @@ func (s summary) String() string {
 		{"Pr.Fact", fmt.Sprintf("%.1f", s.ProfitFactor()*100)},
 		{"Profit", fmt.Sprintf("%.4f %s", s.Profit(), quote)},
 		{"Volume", fmt.Sprintf("%.4f %s", s.Volume, quote)},
+		{"Funding", fmt.Sprintf("%.4f %s", s.Funding, quote)},
+		{"Fees", fmt.Sprintf("%.4f %s", s.Fees, quote)},
+		{"Liquidations", strconv.Itoa(s.Liquidations)},
 	}
 	table.AppendBulk(data)
 	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
@@ -189,6 +197,9 @@ const (
 type Result struct {
 	Pair                 string
 	OrderFlag            string // 当前方向仓位标识
+	EntryPrice           float64
+	ExitPrice            float64
+	Quantity             float64
 	ProfitPercent        float64
 	ProfitValue          float64
 	MatcherStrategyCount map[string]int
@@ -206,9 +217,16 @@ type ServiceOrder struct {
 	Results                map[string]*summary
 	tickerOrderInterval    time.Duration
 	tickerPositionInterval time.Duration
-	finish                 chan bool
-	status                 Status
+	// 用户数据流连接时，订单及仓位轮询仅作为定期对账
+	tickerReconcileInterval time.Duration
+	finish                  chan bool
+	status                  Status
 
+	streaming        atomic.Bool
+	lastOrderSync    atomic.Int64
+	lastPositionSync atomic.Int64
+
+	// positionMap 由 mtx 保护
 	positionMap map[string]map[string]*model.Position
 }
 
@@ -224,27 +242,35 @@ func NewServiceOrder(ctx context.Context, exchange reference.Exchange, storage s
 	orderFeed *model.Feed) *ServiceOrder {
 
 	return &ServiceOrder{
-		ctx:                    ctx,
-		storage:                storage,
-		exchange:               exchange,
-		orderFeed:              orderFeed,
-		tickerOrderInterval:    500 * time.Millisecond,
-		tickerPositionInterval: 10 * time.Second,
-		finish:                 make(chan bool),
-		Results:                make(map[string]*summary),
-		positionMap:            make(map[string]map[string]*model.Position),
+		ctx:                     ctx,
+		storage:                 storage,
+		exchange:                exchange,
+		orderFeed:               orderFeed,
+		tickerOrderInterval:     500 * time.Millisecond,
+		tickerPositionInterval:  10 * time.Second,
+		tickerReconcileInterval: time.Minute,
+		finish:                  make(chan bool),
+		Results:                 make(map[string]*summary),
+		positionMap:             make(map[string]map[string]*model.Position),
 	}
 }
 
 func (c *ServiceOrder) Start() {
 	if c.status != StatusRunning {
 		c.status = StatusRunning
+		// 交易所支持用户数据流时，由推送更新订单及仓位
+		if streamer, ok := c.exchange.(reference.UserDataStreamer); ok {
+			go c.listenUserData(streamer)
+		}
 		// 监听所有挂单
 		go func() {
 			tickerOrder := time.NewTicker(c.tickerOrderInterval)
 			for {
 				select {
 				case <-tickerOrder.C:
+					if !c.reconcilable(&c.lastOrderSync) {
+						continue
+					}
 					c.ListenOrders()
 				case <-c.finish:
 					tickerOrder.Stop()
@@ -257,6 +283,9 @@ func (c *ServiceOrder) Start() {
 			for {
 				select {
 				case <-tickerPosition.C:
+					if !c.reconcilable(&c.lastPositionSync) {
+						continue
+					}
 					c.ListenPositions()
 				case <-c.finish:
 					tickerPosition.Stop()
@@ -277,26 +306,147 @@ func (c *ServiceOrder) Stop() {
 	}
 }
 
+// reconcilable 用户数据流连接时按对账间隔轮询，否则每次都轮询
+func (c *ServiceOrder) reconcilable(last *atomic.Int64) bool {
+	now := time.Now()
+	if c.streaming.Load() && now.Sub(time.Unix(0, last.Load())) < c.tickerReconcileInterval {
+		return false
+	}
+	last.Store(now.UnixNano())
+	return true
+}
+
+// listenUserData 处理用户数据流推送，推送关闭时恢复轮询
+func (c *ServiceOrder) listenUserData(streamer reference.UserDataStreamer) {
+	cevent, cerr := streamer.UserDataSubscription(c.ctx)
+	defer c.streaming.Store(false)
+	for {
+		select {
+		case event, ok := <-cevent:
+			if !ok {
+				return
+			}
+			c.OnUserData(event)
+		case err, ok := <-cerr:
+			if !ok {
+				cerr = nil
+				continue
+			}
+			utils.Log.Error("[USER DATA] ", err)
+		}
+	}
+}
+
+// OnUserData 处理用户数据流事件，订单及仓位按推送更新
+// 连接建立时立即对账一次，补齐断开期间遗漏的变化，断开期间恢复高频轮询
+func (c *ServiceOrder) OnUserData(event model.UserDataEvent) {
+	switch event.Type {
+	case model.UserDataConnected:
+		c.lastOrderSync.Store(0)
+		c.lastPositionSync.Store(0)
+		c.streaming.Store(true)
+	case model.UserDataDisconnected:
+		c.streaming.Store(false)
+	case model.UserDataOrderUpdate:
+		c.onOrderUpdate(event.Order)
+	case model.UserDataAccountUpdate:
+		// 推送仅包含发生变化的仓位，未推送的交易对及方向由轮询对账处理
+		pushed := make(map[string]map[string]bool)
+		pairPositions := make(map[string]map[string]*model.Position)
+		for i := range event.Positions {
+			position := event.Positions[i]
+			if _, ok := pushed[position.Pair]; !ok {
+				pushed[position.Pair] = make(map[string]bool)
+			}
+			pushed[position.Pair][position.PositionSide] = true
+			if position.Quantity == 0 {
+				continue
+			}
+			if _, ok := pairPositions[position.Pair]; !ok {
+				pairPositions[position.Pair] = make(map[string]*model.Position)
+			}
+			pairPositions[position.Pair][position.PositionSide] = &position
+		}
+		c.syncPositions(pairPositions, pushed)
+	case model.UserDataMarginCall:
+		for _, position := range event.Positions {
+			message := fmt.Sprintf("[MARGIN CALL] %s %s quantity: %v, avgPrice: %v", position.Pair, position.PositionSide, position.Quantity, position.AvgPrice)
+			utils.Log.Warn(message)
+			c.notify(message)
+		}
+	}
+}
+
+// onOrderUpdate 更新推送的订单，非本地未完成订单或状态未变化时忽略
+func (c *ServiceOrder) onOrderUpdate(excOrder model.Order) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	orders, err := c.storage.Orders(
+		storage.OrderFilterParams{
+			Pair: excOrder.Pair,
+			Statuses: []model.OrderStatusType{
+				model.OrderStatusTypeNew,
+				model.OrderStatusTypePartiallyFilled,
+				model.OrderStatusTypePendingCancel,
+			},
+		},
+	)
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+	for _, order := range orders {
+		if order.ExchangeID != excOrder.ExchangeID {
+			continue
+		}
+		if excOrder.Status == order.Status {
+			return
+		}
+		if err := c.updateOrder(order, &excOrder); err != nil {
+			c.notifyError(err)
+			return
+		}
+		c.processTrade(&excOrder)
+		c.orderFeed.Publish(excOrder, false)
+		return
+	}
+}
+
 // ListenPositions 监控仓位，本地如果有仓位则判断线上有没有仓位，线上没有仓位则更新平仓
 func (c *ServiceOrder) ListenPositions() {
-	if len(c.positionMap) == 0 {
+	c.mtx.Lock()
+	empty := len(c.positionMap) == 0
+	c.mtx.Unlock()
+	if empty {
 		return
 	}
 
-	var ok bool
 	// 获取当前交易对线上仓位 map[pair][positionSide]position
 	pairPositions, err := c.PairPosition()
 	if err != nil {
 		utils.Log.Error(err)
 		return
 	}
+	c.syncPositions(pairPositions, nil)
+}
 
+// syncPositions 按线上仓位 map[pair][positionSide]position 同步本地仓位
+// pushed 不为空时仅同步其中的交易对及方向 map[pair][positionSide]，推送数量为0的仓位视为已平仓
+func (c *ServiceOrder) syncPositions(pairPositions map[string]map[string]*model.Position, pushed map[string]map[string]bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var ok bool
 	var callerStatus types.CallerStatus
 	for pair, flagPositions := range c.positionMap {
 		if len(flagPositions) == 0 {
 			continue
 		}
 		for orderFlag, position := range flagPositions {
+			if pushed != nil && !pushed[pair][position.PositionSide] {
+				continue
+			}
 			// 不存在删除仓位
 			if _, ok = pairPositions[position.Pair]; !ok {
 				position.Status = 10
@@ -389,7 +539,8 @@ func (c *ServiceOrder) ListenPositions() {
 				continue
 			}
 			hasChange := false
-			if position.Leverage != pairPositions[position.Pair][position.PositionSide].Leverage {
+			// 推送的仓位不含杠杆倍数
+			if pairPositions[position.Pair][position.PositionSide].Leverage > 0 && position.Leverage != pairPositions[position.Pair][position.PositionSide].Leverage {
 				c.positionMap[pair][orderFlag].Leverage = pairPositions[position.Pair][position.PositionSide].Leverage
 				hasChange = true
 			}
@@ -400,7 +551,7 @@ func (c *ServiceOrder) ListenPositions() {
 				hasChange = true
 			}
 			if hasChange == false {
-				return
+				continue
 			}
 			// 更新数据库仓位记录
 			err := c.storage.UpdatePosition(c.positionMap[pair][orderFlag])
@@ -417,11 +568,13 @@ func (c *ServiceOrder) SetNotifier(notifier reference.Notifier) {
 
 func (c *ServiceOrder) GetPositionsForPair(pair string) ([]*model.Position, error) {
 	positions := []*model.Position{}
+	c.mtx.Lock()
 	if _, ok := c.positionMap[pair]; ok {
 		for _, position := range c.positionMap[pair] {
 			positions = append(positions, position)
 		}
 	}
+	c.mtx.Unlock()
 	// 内存缓存中没有查询到，去数据库查询
 	if len(positions) == 0 {
 		positions, err := c.storage.Positions(storage.PositionFilterParams{Pair: pair, Status: []int{0, 1}})
@@ -431,6 +584,8 @@ func (c *ServiceOrder) GetPositionsForPair(pair string) ([]*model.Position, erro
 		// 重新缓存到内存
 		if len(positions) > 0 {
 			go func() {
+				c.mtx.Lock()
+				defer c.mtx.Unlock()
 				// 交易对已知，提前初始化
 				if _, ok := c.positionMap[pair]; !ok {
 					c.positionMap[pair] = make(map[string]*model.Position)
@@ -448,13 +603,13 @@ func (c *ServiceOrder) GetPositionsForPair(pair string) ([]*model.Position, erro
 func (c *ServiceOrder) GetPositionsForOpened() ([]*model.Position, error) {
 	positions := []*model.Position{}
 
-	if len(c.positionMap) > 0 {
-		for _, pairPositions := range c.positionMap {
-			for _, position := range pairPositions {
-				positions = append(positions, position)
-			}
+	c.mtx.Lock()
+	for _, pairPositions := range c.positionMap {
+		for _, position := range pairPositions {
+			positions = append(positions, position)
 		}
 	}
+	c.mtx.Unlock()
 	// 内存缓存中没有查询到，去数据库查询
 	if len(positions) == 0 {
 		positions, err := c.storage.Positions(storage.PositionFilterParams{Status: []int{0, 1}})
@@ -464,6 +619,8 @@ func (c *ServiceOrder) GetPositionsForOpened() ([]*model.Position, error) {
 		// 重新缓存到内存
 		if len(positions) > 0 {
 			go func() {
+				c.mtx.Lock()
+				defer c.mtx.Unlock()
 				for _, position := range positions {
 					if _, ok := c.positionMap[position.Pair]; !ok {
 						c.positionMap[position.Pair] = make(map[string]*model.Position)
@@ -620,6 +777,7 @@ func (c *ServiceOrder) Update(p *model.Position, order *model.Order) (result *Re
 		return nil
 	}
 	price := order.Price
+	p.Fee += order.Fee
 	if p.Side == string(order.Side) {
 		p.AvgPrice = (p.AvgPrice*p.Quantity + price*order.Quantity) / (p.Quantity + order.Quantity)
 		p.Quantity = calc.AccurateAdd(p.Quantity, order.Quantity)
@@ -633,7 +791,8 @@ func (c *ServiceOrder) Update(p *model.Position, order *model.Order) (result *Re
 				p.Quantity = 0
 				p.ClosePrice = price
 				p.Profit = calc.AccurateSub(price, p.AvgPrice) / p.AvgPrice
-				p.ProfitValue = calc.AccurateSub(price, p.AvgPrice) * p.TotalQuantity
+				p.ProfitValue = calc.AccurateSub(price, p.AvgPrice)*p.TotalQuantity - p.Fee
+				p.Profit -= p.Fee / (p.AvgPrice * p.TotalQuantity)
 			} else if p.Quantity > order.Quantity {
 				p.Quantity = calc.AccurateSub(p.Quantity, order.Quantity)
 				p.ClosePrice = price
@@ -648,6 +807,9 @@ func (c *ServiceOrder) Update(p *model.Position, order *model.Order) (result *Re
 			result = &Result{
 				Pair:                 p.Pair,
 				OrderFlag:            p.OrderFlag,
+				EntryPrice:           p.AvgPrice,
+				ExitPrice:            price,
+				Quantity:             p.TotalQuantity,
 				Duration:             order.CreatedAt.Sub(p.CreatedAt),
 				ProfitPercent:        p.Profit,
 				ProfitValue:          p.ProfitValue,
@@ -662,7 +824,8 @@ func (c *ServiceOrder) Update(p *model.Position, order *model.Order) (result *Re
 				p.Quantity = 0
 				p.ClosePrice = price
 				p.Profit = calc.AccurateSub(p.AvgPrice, price) / p.AvgPrice
-				p.ProfitValue = calc.AccurateSub(p.AvgPrice, price) * p.TotalQuantity
+				p.ProfitValue = calc.AccurateSub(p.AvgPrice, price)*p.TotalQuantity - p.Fee
+				p.Profit -= p.Fee / (p.AvgPrice * p.TotalQuantity)
 			} else if p.Quantity > order.Quantity {
 				p.Quantity = calc.AccurateSub(p.Quantity, order.Quantity)
 				p.ClosePrice = price
@@ -675,6 +838,9 @@ func (c *ServiceOrder) Update(p *model.Position, order *model.Order) (result *Re
 			result = &Result{
 				Pair:                 p.Pair,
 				OrderFlag:            p.OrderFlag,
+				EntryPrice:           p.AvgPrice,
+				ExitPrice:            price,
+				Quantity:             p.TotalQuantity,
 				Duration:             order.CreatedAt.Sub(p.CreatedAt),
 				ProfitPercent:        p.Profit,
 				ProfitValue:          p.ProfitValue,
@@ -730,6 +896,7 @@ func (c *ServiceOrder) updatePosition(o *model.Order) {
 				GuiderPositionRate:   o.GuiderPositionRate,
 				GuiderOrigin:         o.GuiderOrigin,
 				ChaseMode:            o.ChaseMode,
+				Fee:                  o.Fee,
 				CreatedAt:            o.CreatedAt,
 				MatcherStrategyCount: o.MatcherStrategyCount,
 				StopLossPrice:        o.StopLossPrice,
@@ -773,6 +940,7 @@ func (c *ServiceOrder) updatePosition(o *model.Order) {
 	}
 
 	if result != nil {
+		c.Results[o.Pair].Trades = append(c.Results[o.Pair].Trades, *result)
 		if result.ProfitPercent >= 0 {
 			if result.Side == model.SideTypeBuy {
 				c.Results[o.Pair].WinLong = append(c.Results[o.Pair].WinLong, result.ProfitValue)
@@ -845,22 +1013,53 @@ func (c *ServiceOrder) processTrade(order *model.Order) {
 	}
 
 	// initializer results map if needed
-	if _, ok := c.Results[order.Pair]; !ok {
-		c.Results[order.Pair] = &summary{
-			Pair:              order.Pair,
+	c.initResult(order.Pair)
+
+	// register order volume
+	c.Results[order.Pair].Volume += order.Price * order.Quantity
+	c.Results[order.Pair].Fees += order.Fee
+
+	// update position size / avg price
+	c.updatePosition(order)
+}
+func (c *ServiceOrder) initResult(pair string) {
+	if _, ok := c.Results[pair]; !ok {
+		c.Results[pair] = &summary{
+			Pair:              pair,
 			WinLongStrateis:   make(map[string]int),
 			WinShortStrateis:  make(map[string]int),
 			LoseLongStrateis:  make(map[string]int),
 			LoseShortStrateis: make(map[string]int),
 		}
 	}
+}
 
-	// register order volume
-	c.Results[order.Pair].Volume += order.Price * order.Quantity
+// OnFunding 记录资金费结算
+func (c *ServiceOrder) OnFunding(payment model.FundingPayment) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 
-	// update position size / avg price
-	c.updatePosition(order)
+	c.initResult(payment.Pair)
+	c.Results[payment.Pair].Funding += payment.Value
 }
+
+// OnLiquidation 记录强平订单并关闭对应仓位
+func (c *ServiceOrder) OnLiquidation(order model.Order) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.storage.CreateOrder(&order)
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+	utils.Log.Infof("[ORDER %s] %s", order.Type, order)
+
+	c.processTrade(&order)
+	c.Results[order.Pair].Liquidations++
+	c.orderFeed.Publish(order, false)
+}
+
 func (c *ServiceOrder) Status() Status {
 	return c.status
 }
@@ -896,19 +1095,7 @@ func (c *ServiceOrder) ListenOrders() {
 		if excOrder.Status == order.Status {
 			continue
 		}
-
-		excOrder.ID = order.ID
-		excOrder.OrderFlag = order.OrderFlag
-		excOrder.Type = order.Type
-		excOrder.Amount = order.Amount
-		excOrder.LongShortRatio = order.LongShortRatio
-		excOrder.Leverage = order.Leverage
-		excOrder.GuiderPositionRate = order.GuiderPositionRate
-		excOrder.GuiderOrigin = order.GuiderOrigin
-		excOrder.ChaseMode = order.ChaseMode
-		excOrder.StopLossPrice = order.StopLossPrice
-
-		err = c.storage.UpdateOrder(&excOrder)
+		err = c.updateOrder(order, &excOrder)
 		if err != nil {
 			c.notifyError(err)
 			continue
@@ -916,7 +1103,6 @@ func (c *ServiceOrder) ListenOrders() {
 		// 重新放入策略统计数据 todo 记录每次订单开仓的策略
 		//excOrder.MatcherStrategyCount = order.MatcherStrategyCount
 		// 放入更新数组
-		utils.Log.Infof("[ORDER %s] %s", excOrder.Status, excOrder)
 		updatedOrders = append(updatedOrders, excOrder)
 	}
 
@@ -926,6 +1112,26 @@ func (c *ServiceOrder) ListenOrders() {
 	}
 }
 
+// updateOrder 以交易所订单更新本地订单，保留本地记录的开仓信息
+func (c *ServiceOrder) updateOrder(order *model.Order, excOrder *model.Order) error {
+	excOrder.ID = order.ID
+	excOrder.OrderFlag = order.OrderFlag
+	excOrder.Type = order.Type
+	excOrder.Amount = order.Amount
+	excOrder.LongShortRatio = order.LongShortRatio
+	excOrder.Leverage = order.Leverage
+	excOrder.GuiderPositionRate = order.GuiderPositionRate
+	excOrder.GuiderOrigin = order.GuiderOrigin
+	excOrder.ChaseMode = order.ChaseMode
+	excOrder.StopLossPrice = order.StopLossPrice
+
+	if err := c.storage.UpdateOrder(excOrder); err != nil {
+		return err
+	}
+	utils.Log.Infof("[ORDER %s] %s", excOrder.Status, *excOrder)
+	return nil
+}
+
 func (c *ServiceOrder) Account() (model.Account, error) {
 	return c.exchange.Account()
 }
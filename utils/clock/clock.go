@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Wall 实盘时钟，使用系统时间
+type Wall struct{}
+
+func (Wall) Now() time.Time {
+	return time.Now()
+}
+
+func (Wall) AfterFunc(d time.Duration, f func()) {
+	time.AfterFunc(d, f)
+}
+
+type timer struct {
+	at time.Time
+	f  func()
+}
+
+// Candle 回测时钟，时间由回放的K线推进，定时回调在时间推进到期时执行
+type Candle struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []timer
+}
+
+func NewCandle() *Candle {
+	return &Candle{}
+}
+
+func (c *Candle) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Candle) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, timer{at: c.now.Add(d), f: f})
+}
+
+// Advance 推进当前时间，早于当前时间时忽略以保证时间单调递增，到期的回调按到期时间顺序执行
+func (c *Candle) Advance(t time.Time) {
+	c.mu.Lock()
+	if !t.After(c.now) {
+		c.mu.Unlock()
+		return
+	}
+	c.now = t
+	expired := make([]timer, 0)
+	pending := c.timers[:0]
+	for _, item := range c.timers {
+		if item.at.After(t) {
+			pending = append(pending, item)
+		} else {
+			expired = append(expired, item)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].at.Before(expired[j].at)
+	})
+	for _, item := range expired {
+		item.f()
+	}
+}
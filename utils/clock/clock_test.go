@@ -0,0 +1,29 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCandle(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCandle()
+	c.Advance(start)
+	require.Equal(t, start, c.Now())
+
+	fired := make([]int, 0)
+	c.AfterFunc(10*time.Minute, func() { fired = append(fired, 2) })
+	c.AfterFunc(5*time.Minute, func() { fired = append(fired, 1) })
+
+	c.Advance(start.Add(5 * time.Minute))
+	require.Equal(t, []int{1}, fired)
+
+	// 时间不回退
+	c.Advance(start)
+	require.Equal(t, start.Add(5*time.Minute), c.Now())
+
+	c.Advance(start.Add(time.Hour))
+	require.Equal(t, []int{1, 2}, fired)
+}
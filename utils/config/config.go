@@ -110,6 +110,48 @@ func setEnvConfig() error {
 	return nil
 }
 
+// GetSection 读取指定前缀下的全部配置，键为完整路径，值包含环境变量覆盖
+func GetSection(prefix string) map[string]interface{} {
+	section := make(map[string]interface{})
+	for _, key := range viper.AllKeys() {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			section[key] = viper.Get(key)
+		}
+	}
+	return section
+}
+
+// GetPairs 读取 pairs 下各交易对的配置，与 viper.GetStringMap("pairs") 结构一致
+// 各配置项包含 PAIRS_{PAIR}_{KEY} 环境变量覆盖，并保持配置文件中的类型
+func GetPairs() map[string]interface{} {
+	pairs := make(map[string]interface{})
+	for pair, setting := range viper.GetStringMap("pairs") {
+		values, ok := setting.(map[string]interface{})
+		if !ok {
+			pairs[pair] = setting
+			continue
+		}
+		resolved := make(map[string]interface{}, len(values))
+		for name, value := range values {
+			key := "pairs." + pair + "." + name
+			switch value.(type) {
+			case float64:
+				resolved[name] = viper.GetFloat64(key)
+			case int:
+				resolved[name] = viper.GetInt(key)
+			case bool:
+				resolved[name] = viper.GetBool(key)
+			case string:
+				resolved[name] = viper.GetString(key)
+			default:
+				resolved[name] = viper.Get(key)
+			}
+		}
+		pairs[pair] = resolved
+	}
+	return pairs
+}
+
 // 监听配置文件是否改变,用于热更新
 func watchConfig() {
 	viper.WatchConfig()
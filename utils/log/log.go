@@ -35,6 +35,10 @@ func InitLogger() *logrus.Logger {
 		Log.Out = os.Stdout
 	}
 	dataPath := viper.GetString("log.path")
+	// 未配置日志目录时(如单元测试)仅输出到控制台
+	if dataPath == "" {
+		return Log
+	}
 	_, err = os.Stat(dataPath)
 	if err != nil {
 		err = os.MkdirAll(dataPath, os.ModePerm)
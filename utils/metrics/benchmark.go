@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Comparison 策略相对基准的表现
+type Comparison struct {
+	Alpha            float64
+	Beta             float64
+	Correlation      float64
+	InformationRatio float64
+}
+
+// Growth 收益率序列的累计净值，起始为1
+func Growth(returns []float64) []float64 {
+	values := make([]float64, 0, len(returns)+1)
+	values = append(values, 1)
+	for _, value := range returns {
+		values = append(values, values[len(values)-1]*(1+value))
+	}
+	return values
+}
+
+// EqualWeight 等权买入持有组合的收益率，各成分自起始日对齐，长度不同时截断
+func EqualWeight(returns ...[]float64) []float64 {
+	if len(returns) == 0 {
+		return nil
+	}
+	size := len(returns[0])
+	for _, items := range returns {
+		size = min(size, len(items))
+	}
+	basket := make([]float64, size+1)
+	for _, items := range returns {
+		for i, value := range Growth(items[:size]) {
+			basket[i] += value / float64(len(returns))
+		}
+	}
+	result := make([]float64, 0, size)
+	for i := 1; i < len(basket); i++ {
+		result = append(result, basket[i]/basket[i-1]-1)
+	}
+	return result
+}
+
+// Compare 比较策略与基准的日收益率，两者自起始日对齐，长度不同时截断
+// Alpha 为年化詹森阿尔法 (无风险利率为0)，信息比率为年化超额收益与跟踪误差之比
+func Compare(returns, benchmark []float64, periodsPerYear float64) Comparison {
+	size := min(len(returns), len(benchmark))
+	if size < 2 {
+		return Comparison{}
+	}
+	returns, benchmark = returns[:size], benchmark[:size]
+
+	var comparison Comparison
+	if variance := stat.Variance(benchmark, nil); variance > 0 {
+		comparison.Beta = stat.Covariance(returns, benchmark, nil) / variance
+	}
+	comparison.Alpha = (stat.Mean(returns, nil) - comparison.Beta*stat.Mean(benchmark, nil)) * periodsPerYear
+	if correlation := stat.Correlation(returns, benchmark, nil); !math.IsNaN(correlation) {
+		comparison.Correlation = correlation
+	}
+
+	active := make([]float64, size)
+	for i := range active {
+		active[i] = returns[i] - benchmark[i]
+	}
+	mean, stdDev := stat.MeanStdDev(active, nil)
+	if stdDev > 0 {
+		comparison.InformationRatio = mean / stdDev * math.Sqrt(periodsPerYear)
+	}
+	return comparison
+}
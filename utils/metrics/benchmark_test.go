@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	benchmark := []float64{0.01, -0.02, 0.03, 0.01}
+	returns := make([]float64, len(benchmark))
+	for i, value := range benchmark {
+		returns[i] = 2*value + 0.001
+	}
+
+	comparison := Compare(returns, benchmark, DaysPerYear)
+	require.InDelta(t, 2, comparison.Beta, 1e-9)
+	require.InDelta(t, 0.001*DaysPerYear, comparison.Alpha, 1e-9)
+	require.InDelta(t, 1, comparison.Correlation, 1e-9)
+	require.Greater(t, comparison.InformationRatio, 0.0)
+	require.Equal(t, Comparison{}, Compare(returns[:1], benchmark, DaysPerYear))
+}
+
+func TestEqualWeight(t *testing.T) {
+	require.InDeltaSlice(t, []float64{1, 1.1, 0.99}, Growth([]float64{0.1, -0.1}), 1e-9)
+	// 成分净值 1 -> 2 及 1 -> 1，等权组合 1 -> 1.5，较长的序列被截断
+	require.InDeltaSlice(t, []float64{0.5}, EqualWeight([]float64{1, 0.5}, []float64{0}), 1e-9)
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+type MonteCarloSettings struct {
+	// Simulations 模拟次数
+	Simulations int
+	// InitialValue 初始资金
+	InitialValue float64
+	// Scale 交易盈亏缩放倍数，用于模拟不同杠杆
+	Scale float64
+	// Ruin 权益亏损达到初始资金的该比例视为破产
+	Ruin float64
+	// Resample 为 true 时有放回重采样交易序列，否则仅打乱交易顺序
+	Resample bool
+	Seed     int64
+}
+
+// MonteCarloSample 单次模拟结果，Recovery 为最长水下持续的交易笔数
+type MonteCarloSample struct {
+	MaxDrawdown float64
+	Recovery    int
+	FinalValue  float64
+	Ruined      bool
+}
+
+type MonteCarloResult struct {
+	Samples []MonteCarloSample
+}
+
+// simulate 按给定交易顺序计算权益路径
+func simulate(values []float64, settings MonteCarloSettings) MonteCarloSample {
+	var (
+		sample     MonteCarloSample
+		equity     = settings.InitialValue
+		peak       = settings.InitialValue
+		underwater int
+		ruinValue  = settings.InitialValue * (1 - settings.Ruin)
+	)
+	for _, value := range values {
+		equity += value * settings.Scale
+		if equity >= peak {
+			peak = equity
+			underwater = 0
+		} else {
+			underwater++
+		}
+		if peak > 0 {
+			if drawdown := (peak - equity) / peak; drawdown > sample.MaxDrawdown {
+				sample.MaxDrawdown = drawdown
+			}
+		}
+		if underwater > sample.Recovery {
+			sample.Recovery = underwater
+		}
+		if settings.Ruin > 0 && equity <= ruinValue {
+			sample.Ruined = true
+		}
+	}
+	sample.FinalValue = equity
+	return sample
+}
+
+// MonteCarlo 对交易盈亏序列进行蒙特卡洛模拟，得到最大回撤、回本时间、破产概率及最终权益的分布
+func MonteCarlo(values []float64, settings MonteCarloSettings) MonteCarloResult {
+	if settings.Scale == 0 {
+		settings.Scale = 1
+	}
+	random := rand.New(rand.NewSource(settings.Seed))
+	result := MonteCarloResult{Samples: make([]MonteCarloSample, 0, settings.Simulations)}
+	sequence := make([]float64, len(values))
+	for i := 0; i < settings.Simulations; i++ {
+		if settings.Resample {
+			for j := range sequence {
+				sequence[j] = values[random.Intn(len(values))]
+			}
+		} else {
+			copy(sequence, values)
+			random.Shuffle(len(sequence), func(a, b int) {
+				sequence[a], sequence[b] = sequence[b], sequence[a]
+			})
+		}
+		result.Samples = append(result.Samples, simulate(sequence, settings))
+	}
+	return result
+}
+
+func (r MonteCarloResult) quantile(p float64, value func(MonteCarloSample) float64) float64 {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	data := make([]float64, len(r.Samples))
+	for i, sample := range r.Samples {
+		data[i] = value(sample)
+	}
+	sort.Float64s(data)
+	return stat.Quantile(p, stat.Empirical, data, nil)
+}
+
+// MaxDrawdown 最大回撤的 p 分位数
+func (r MonteCarloResult) MaxDrawdown(p float64) float64 {
+	return r.quantile(p, func(sample MonteCarloSample) float64 {
+		return sample.MaxDrawdown
+	})
+}
+
+// Recovery 最长水下交易笔数的 p 分位数
+func (r MonteCarloResult) Recovery(p float64) float64 {
+	return r.quantile(p, func(sample MonteCarloSample) float64 {
+		return float64(sample.Recovery)
+	})
+}
+
+// FinalValue 最终权益的 p 分位数
+func (r MonteCarloResult) FinalValue(p float64) float64 {
+	return r.quantile(p, func(sample MonteCarloSample) float64 {
+		return sample.FinalValue
+	})
+}
+
+// RuinProbability 破产概率
+func (r MonteCarloResult) RuinProbability() float64 {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	ruined := 0
+	for _, sample := range r.Samples {
+		if sample.Ruined {
+			ruined++
+		}
+	}
+	return float64(ruined) / float64(len(r.Samples))
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonteCarlo(t *testing.T) {
+	values := []float64{10, -5, 20, -15, 5, -10, 30, -20}
+
+	t.Run("shuffle", func(t *testing.T) {
+		result := MonteCarlo(values, MonteCarloSettings{Simulations: 1000, InitialValue: 100, Ruin: 0.3})
+		require.Len(t, result.Samples, 1000)
+		// 打乱顺序不改变最终权益
+		require.InDelta(t, 115, result.FinalValue(0.05), 1e-9)
+		require.InDelta(t, 115, result.FinalValue(0.95), 1e-9)
+		require.LessOrEqual(t, result.MaxDrawdown(0.05), result.MaxDrawdown(0.95))
+		// 亏损交易集中在前面时权益跌破 70
+		require.Greater(t, result.RuinProbability(), 0.0)
+		require.Less(t, result.RuinProbability(), 1.0)
+	})
+
+	t.Run("scale", func(t *testing.T) {
+		result := MonteCarlo(values, MonteCarloSettings{Simulations: 100, InitialValue: 100, Scale: 2})
+		require.InDelta(t, 130, result.FinalValue(0.5), 1e-9)
+		require.Zero(t, result.RuinProbability())
+	})
+
+	t.Run("resample", func(t *testing.T) {
+		result := MonteCarlo(values, MonteCarloSettings{Simulations: 1000, InitialValue: 100, Resample: true, Seed: 1})
+		require.Less(t, result.FinalValue(0.05), result.FinalValue(0.95))
+	})
+}
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// DaysPerYear 加密货币全年交易，按自然日年化
+const DaysPerYear = 365
+
+// Interval 持仓区间
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Performance 风险调整后的绩效指标
+type Performance struct {
+	Sharpe              float64
+	Sortino             float64
+	Calmar              float64
+	Ulcer               float64
+	MaxDrawdown         float64
+	MaxDrawdownDuration time.Duration
+	Exposure            float64
+	Expectancy          float64
+	AverageHolding      time.Duration
+	EntryEfficiency     float64
+	ExitEfficiency      float64
+	TotalEfficiency     float64
+	WinStreak           int
+	LoseStreak          int
+}
+
+// DailyReturns 将不等间隔的权益序列按日末值向前填充后计算日收益率
+func DailyReturns(times []time.Time, values []float64) []float64 {
+	if len(times) < 2 {
+		return nil
+	}
+	day := func(t time.Time) time.Time {
+		return t.UTC().Truncate(24 * time.Hour)
+	}
+
+	closes := []float64{values[0]}
+	current := day(times[0])
+	last := values[0]
+	for i, t := range times {
+		for d := day(t); current.Before(d); current = current.Add(24 * time.Hour) {
+			closes = append(closes, last)
+		}
+		last = values[i]
+	}
+	closes = append(closes, last)
+
+	returns := make([]float64, 0, len(closes))
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] == 0 {
+			continue
+		}
+		returns = append(returns, closes[i]/closes[i-1]-1)
+	}
+	return returns
+}
+
+// Sharpe 年化夏普比率 (无风险利率为0)
+func Sharpe(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	mean, stdDev := stat.MeanStdDev(returns, nil)
+	if stdDev == 0 {
+		return 0
+	}
+	return mean / stdDev * math.Sqrt(periodsPerYear)
+}
+
+// Sortino 年化索提诺比率，仅以下行波动衡量风险
+func Sortino(returns []float64, periodsPerYear float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	downside := 0.0
+	for _, value := range returns {
+		if value < 0 {
+			downside += value * value
+		}
+	}
+	downside = math.Sqrt(downside / float64(len(returns)))
+	if downside == 0 {
+		return 0
+	}
+	return stat.Mean(returns, nil) / downside * math.Sqrt(periodsPerYear)
+}
+
+// MaxDrawdown 最大回撤比例
+func MaxDrawdown(values []float64) float64 {
+	peak := math.Inf(-1)
+	maxDrawdown := 0.0
+	for _, value := range values {
+		peak = math.Max(peak, value)
+		if peak > 0 {
+			maxDrawdown = math.Max(maxDrawdown, (peak-value)/peak)
+		}
+	}
+	return maxDrawdown
+}
+
+// AnnualReturn 按持续时间复利年化收益率
+func AnnualReturn(start, end float64, duration time.Duration) float64 {
+	years := duration.Hours() / 24 / DaysPerYear
+	if start <= 0 || end <= 0 || years <= 0 {
+		return 0
+	}
+	return math.Pow(end/start, 1/years) - 1
+}
+
+// Calmar 年化收益率与最大回撤之比
+func Calmar(annualReturn, maxDrawdown float64) float64 {
+	if maxDrawdown == 0 {
+		return 0
+	}
+	return annualReturn / maxDrawdown
+}
+
+// Ulcer 溃疡指数，回撤百分比的均方根
+func Ulcer(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	peak := math.Inf(-1)
+	sum := 0.0
+	for _, value := range values {
+		peak = math.Max(peak, value)
+		drawdown := 0.0
+		if peak > 0 {
+			drawdown = (peak - value) / peak * 100
+		}
+		sum += drawdown * drawdown
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// MaxDrawdownDuration 权益从前高回落到重新创新高的最长时间，未恢复时计算到最后一个点
+func MaxDrawdownDuration(times []time.Time, values []float64) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	var (
+		peak        = values[0]
+		peakTime    = times[0]
+		maxDuration time.Duration
+	)
+	for i, value := range values {
+		if value >= peak {
+			peak = value
+			peakTime = times[i]
+			continue
+		}
+		if duration := times[i].Sub(peakTime); duration > maxDuration {
+			maxDuration = duration
+		}
+	}
+	return maxDuration
+}
+
+// Exposure 持仓时间占回测时间的比例，重叠的持仓区间只计算一次
+func Exposure(intervals []Interval, start, end time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 || len(intervals) == 0 {
+		return 0
+	}
+	sorted := append([]Interval{}, intervals...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var (
+		exposed time.Duration
+		current = sorted[0]
+	)
+	for _, interval := range sorted[1:] {
+		if !interval.Start.After(current.End) {
+			if interval.End.After(current.End) {
+				current.End = interval.End
+			}
+			continue
+		}
+		exposed += current.End.Sub(current.Start)
+		current = interval
+	}
+	exposed += current.End.Sub(current.Start)
+	return math.Min(1, exposed.Seconds()/total.Seconds())
+}
+
+// Expectancy 每笔交易的期望盈亏
+func Expectancy(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return stat.Mean(values, nil)
+}
+
+// AverageHolding 平均持仓时间
+func AverageHolding(intervals []Interval) time.Duration {
+	if len(intervals) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, interval := range intervals {
+		total += interval.End.Sub(interval.Start)
+	}
+	return total / time.Duration(len(intervals))
+}
+
+// Streaks 按时间顺序的交易盈亏计算最长连胜、连亏次数
+func Streaks(values []float64) (int, int) {
+	var win, lose, maxWin, maxLose int
+	for _, value := range values {
+		if value >= 0 {
+			win++
+			lose = 0
+		} else {
+			lose++
+			win = 0
+		}
+		maxWin = max(maxWin, win)
+		maxLose = max(maxLose, lose)
+	}
+	return maxWin, maxLose
+}
+
+// TradeEfficiency 基于持仓期间最高/最低价 (MFE/MAE) 的入场、出场及整体效率
+// 入场效率衡量入场价距最优价的位置，出场效率衡量出场价距最优价的位置，整体效率为实际盈亏占最大波动的比例
+func TradeEfficiency(long bool, entry, exit, high, low float64) (float64, float64, float64) {
+	rangePrice := high - low
+	if rangePrice <= 0 {
+		return 0, 0, 0
+	}
+	if long {
+		return (high - entry) / rangePrice, (exit - low) / rangePrice, (exit - entry) / rangePrice
+	}
+	return (entry - low) / rangePrice, (high - exit) / rangePrice, (entry - exit) / rangePrice
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrawdownMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{start, start.Add(time.Hour), start.Add(48 * time.Hour), start.Add(72 * time.Hour), start.Add(96 * time.Hour)}
+	values := []float64{100, 120, 90, 110, 130}
+
+	require.InDelta(t, 0.25, MaxDrawdown(values), 1e-9)
+	require.Equal(t, 71*time.Hour, MaxDrawdownDuration(times, values))
+	require.InDelta(t, 35.3553, Ulcer([]float64{100, 50}), 1e-4)
+	require.InDeltaSlice(t, []float64{0.2, 0, -0.25, 110.0/90 - 1, 130.0/110 - 1}, DailyReturns(times, values), 1e-9)
+}
+
+func TestTradeMetrics(t *testing.T) {
+	win, lose := Streaks([]float64{1, 2, -1, -2, -3, 4})
+	require.Equal(t, 2, win)
+	require.Equal(t, 3, lose)
+	require.InDelta(t, 0.5, Expectancy([]float64{2, -1}), 1e-9)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	intervals := []Interval{
+		{Start: start, End: start.Add(2 * time.Hour)},
+		{Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)},
+		{Start: start.Add(5 * time.Hour), End: start.Add(6 * time.Hour)},
+	}
+	require.InDelta(t, 0.4, Exposure(intervals, start, start.Add(10*time.Hour)), 1e-9)
+	require.Equal(t, 100*time.Minute, AverageHolding(intervals))
+
+	entry, exit, total := TradeEfficiency(true, 100, 110, 120, 95)
+	require.InDelta(t, 0.8, entry, 1e-9)
+	require.InDelta(t, 0.6, exit, 1e-9)
+	require.InDelta(t, 0.4, total, 1e-9)
+}